@@ -0,0 +1,182 @@
+// Copyright 2021 Chaos Mesh Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package attack
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"strconv"
+
+	"github.com/spf13/cobra"
+	"go.uber.org/fx"
+
+	"github.com/chaos-mesh/chaosd/cmd/server"
+	"github.com/chaos-mesh/chaosd/pkg/core"
+	"github.com/chaos-mesh/chaosd/pkg/httpproxy"
+	"github.com/chaos-mesh/chaosd/pkg/server/chaosd"
+	"github.com/chaos-mesh/chaosd/pkg/utils"
+)
+
+func NewHTTPAttackCommand() *cobra.Command {
+	options := core.NewHTTPCommand()
+	dep := fx.Options(
+		server.Module,
+		fx.Provide(func() *core.HTTPCommand {
+			return options
+		}),
+	)
+
+	cmd := &cobra.Command{
+		Use:   "http <subcommand>",
+		Short: "HTTP attack related commands",
+	}
+
+	cmd.PersistentFlags().IntVarP(&options.Port, "port", "p", 0,
+		"the local port of the HTTP service, the TCP traffic to it is redirected to the proxy")
+	cmd.PersistentFlags().IntVarP(&options.ProxyPort, "proxy-port", "", 0,
+		"the port the proxy listens on, it's chosen automatically if it's 0")
+	cmd.PersistentFlags().StringVarP(&options.Method, "method", "m", "", "only impact the requests with this method")
+	cmd.PersistentFlags().StringVarP(&options.Path, "path", "", "",
+		"only impact the requests whose path matches this pattern, such as /api/*")
+	cmd.PersistentFlags().StringToStringVarP(&options.Headers, "header", "", nil,
+		"only impact the requests with these headers, such as X-User=chaos")
+
+	cmd.AddCommand(
+		NewHTTPAbortCommand(dep, options),
+		NewHTTPDelayCommand(dep, options),
+		NewHTTPReplaceCommand(dep, options),
+		NewHTTPPatchCommand(dep, options),
+		NewHTTPProxyCommand(),
+	)
+
+	return cmd
+}
+
+func NewHTTPAbortCommand(dep fx.Option, options *core.HTTPCommand) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "abort",
+		Short: "abort HTTP requests with the status code",
+
+		Run: func(*cobra.Command, []string) {
+			options.Action = core.HTTPAbortAction
+			utils.FxNewAppWithoutLog(dep, fx.Invoke(httpAttackF)).Run()
+		},
+	}
+
+	cmd.Flags().IntVarP(&options.Code, "code", "c", 0, "the status code responded to the requests")
+
+	return cmd
+}
+
+func NewHTTPDelayCommand(dep fx.Option, options *core.HTTPCommand) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "delay",
+		Short: "delay HTTP requests",
+
+		Run: func(*cobra.Command, []string) {
+			options.Action = core.HTTPDelayAction
+			utils.FxNewAppWithoutLog(dep, fx.Invoke(httpAttackF)).Run()
+		},
+	}
+
+	cmd.Flags().StringVarP(&options.Delay, "delay", "d", "",
+		"the delay before the requests are forwarded, time units: ns, us (or µs), ms, s, m, h.")
+
+	return cmd
+}
+
+func NewHTTPReplaceCommand(dep fx.Option, options *core.HTTPCommand) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "replace",
+		Short: "replace the body of HTTP responses",
+
+		Run: func(*cobra.Command, []string) {
+			options.Action = core.HTTPReplaceAction
+			utils.FxNewAppWithoutLog(dep, fx.Invoke(httpAttackF)).Run()
+		},
+	}
+
+	cmd.Flags().StringVarP(&options.Body, "body", "b", "", "the body replacing the body of responses")
+
+	return cmd
+}
+
+func NewHTTPPatchCommand(dep fx.Option, options *core.HTTPCommand) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "patch",
+		Short: "patch the headers of HTTP responses",
+
+		Run: func(*cobra.Command, []string) {
+			options.Action = core.HTTPPatchAction
+			utils.FxNewAppWithoutLog(dep, fx.Invoke(httpAttackF)).Run()
+		},
+	}
+
+	cmd.Flags().StringToStringVarP(&options.PatchHeaders, "patch-header", "", nil,
+		"the headers set in the responses, such as Cache-Control=no-cache")
+
+	return cmd
+}
+
+// NewHTTPProxyCommand returns the command run in background by the http attack,
+// which serves the redirected traffic until it is killed.
+func NewHTTPProxyCommand() *cobra.Command {
+	var config string
+	cmd := &cobra.Command{
+		Use:    "proxy",
+		Short:  "serve the redirected HTTP traffic until being killed",
+		Hidden: true,
+
+		Run: func(*cobra.Command, []string) {
+			options := core.NewHTTPCommand()
+			if err := json.Unmarshal([]byte(config), options); err != nil {
+				utils.ExitWithError(utils.ExitBadArgs, err)
+			}
+
+			conf, err := httpproxy.NewConfig(options, chaosd.HTTPProxyMark)
+			if err != nil {
+				utils.ExitWithError(utils.ExitBadArgs, err)
+			}
+
+			// the port is reported to chaosd after it's bound, so it's never taken by others in between
+			listener, err := net.Listen("tcp", conf.Listen)
+			if err != nil {
+				utils.ExitWithError(utils.ExitError, err)
+			}
+			chaosd.NotifyReady(strconv.Itoa(listener.Addr().(*net.TCPAddr).Port))
+
+			if err := httpproxy.NewProxy(*conf).Serve(listener); err != nil {
+				utils.ExitWithError(utils.ExitError, err)
+			}
+		},
+	}
+
+	cmd.Flags().StringVarP(&config, "config", "", "", "the http attack in JSON")
+
+	return cmd
+}
+
+func httpAttackF(chaos *chaosd.Server, options *core.HTTPCommand) {
+	if err := options.Validate(); err != nil {
+		utils.ExitWithError(utils.ExitBadArgs, err)
+	}
+
+	uid, err := chaos.ExecuteAttack(chaosd.HTTPAttack, options, core.CommandMode)
+	if err != nil {
+		utils.ExitWithError(utils.ExitError, err)
+	}
+
+	utils.NormalExit(fmt.Sprintf("Attack http successfully, uid: %s", uid))
+}
@@ -15,42 +15,67 @@ package attack
 
 import (
 	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/spf13/cobra"
 	"go.uber.org/fx"
 
 	"github.com/chaos-mesh/chaosd/cmd/server"
 	"github.com/chaos-mesh/chaosd/pkg/core"
+	"github.com/chaos-mesh/chaosd/pkg/fakedns"
+	"github.com/chaos-mesh/chaosd/pkg/netflap"
+	"github.com/chaos-mesh/chaosd/pkg/portoccupier"
 	"github.com/chaos-mesh/chaosd/pkg/server/chaosd"
 	"github.com/chaos-mesh/chaosd/pkg/utils"
 )
 
 func NewNetworkAttackCommand() *cobra.Command {
-	options := core.NewNetworkCommand()
-	dep := fx.Options(
-		server.Module,
-		fx.Provide(func() *core.NetworkCommand {
-			return options
-		}),
-	)
-
 	cmd := &cobra.Command{
 		Use:   "network <subcommand>",
 		Short: "Network attack related commands",
 	}
 
 	cmd.AddCommand(
-		NewNetworkDelayCommand(dep, options),
-		NewNetworkLossCommand(dep, options),
-		NewNetworkCorruptCommand(dep, options),
-		NetworkDuplicateCommand(dep, options),
-		NetworkDNSCommand(dep, options),
-		NewNetworkPortOccupiedCommand(dep, options),
+		newNetworkSubcommand(NewNetworkDelayCommand),
+		newNetworkSubcommand(NewNetworkLossCommand),
+		newNetworkSubcommand(NewNetworkCorruptCommand),
+		newNetworkSubcommand(NetworkDuplicateCommand),
+		newNetworkSubcommand(NewNetworkBandwidthCommand),
+		newNetworkSubcommand(NewNetworkReorderCommand),
+		newNetworkSubcommand(NewNetworkNetemCommand),
+		newNetworkSubcommand(NewNetworkPartitionCommand),
+		newNetworkSubcommand(NewNetworkRejectCommand),
+		newNetworkSubcommand(NewNetworkPacketCommand),
+		newNetworkSubcommand(NetworkDNSCommand),
+		NewNetworkDNSServerCommand(),
+		newNetworkSubcommand(NewNetworkPortOccupiedCommand),
+		NewNetworkPortOccupierCommand(),
+		newNetworkSubcommand(NewNetworkFlapCommand),
+		NewNetworkFlapperCommand(),
 	)
 
 	return cmd
 }
 
+// newNetworkSubcommand creates the subcommand with its own options. The flags write their
+// defaults into the options when they are registered, so the subcommands can't share them.
+func newNetworkSubcommand(newCommand func(fx.Option, *core.NetworkCommand) *cobra.Command) *cobra.Command {
+	options := core.NewNetworkCommand()
+	dep := fx.Options(
+		server.Module,
+		fx.Provide(func() *core.NetworkCommand {
+			return options
+		}),
+	)
+
+	return newCommand(dep, options)
+}
+
 func NewNetworkDelayCommand(dep fx.Option, options *core.NetworkCommand) *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "delay",
@@ -68,7 +93,22 @@ func NewNetworkDelayCommand(dep fx.Option, options *core.NetworkCommand) *cobra.
 	cmd.Flags().StringVarP(&options.Jitter, "jitter", "j", "",
 		"jitter time, time units: ns, us (or µs), ms, s, m, h.")
 	cmd.Flags().StringVarP(&options.Correlation, "correlation", "c", "0", "correlation is percentage (10 is 10%)")
-	cmd.Flags().StringVarP(&options.Device, "device", "d", "", "the network interface to impact")
+	cmd.Flags().StringVarP(&options.Distribution, "distribution", "", "",
+		"the distribution of jitter, supported: normal, pareto, paretonormal, uniform. It requires the jitter")
+	cmd.Flags().StringVarP(&options.DelayRate, "rate", "r", "",
+		"limit the rate of packets, such as 1mbps. Allows bps, kbps, mbps, gbps, tbps unit. bps means bytes per second")
+	cmd.Flags().IntVarP(&options.PacketOverhead, "packet-overhead", "", 0,
+		"the bytes added to every packet when the rate is calculated, it may be negative")
+	cmd.Flags().StringVarP(&options.Slot, "slot", "", "",
+		"send the packets in bursts every slot, such as 10ms, time units: ns, us (or µs), ms, s, m, h.")
+	cmd.Flags().StringVarP(&options.SlotMax, "slot-max", "", "",
+		"the slot is random between the slot and slot max if it is set")
+	cmd.Flags().IntVarP(&options.SlotPackets, "slot-packets", "", 0, "the max packets sent in one slot")
+	cmd.Flags().IntVarP(&options.SlotBytes, "slot-bytes", "", 0, "the max bytes sent in one slot")
+	cmd.Flags().StringVarP(&options.Device, "device", "d", "", "the network interfaces to impact, separated by comma, or all-non-loopback to impact all the interfaces except loopback")
+	cmd.Flags().StringVarP(&options.Direction, "direction", "", core.NetworkDirectionEgress,
+		"the direction of traffic to impact, supported: egress, ingress, both. "+
+			"The ingress traffic is redirected to an ifb device, it can't be filtered by protocol or ports")
 	cmd.Flags().StringVarP(&options.EgressPort, "egress-port", "e", "",
 		"only impact egress traffic to these destination ports, use a ',' to separate or to indicate the range, such as 80, 8001:8010. "+
 			"It can only be used in conjunction with -p tcp or -p udp")
@@ -79,6 +119,11 @@ func NewNetworkDelayCommand(dep fx.Option, options *core.NetworkCommand) *cobra.
 	cmd.Flags().StringVarP(&options.Hostname, "hostname", "H", "", "only impact traffic to these hostnames")
 	cmd.Flags().StringVarP(&options.IPProtocol, "protocol", "p", "",
 		"only impact traffic using this IP protocol, supported: tcp, udp, icmp, all")
+	cmd.Flags().StringVarP(&options.ContainerID, "container-id", "", "",
+		"the id of container whose network namespace is attacked, such as docker://xxx or containerd://xxx")
+	cmd.Flags().IntVarP(&options.Pid, "pid", "", 0, "only impact egress traffic sent by the cgroup of this process")
+	cmd.Flags().StringVarP(&options.Cgroup, "cgroup", "", "",
+		"only impact egress traffic sent by this cgroup v2, such as /system.slice/nginx.service")
 
 	return cmd
 }
@@ -97,7 +142,15 @@ func NewNetworkLossCommand(dep fx.Option, options *core.NetworkCommand) *cobra.C
 
 	cmd.Flags().StringVar(&options.Percent, "percent", "1", "percentage of packets to drop (10 is 10%)")
 	cmd.Flags().StringVarP(&options.Correlation, "correlation", "c", "0", "correlation is percentage (10 is 10%)")
-	cmd.Flags().StringVarP(&options.Device, "device", "d", "", "the network interface to impact")
+	cmd.Flags().StringVarP(&options.LossModel, "model", "m", "",
+		"drop packets by the model of bursty loss instead of the percent, supported: state, gemodel")
+	cmd.Flags().StringVarP(&options.LossProbabilities, "probabilities", "", "",
+		"the percentages of the loss model separated by comma, they are p13,p31,p32,p23,p14 of the state model "+
+			"or p,r,1-h,1-k of the gemodel, the omitted ones are set by netem")
+	cmd.Flags().StringVarP(&options.Device, "device", "d", "", "the network interfaces to impact, separated by comma, or all-non-loopback to impact all the interfaces except loopback")
+	cmd.Flags().StringVarP(&options.Direction, "direction", "", core.NetworkDirectionEgress,
+		"the direction of traffic to impact, supported: egress, ingress, both. "+
+			"The ingress traffic is redirected to an ifb device, it can't be filtered by protocol or ports")
 	cmd.Flags().StringVarP(&options.EgressPort, "egress-port", "e", "",
 		"only impact egress traffic to these destination ports, use a ',' to separate or to indicate the range, such as 80, 8001:8010. "+
 			"It can only be used in conjunction with -p tcp or -p udp")
@@ -108,6 +161,11 @@ func NewNetworkLossCommand(dep fx.Option, options *core.NetworkCommand) *cobra.C
 	cmd.Flags().StringVarP(&options.Hostname, "hostname", "H", "", "only impact traffic to these hostnames")
 	cmd.Flags().StringVarP(&options.IPProtocol, "protocol", "p", "",
 		"only impact traffic using this IP protocol, supported: tcp, udp, icmp, all")
+	cmd.Flags().StringVarP(&options.ContainerID, "container-id", "", "",
+		"the id of container whose network namespace is attacked, such as docker://xxx or containerd://xxx")
+	cmd.Flags().IntVarP(&options.Pid, "pid", "", 0, "only impact egress traffic sent by the cgroup of this process")
+	cmd.Flags().StringVarP(&options.Cgroup, "cgroup", "", "",
+		"only impact egress traffic sent by this cgroup v2, such as /system.slice/nginx.service")
 
 	return cmd
 }
@@ -126,7 +184,10 @@ func NewNetworkCorruptCommand(dep fx.Option, options *core.NetworkCommand) *cobr
 
 	cmd.Flags().StringVar(&options.Percent, "percent", "1", "percentage of packets to corrupt (10 is 10%)")
 	cmd.Flags().StringVarP(&options.Correlation, "correlation", "c", "0", "correlation is percentage (10 is 10%)")
-	cmd.Flags().StringVarP(&options.Device, "device", "d", "", "the network interface to impact")
+	cmd.Flags().StringVarP(&options.Device, "device", "d", "", "the network interfaces to impact, separated by comma, or all-non-loopback to impact all the interfaces except loopback")
+	cmd.Flags().StringVarP(&options.Direction, "direction", "", core.NetworkDirectionEgress,
+		"the direction of traffic to impact, supported: egress, ingress, both. "+
+			"The ingress traffic is redirected to an ifb device, it can't be filtered by protocol or ports")
 	cmd.Flags().StringVarP(&options.EgressPort, "egress-port", "e", "",
 		"only impact egress traffic to these destination ports, use a ',' to separate or to indicate the range, such as 80, 8001:8010. "+
 			"It can only be used in conjunction with -p tcp or -p udp")
@@ -137,6 +198,11 @@ func NewNetworkCorruptCommand(dep fx.Option, options *core.NetworkCommand) *cobr
 	cmd.Flags().StringVarP(&options.Hostname, "hostname", "H", "", "only impact traffic to these hostnames")
 	cmd.Flags().StringVarP(&options.IPProtocol, "protocol", "p", "",
 		"only impact traffic using this IP protocol, supported: tcp, udp, icmp, all")
+	cmd.Flags().StringVarP(&options.ContainerID, "container-id", "", "",
+		"the id of container whose network namespace is attacked, such as docker://xxx or containerd://xxx")
+	cmd.Flags().IntVarP(&options.Pid, "pid", "", 0, "only impact egress traffic sent by the cgroup of this process")
+	cmd.Flags().StringVarP(&options.Cgroup, "cgroup", "", "",
+		"only impact egress traffic sent by this cgroup v2, such as /system.slice/nginx.service")
 
 	return cmd
 }
@@ -155,7 +221,55 @@ func NetworkDuplicateCommand(dep fx.Option, options *core.NetworkCommand) *cobra
 
 	cmd.Flags().StringVar(&options.Percent, "percent", "1", "percentage of packets to corrupt (10 is 10%)")
 	cmd.Flags().StringVarP(&options.Correlation, "correlation", "c", "0", "correlation is percentage (10 is 10%)")
-	cmd.Flags().StringVarP(&options.Device, "device", "d", "", "the network interface to impact")
+	cmd.Flags().StringVarP(&options.Device, "device", "d", "", "the network interfaces to impact, separated by comma, or all-non-loopback to impact all the interfaces except loopback")
+	cmd.Flags().StringVarP(&options.Direction, "direction", "", core.NetworkDirectionEgress,
+		"the direction of traffic to impact, supported: egress, ingress, both. "+
+			"The ingress traffic is redirected to an ifb device, it can't be filtered by protocol or ports")
+	cmd.Flags().StringVarP(&options.EgressPort, "egress-port", "e", "",
+		"only impact egress traffic to these destination ports, use a ',' to separate or to indicate the range, such as 80, 8001:8010. "+
+			"It can only be used in conjunction with -p tcp or -p udp")
+	cmd.Flags().StringVarP(&options.SourcePort, "source-port", "s", "",
+		"only impact egress traffic from these source ports, use a ',' to separate or to indicate the range, such as 80, 8001:8010. "+
+			"It can only be used in conjunction with -p tcp or -p udp")
+	cmd.Flags().StringVarP(&options.IPAddress, "ip", "i", "", "only impact egress traffic to these IP addresses")
+	cmd.Flags().StringVarP(&options.Hostname, "hostname", "H", "", "only impact traffic to these hostnames")
+	cmd.Flags().StringVarP(&options.IPProtocol, "protocol", "p", "",
+		"only impact traffic using this IP protocol, supported: tcp, udp, icmp, all")
+	cmd.Flags().StringVarP(&options.ContainerID, "container-id", "", "",
+		"the id of container whose network namespace is attacked, such as docker://xxx or containerd://xxx")
+	cmd.Flags().IntVarP(&options.Pid, "pid", "", 0, "only impact egress traffic sent by the cgroup of this process")
+	cmd.Flags().StringVarP(&options.Cgroup, "cgroup", "", "",
+		"only impact egress traffic sent by this cgroup v2, such as /system.slice/nginx.service")
+
+	return cmd
+}
+
+func NewNetworkBandwidthCommand(dep fx.Option, options *core.NetworkCommand) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "bandwidth",
+		Short: "limit network bandwidth",
+
+		Run: func(*cobra.Command, []string) {
+			options.Action = core.NetworkBandwidthAction
+			options.CompleteDefaults()
+			utils.FxNewAppWithoutLog(dep, fx.Invoke(commonNetworkAttackFunc)).Run()
+		},
+	}
+
+	cmd.Flags().StringVarP(&options.Rate, "rate", "r", "",
+		"the speed knob, allows bps, kbps, mbps, gbps, tbps unit. bps means bytes per second")
+	cmd.Flags().Uint32VarP(&options.Limit, "limit", "l", 0,
+		"the number of bytes that can be queued waiting for tokens to become available")
+	cmd.Flags().Uint32VarP(&options.Buffer, "buffer", "b", 0,
+		"the maximum amount of bytes that tokens can be available for instantaneously")
+	cmd.Flags().Uint64VarP(&options.Peakrate, "peakrate", "", 0,
+		"the maximum depletion rate of the bucket")
+	cmd.Flags().Uint32VarP(&options.Minburst, "minburst", "m", 0,
+		"specifies the size of the peakrate bucket")
+	cmd.Flags().StringVarP(&options.Device, "device", "d", "", "the network interfaces to impact, separated by comma, or all-non-loopback to impact all the interfaces except loopback")
+	cmd.Flags().StringVarP(&options.Direction, "direction", "", core.NetworkDirectionEgress,
+		"the direction of traffic to impact, supported: egress, ingress, both. "+
+			"The ingress traffic is redirected to an ifb device, it can't be filtered by protocol or ports")
 	cmd.Flags().StringVarP(&options.EgressPort, "egress-port", "e", "",
 		"only impact egress traffic to these destination ports, use a ',' to separate or to indicate the range, such as 80, 8001:8010. "+
 			"It can only be used in conjunction with -p tcp or -p udp")
@@ -166,6 +280,212 @@ func NetworkDuplicateCommand(dep fx.Option, options *core.NetworkCommand) *cobra
 	cmd.Flags().StringVarP(&options.Hostname, "hostname", "H", "", "only impact traffic to these hostnames")
 	cmd.Flags().StringVarP(&options.IPProtocol, "protocol", "p", "",
 		"only impact traffic using this IP protocol, supported: tcp, udp, icmp, all")
+	cmd.Flags().StringVarP(&options.ContainerID, "container-id", "", "",
+		"the id of container whose network namespace is attacked, such as docker://xxx or containerd://xxx")
+	cmd.Flags().IntVarP(&options.Pid, "pid", "", 0, "only impact egress traffic sent by the cgroup of this process")
+	cmd.Flags().StringVarP(&options.Cgroup, "cgroup", "", "",
+		"only impact egress traffic sent by this cgroup v2, such as /system.slice/nginx.service")
+
+	return cmd
+}
+
+func NewNetworkReorderCommand(dep fx.Option, options *core.NetworkCommand) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "reorder",
+		Short: "reorder network packets",
+
+		Run: func(*cobra.Command, []string) {
+			options.Action = core.NetworkReorderAction
+			options.CompleteDefaults()
+			utils.FxNewAppWithoutLog(dep, fx.Invoke(commonNetworkAttackFunc)).Run()
+		},
+	}
+
+	cmd.Flags().StringVarP(&options.Latency, "latency", "l", "",
+		"delay egress time of the packets which are not reordered, time units: ns, us (or µs), ms, s, m, h.")
+	cmd.Flags().StringVarP(&options.Jitter, "jitter", "j", "",
+		"jitter time, time units: ns, us (or µs), ms, s, m, h.")
+	cmd.Flags().StringVar(&options.Percent, "percent", "1", "percentage of packets to reorder (10 is 10%)")
+	cmd.Flags().StringVarP(&options.Correlation, "correlation", "c", "0", "correlation is percentage (10 is 10%)")
+	cmd.Flags().IntVarP(&options.Gap, "gap", "g", 0,
+		"only reorder every gap-th packet, 0 means any packet can be reordered")
+	cmd.Flags().StringVarP(&options.Device, "device", "d", "", "the network interfaces to impact, separated by comma, or all-non-loopback to impact all the interfaces except loopback")
+	cmd.Flags().StringVarP(&options.Direction, "direction", "", core.NetworkDirectionEgress,
+		"the direction of traffic to impact, supported: egress, ingress, both. "+
+			"The ingress traffic is redirected to an ifb device, it can't be filtered by protocol or ports")
+	cmd.Flags().StringVarP(&options.EgressPort, "egress-port", "e", "",
+		"only impact egress traffic to these destination ports, use a ',' to separate or to indicate the range, such as 80, 8001:8010. "+
+			"It can only be used in conjunction with -p tcp or -p udp")
+	cmd.Flags().StringVarP(&options.SourcePort, "source-port", "s", "",
+		"only impact egress traffic from these source ports, use a ',' to separate or to indicate the range, such as 80, 8001:8010. "+
+			"It can only be used in conjunction with -p tcp or -p udp")
+	cmd.Flags().StringVarP(&options.IPAddress, "ip", "i", "", "only impact egress traffic to these IP addresses")
+	cmd.Flags().StringVarP(&options.Hostname, "hostname", "H", "", "only impact traffic to these hostnames")
+	cmd.Flags().StringVarP(&options.IPProtocol, "protocol", "p", "",
+		"only impact traffic using this IP protocol, supported: tcp, udp, icmp, all")
+	cmd.Flags().StringVarP(&options.ContainerID, "container-id", "", "",
+		"the id of container whose network namespace is attacked, such as docker://xxx or containerd://xxx")
+	cmd.Flags().IntVarP(&options.Pid, "pid", "", 0, "only impact egress traffic sent by the cgroup of this process")
+	cmd.Flags().StringVarP(&options.Cgroup, "cgroup", "", "",
+		"only impact egress traffic sent by this cgroup v2, such as /system.slice/nginx.service")
+
+	return cmd
+}
+
+func NewNetworkNetemCommand(dep fx.Option, options *core.NetworkCommand) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "netem",
+		Short: "combine delay, loss, corrupt, duplicate and reorder of network in one attack",
+
+		Run: func(*cobra.Command, []string) {
+			options.Action = core.NetworkNetemAction
+			options.CompleteDefaults()
+			utils.FxNewAppWithoutLog(dep, fx.Invoke(commonNetworkAttackFunc)).Run()
+		},
+	}
+
+	cmd.Flags().StringVarP(&options.Latency, "latency", "l", "",
+		"delay egress time, time units: ns, us (or µs), ms, s, m, h.")
+	cmd.Flags().StringVarP(&options.Jitter, "jitter", "j", "",
+		"jitter time, time units: ns, us (or µs), ms, s, m, h.")
+	cmd.Flags().StringVar(&options.Loss, "loss", "", "percentage of packets to drop (10 is 10%)")
+	cmd.Flags().StringVar(&options.Corrupt, "corrupt", "", "percentage of packets to corrupt (10 is 10%)")
+	cmd.Flags().StringVar(&options.Duplicate, "duplicate", "", "percentage of packets to duplicate (10 is 10%)")
+	cmd.Flags().StringVar(&options.Reorder, "reorder", "",
+		"percentage of packets to reorder (10 is 10%), it can only be used in conjunction with --latency")
+	cmd.Flags().IntVarP(&options.Gap, "gap", "g", 0,
+		"only reorder every gap-th packet, 0 means any packet can be reordered")
+	cmd.Flags().StringVarP(&options.Correlation, "correlation", "c", "0",
+		"correlation of every network emulation, correlation is percentage (10 is 10%)")
+	cmd.Flags().StringVarP(&options.Device, "device", "d", "", "the network interfaces to impact, separated by comma, or all-non-loopback to impact all the interfaces except loopback")
+	cmd.Flags().StringVarP(&options.Direction, "direction", "", core.NetworkDirectionEgress,
+		"the direction of traffic to impact, supported: egress, ingress, both. "+
+			"The ingress traffic is redirected to an ifb device, it can't be filtered by protocol or ports")
+	cmd.Flags().StringVarP(&options.EgressPort, "egress-port", "e", "",
+		"only impact egress traffic to these destination ports, use a ',' to separate or to indicate the range, such as 80, 8001:8010. "+
+			"It can only be used in conjunction with -p tcp or -p udp")
+	cmd.Flags().StringVarP(&options.SourcePort, "source-port", "s", "",
+		"only impact egress traffic from these source ports, use a ',' to separate or to indicate the range, such as 80, 8001:8010. "+
+			"It can only be used in conjunction with -p tcp or -p udp")
+	cmd.Flags().StringVarP(&options.IPAddress, "ip", "i", "", "only impact egress traffic to these IP addresses")
+	cmd.Flags().StringVarP(&options.Hostname, "hostname", "H", "", "only impact traffic to these hostnames")
+	cmd.Flags().StringVarP(&options.IPProtocol, "protocol", "p", "",
+		"only impact traffic using this IP protocol, supported: tcp, udp, icmp, all")
+	cmd.Flags().StringVarP(&options.ContainerID, "container-id", "", "",
+		"the id of container whose network namespace is attacked, such as docker://xxx or containerd://xxx")
+	cmd.Flags().IntVarP(&options.Pid, "pid", "", 0, "only impact egress traffic sent by the cgroup of this process")
+	cmd.Flags().StringVarP(&options.Cgroup, "cgroup", "", "",
+		"only impact egress traffic sent by this cgroup v2, such as /system.slice/nginx.service")
+
+	return cmd
+}
+
+func NewNetworkPartitionCommand(dep fx.Option, options *core.NetworkCommand) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "partition",
+		Short: "partition network",
+
+		Run: func(*cobra.Command, []string) {
+			options.Action = core.NetworkPartitionAction
+			options.CompleteDefaults()
+			utils.FxNewAppWithoutLog(dep, fx.Invoke(commonNetworkAttackFunc)).Run()
+		},
+	}
+
+	cmd.Flags().StringVarP(&options.Direction, "direction", "", core.NetworkDirectionBoth,
+		"specifies the direction of traffic to drop, supported: ingress, egress, both")
+	cmd.Flags().StringVarP(&options.EgressPort, "egress-port", "e", "",
+		"only drop traffic to these destination ports, use a ',' to separate or to indicate the range, such as 80, 8001:8010. "+
+			"It can only be used in conjunction with -p tcp or -p udp")
+	cmd.Flags().StringVarP(&options.SourcePort, "source-port", "s", "",
+		"only drop traffic from these source ports, use a ',' to separate or to indicate the range, such as 80, 8001:8010. "+
+			"It can only be used in conjunction with -p tcp or -p udp")
+	cmd.Flags().StringVarP(&options.IPAddress, "ip", "i", "", "drop traffic between these IP addresses")
+	cmd.Flags().StringVarP(&options.Hostname, "hostname", "H", "", "drop traffic between these hostnames")
+	cmd.Flags().StringVarP(&options.IPProtocol, "protocol", "p", "",
+		"only drop traffic using this IP protocol, supported: tcp, udp, icmp, all")
+	cmd.Flags().StringVarP(&options.ContainerID, "container-id", "", "",
+		"the id of container whose network namespace is attacked, such as docker://xxx or containerd://xxx")
+
+	return cmd
+}
+
+func NewNetworkRejectCommand(dep fx.Option, options *core.NetworkCommand) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "reject",
+		Short: "reject network packets with TCP reset or ICMP unreachable",
+
+		Run: func(*cobra.Command, []string) {
+			options.Action = core.NetworkRejectAction
+			options.CompleteDefaults()
+			utils.FxNewAppWithoutLog(dep, fx.Invoke(commonNetworkAttackFunc)).Run()
+		},
+	}
+
+	cmd.Flags().StringVarP(&options.RejectWith, "reject-with", "", "",
+		"the packet sent back to reject the traffic, supported: tcp-reset, icmp-port-unreachable, icmp-host-unreachable. "+
+			"It's tcp-reset by default if the protocol is tcp, otherwise icmp-port-unreachable")
+	cmd.Flags().StringVarP(&options.Percent, "percent", "", "100", "percentage of packets to reject (10 is 10%)")
+	cmd.Flags().StringVarP(&options.Direction, "direction", "", core.NetworkDirectionEgress,
+		"specifies the direction of traffic to reject, supported: ingress, egress, both")
+	cmd.Flags().StringVarP(&options.EgressPort, "egress-port", "e", "",
+		"only reject traffic to these destination ports, use a ',' to separate or to indicate the range, such as 80, 8001:8010. "+
+			"It can only be used in conjunction with -p tcp or -p udp")
+	cmd.Flags().StringVarP(&options.SourcePort, "source-port", "s", "",
+		"only reject traffic from these source ports, use a ',' to separate or to indicate the range, such as 80, 8001:8010. "+
+			"It can only be used in conjunction with -p tcp or -p udp")
+	cmd.Flags().StringVarP(&options.IPAddress, "ip", "i", "", "reject traffic between these IP addresses")
+	cmd.Flags().StringVarP(&options.Hostname, "hostname", "H", "", "reject traffic between these hostnames")
+	cmd.Flags().StringVarP(&options.IPProtocol, "protocol", "p", "",
+		"only reject traffic using this IP protocol, supported: tcp, udp, icmp, all")
+	cmd.Flags().StringVarP(&options.ContainerID, "container-id", "", "",
+		"the id of container whose network namespace is attacked, such as docker://xxx or containerd://xxx")
+
+	return cmd
+}
+
+func NewNetworkPacketCommand(dep fx.Option, options *core.NetworkCommand) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "packet",
+		Short: "drop or delay network packets selected by TCP flags or connection state",
+
+		Run: func(*cobra.Command, []string) {
+			options.Action = core.NetworkPacketAction
+			options.CompleteDefaults()
+			utils.FxNewAppWithoutLog(dep, fx.Invoke(commonNetworkAttackFunc)).Run()
+		},
+	}
+
+	cmd.Flags().StringVarP(&options.TCPFlags, "tcp-flags", "", "",
+		"only impact the TCP packets with these flags, supported: syn, fin, rst, use a ',' to separate. "+
+			"syn only impacts the packets starting new connections")
+	cmd.Flags().StringVarP(&options.ConnState, "conn-state", "", "",
+		"only impact the packets in these connection states of conntrack, supported: NEW, ESTABLISHED, RELATED, INVALID, UNTRACKED, "+
+			"use a ',' to separate")
+	cmd.Flags().StringVarP(&options.PacketFault, "fault", "f", core.PacketFaultDrop,
+		"the fault of the selected packets, supported: drop, delay")
+	cmd.Flags().StringVarP(&options.Percent, "percent", "", "100", "percentage of packets to drop (10 is 10%)")
+	cmd.Flags().StringVarP(&options.Latency, "latency", "l", "",
+		"delay egress time of the delay fault, time units: ns, us (or µs), ms, s, m, h.")
+	cmd.Flags().StringVarP(&options.Jitter, "jitter", "j", "",
+		"jitter time, time units: ns, us (or µs), ms, s, m, h.")
+	cmd.Flags().StringVarP(&options.Correlation, "correlation", "c", "0", "correlation is percentage (10 is 10%)")
+	cmd.Flags().StringVarP(&options.Device, "device", "d", "",
+		"the network interfaces to delay the packets, separated by comma, or all-non-loopback to impact all the interfaces except loopback")
+	cmd.Flags().StringVarP(&options.Direction, "direction", "", core.NetworkDirectionEgress,
+		"specifies the direction of packets to drop, supported: ingress, egress, both. Only egress packets can be delayed")
+	cmd.Flags().StringVarP(&options.EgressPort, "egress-port", "e", "",
+		"only impact the packets to these destination ports, use a ',' to separate or to indicate the range, such as 80, 8001:8010. "+
+			"It can only be used in conjunction with -p tcp or -p udp")
+	cmd.Flags().StringVarP(&options.SourcePort, "source-port", "s", "",
+		"only impact the packets from these source ports, use a ',' to separate or to indicate the range, such as 80, 8001:8010. "+
+			"It can only be used in conjunction with -p tcp or -p udp")
+	cmd.Flags().StringVarP(&options.IPAddress, "ip", "i", "", "only impact the packets between these IP addresses")
+	cmd.Flags().StringVarP(&options.Hostname, "hostname", "H", "", "only impact the packets between these hostnames")
+	cmd.Flags().StringVarP(&options.IPProtocol, "protocol", "p", "",
+		"only impact the packets using this IP protocol, supported: tcp, udp, icmp, all. It's tcp by default if tcp-flags is set")
+	cmd.Flags().StringVarP(&options.ContainerID, "container-id", "", "",
+		"the id of container whose network namespace is attacked, such as docker://xxx or containerd://xxx")
 
 	return cmd
 }
@@ -182,10 +502,56 @@ func NetworkDNSCommand(dep fx.Option, options *core.NetworkCommand) *cobra.Comma
 		},
 	}
 
-	cmd.Flags().StringVarP(&options.DNSServer, "dns-server", "", "123.123.123.123",
-		"update the DNS server in /etc/resolv.conf with this value")
-	cmd.Flags().StringVarP(&options.DNSHost, "dns-hostname", "H", "", "map this host to specified IP")
-	cmd.Flags().StringVarP(&options.DNSIp, "dns-ip", "i", "", "map specified host to this IP address")
+	cmd.Flags().StringVarP(&options.DNSServer, "dns-server", "", "",
+		"update the DNS server in /etc/resolv.conf with this value, "+
+			"it's 123.123.123.123 by default, or 127.0.0.1 which the fake DNS server listens on if dns-fault is set")
+	cmd.Flags().StringVarP(&options.DNSHost, "dns-hostname", "H", "",
+		"map these hosts to specified IP addresses by order in /etc/hosts, separated by comma")
+	cmd.Flags().StringVarP(&options.DNSIp, "dns-ip", "i", "",
+		"map specified hosts to these IPv4 or IPv6 addresses by order, separated by comma")
+	cmd.Flags().StringVarP(&options.DNSFault, "dns-fault", "", "",
+		"start a fake DNS server answering the queries with this fault, supported: nxdomain, servfail, random, wrong, slow, truncate")
+	cmd.Flags().StringVarP(&options.DNSPatterns, "dns-patterns", "", "",
+		"only the queries of domains matching these patterns are impacted by the fault, such as *.example.com, separated by comma")
+	cmd.Flags().StringVarP(&options.DNSAnswer, "dns-answer", "", "", "the IP address answered by the wrong fault")
+	cmd.Flags().StringVarP(&options.DNSDelay, "dns-delay", "", "", "the delay of the slow fault, 1s by default")
+	cmd.Flags().StringVarP(&options.DNSUpstream, "dns-upstream", "", "",
+		"the DNS server which other queries are sent to, it's the nameserver in /etc/resolv.conf by default")
+
+	return cmd
+}
+
+// NewNetworkDNSServerCommand returns the command run in background by the DNS attack,
+// which serves as the fake DNS server until it is killed.
+func NewNetworkDNSServerCommand() *cobra.Command {
+	var (
+		conf     fakedns.Config
+		patterns string
+		answer   string
+	)
+	cmd := &cobra.Command{
+		Use:    "dns-server",
+		Short:  "serve as the fake DNS server until being killed",
+		Hidden: true,
+
+		Run: func(cmd *cobra.Command, args []string) {
+			if len(patterns) > 0 {
+				conf.Patterns = strings.Split(patterns, ",")
+			}
+			conf.Answer = net.ParseIP(answer)
+
+			if err := fakedns.NewServer(conf).ListenAndServe(); err != nil {
+				utils.ExitWithError(utils.ExitError, err)
+			}
+		},
+	}
+
+	cmd.Flags().StringVarP(&conf.Listen, "listen", "", "127.0.0.1:53", "the UDP address to listen on")
+	cmd.Flags().StringVarP(&conf.Upstream, "upstream", "", "", "the address of the real DNS server")
+	cmd.Flags().StringVarP(&patterns, "patterns", "", "", "the domain patterns to impact, separated by comma")
+	cmd.Flags().StringVarP(&conf.Fault, "fault", "", "", "the fault of the queries matching the patterns")
+	cmd.Flags().StringVarP(&answer, "answer", "", "", "the address answered by the wrong fault")
+	cmd.Flags().DurationVarP(&conf.Delay, "delay", "", time.Second, "the delay of the slow fault")
 
 	return cmd
 }
@@ -215,6 +581,97 @@ func NewNetworkPortOccupiedCommand(dep fx.Option, options *core.NetworkCommand)
 		},
 	}
 
-	cmd.Flags().StringVarP(&options.Port, "port", "p", "", "this specified port is to occupied")
+	cmd.Flags().StringVarP(&options.Port, "port", "p", "",
+		"the ports to occupy, separated by comma, the port range looks like 8080:8090")
+	cmd.Flags().StringVarP(&options.IPProtocol, "protocol", "", portoccupier.ProtocolTCP,
+		"the protocol of ports to occupy, supported: tcp, udp, all")
+	cmd.Flags().StringVarP(&options.PortOccupyMode, "mode", "", core.PortOccupyModeAccept,
+		"the mode of occupying ports, supported: accept (listen and accept connections), "+
+			"listen (listen but never accept connections), bind (only bind the ports)")
+
+	return cmd
+}
+
+// NewNetworkPortOccupierCommand returns the command run in background by the port
+// occupied attack, which occupies the ports until it is killed.
+func NewNetworkPortOccupierCommand() *cobra.Command {
+	options := core.NewNetworkCommand()
+	cmd := &cobra.Command{
+		Use:    "port-occupier",
+		Short:  "occupy network ports until being killed",
+		Hidden: true,
+
+		Run: func(cmd *cobra.Command, args []string) {
+			ports, err := utils.ParsePorts(options.Port)
+			if err != nil {
+				utils.ExitWithError(utils.ExitBadArgs, err)
+			}
+
+			if _, err := portoccupier.Occupy(ports, options.OccupiedProtocols(), options.PortOccupyMode); err != nil {
+				utils.ExitWithError(utils.ExitError, err)
+			}
+			chaosd.NotifyReady("")
+
+			sig := make(chan os.Signal, 1)
+			signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+			<-sig
+		},
+	}
+
+	cmd.Flags().StringVarP(&options.Port, "port", "p", "", "the ports to occupy")
+	cmd.Flags().StringVarP(&options.IPProtocol, "protocol", "", portoccupier.ProtocolTCP, "the protocol of ports to occupy")
+	cmd.Flags().StringVarP(&options.PortOccupyMode, "mode", "", core.PortOccupyModeAccept, "the mode of occupying ports")
+
+	return cmd
+}
+
+func NewNetworkFlapCommand(dep fx.Option, options *core.NetworkCommand) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "flap",
+		Short: "bring network device down and up by turns, or keep it down",
+
+		Run: func(cmd *cobra.Command, args []string) {
+			options.Action = core.NetworkFlapAction
+			options.CompleteDefaults()
+			utils.FxNewAppWithoutLog(dep, fx.Invoke(commonNetworkAttackFunc)).Run()
+		},
+	}
+
+	cmd.Flags().StringVarP(&options.Device, "device", "d", "", "the network interface to impact")
+	cmd.Flags().StringVarP(&options.FlapDownTime, "down-time", "", "",
+		"the time the device is down in each cycle, the device is kept down until recovered if it's empty, "+
+			"time units: ns, us (or µs), ms, s, m, h.")
+	cmd.Flags().StringVarP(&options.FlapUpTime, "up-time", "", "",
+		"the time the device is up in each cycle, time units: ns, us (or µs), ms, s, m, h.")
+
+	return cmd
+}
+
+// NewNetworkFlapperCommand returns the command run in background by the flap attack,
+// which brings the device down and up by turns until it is killed.
+func NewNetworkFlapperCommand() *cobra.Command {
+	var device string
+	var down, up time.Duration
+	cmd := &cobra.Command{
+		Use:    "flapper",
+		Short:  "bring network device down and up by turns until being killed",
+		Hidden: true,
+
+		Run: func(cmd *cobra.Command, args []string) {
+			state, err := netflap.GetLinkState(device)
+			if err != nil {
+				utils.ExitWithError(utils.ExitError, err)
+			}
+
+			if err := netflap.Flap(state, device, down, up); err != nil {
+				utils.ExitWithError(utils.ExitError, err)
+			}
+		},
+	}
+
+	cmd.Flags().StringVarP(&device, "device", "d", "", "the network interface to flap")
+	cmd.Flags().DurationVarP(&down, "down-time", "", time.Second, "the time the device is down in each cycle")
+	cmd.Flags().DurationVarP(&up, "up-time", "", time.Second, "the time the device is up in each cycle")
+
 	return cmd
 }
@@ -0,0 +1,155 @@
+// Copyright 2021 Chaos Mesh Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package attack
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/fx"
+	"go.uber.org/fx/fxtest"
+
+	"github.com/chaos-mesh/chaosd/cmd/server"
+	"github.com/chaos-mesh/chaosd/pkg/core"
+	"github.com/chaos-mesh/chaosd/pkg/portoccupier"
+	"github.com/chaos-mesh/chaosd/pkg/server/chaosd"
+)
+
+// TestMain runs the hidden subcommands started in background by the attacks,
+// because the test binary is started as chaosd itself.
+func TestMain(m *testing.M) {
+	if len(os.Args) > 1 && os.Args[1] == "attack" {
+		cmd := &cobra.Command{Use: "chaosd"}
+		cmd.AddCommand(NewAttackCommand())
+		if err := cmd.Execute(); err != nil {
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
+	os.Exit(m.Run())
+}
+
+func freePort(t *testing.T) string {
+	listener, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	return strconv.Itoa(listener.Addr().(*net.TCPAddr).Port)
+}
+
+func portOccupiedCommand(port string, mode string) *core.NetworkCommand {
+	attack := core.NewNetworkCommand()
+	attack.Action = core.NetworkPortOccupied
+	attack.Port = port
+	attack.IPProtocol = portoccupier.ProtocolTCP
+	attack.PortOccupyMode = mode
+	attack.CompleteDefaults()
+
+	return attack
+}
+
+func TestServer_PortOccupied(t *testing.T) {
+	fxtest.New(
+		t,
+		server.Module,
+		fx.Invoke(func(s *chaosd.Server) {
+			for _, mode := range []string{core.PortOccupyModeBind, core.PortOccupyModeListen, core.PortOccupyModeAccept} {
+				t.Run(mode, func(t *testing.T) {
+					port := freePort(t)
+					uid, err := s.ExecuteAttack(chaosd.NetworkAttack, portOccupiedCommand(port, mode), core.CommandMode)
+					if !assert.NoError(t, err) {
+						return
+					}
+
+					_, err = net.Listen("tcp", ":"+port)
+					assert.Error(t, err)
+
+					assert.NoError(t, s.RecoverAttack(uid))
+
+					// the occupier is killed, and the port is released after it exits
+					assert.Eventually(t, func() bool {
+						listener, err := net.Listen("tcp", ":"+port)
+						if err != nil {
+							return false
+						}
+						listener.Close()
+						return true
+					}, time.Second, 10*time.Millisecond)
+				})
+			}
+
+			t.Run("occupied", func(t *testing.T) {
+				listener, err := net.Listen("tcp", ":0")
+				if !assert.NoError(t, err) {
+					return
+				}
+				defer listener.Close()
+
+				port := strconv.Itoa(listener.Addr().(*net.TCPAddr).Port)
+				_, err = s.ExecuteAttack(chaosd.NetworkAttack, portOccupiedCommand(port, core.PortOccupyModeBind), core.CommandMode)
+				if assert.Error(t, err) {
+					assert.Contains(t, err.Error(), "address already in use")
+				}
+			})
+		}),
+	)
+}
+
+// networkDefaults are the effective defaults of the flags of network subcommands, which are
+// checked through the whole command tree because the flags write their defaults when registered.
+var networkDefaults = []struct {
+	subcommand string
+	flag       string
+	value      string
+}{
+	{"delay", "direction", core.NetworkDirectionEgress},
+	{"loss", "direction", core.NetworkDirectionEgress},
+	{"netem", "direction", core.NetworkDirectionEgress},
+	{"partition", "direction", core.NetworkDirectionBoth},
+	{"reject", "direction", core.NetworkDirectionEgress},
+	{"delay", "protocol", ""},
+	{"loss", "protocol", ""},
+	{"partition", "protocol", ""},
+	{"port", "protocol", portoccupier.ProtocolTCP},
+	{"loss", "percent", "1"},
+	{"corrupt", "percent", "1"},
+	{"duplicate", "percent", "1"},
+	{"reorder", "percent", "1"},
+	{"reject", "percent", "100"},
+	{"packet", "percent", "100"},
+	{"packet", "direction", core.NetworkDirectionEgress},
+	{"packet", "fault", core.PacketFaultDrop},
+}
+
+func TestNetworkAttackCommand_Defaults(t *testing.T) {
+	cmd := NewNetworkAttackCommand()
+	for _, d := range networkDefaults {
+		subcommand, _, err := cmd.Find([]string{d.subcommand})
+		if !assert.NoError(t, err) {
+			continue
+		}
+
+		if assert.NoError(t, subcommand.ParseFlags(nil)) {
+			assert.Equal(t, d.value, subcommand.Flags().Lookup(d.flag).Value.String(), d.subcommand+" --"+d.flag)
+		}
+	}
+}
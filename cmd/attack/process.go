@@ -15,9 +15,12 @@ package attack
 
 import (
 	"fmt"
-
+	"os"
+	"strconv"
 	"syscall"
+	"time"
 
+	"github.com/olekukonko/tablewriter"
 	"github.com/spf13/cobra"
 	"go.uber.org/fx"
 
@@ -44,6 +47,8 @@ func NewProcessAttackCommand() *cobra.Command {
 	cmd.AddCommand(
 		NewProcessKillCommand(dep, options),
 		NewProcessStopCommand(dep, options),
+		NewProcessRestartCommand(dep, options),
+		NewProcessFreezeCommand(dep, options),
 	)
 
 	return cmd
@@ -59,8 +64,11 @@ func NewProcessKillCommand(dep fx.Option, options *core.ProcessCommand) *cobra.C
 		},
 	}
 
-	cmd.Flags().StringVarP(&options.Process, "process", "p", "", "The process name or the process ID")
-	cmd.Flags().IntVarP(&options.Signal, "signal", "s", 9, "The signal number to send")
+	options.Signal = core.Signal(syscall.SIGKILL)
+	cmd.Flags().VarP(&options.Signal, "signal", "s",
+		"The number or the name of signal to send, such as 1, SIGHUP or HUP")
+	setProcessSelectorFlags(cmd, options)
+	setKillChildrenFlags(cmd, options)
 
 	return cmd
 }
@@ -70,26 +78,149 @@ func NewProcessStopCommand(dep fx.Option, options *core.ProcessCommand) *cobra.C
 		Use:   "stop",
 		Short: "stop process, this action will stop the process with SIGSTOP",
 		Run: func(*cobra.Command, []string) {
-			options.Signal = int(syscall.SIGSTOP)
+			options.Signal = core.Signal(syscall.SIGSTOP)
 			options.Action = core.ProcessStopAction
 			utils.FxNewAppWithoutLog(dep, fx.Invoke(processAttackF)).Run()
 		},
 	}
 
-	cmd.Flags().StringVarP(&options.Process, "process", "p", "", "The process name or the process ID")
+	setProcessSelectorFlags(cmd, options)
+	setKillChildrenFlags(cmd, options)
+
+	return cmd
+}
+
+func NewProcessRestartCommand(dep fx.Option, options *core.ProcessCommand) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "restart",
+		Short: "kill process and observe the time it takes to come back",
+		Run: func(*cobra.Command, []string) {
+			options.Action = core.ProcessRestartAction
+			utils.FxNewAppWithoutLog(dep, fx.Invoke(processAttackF)).Run()
+		},
+	}
+
+	options.Signal = core.Signal(syscall.SIGKILL)
+	cmd.Flags().VarP(&options.Signal, "signal", "s",
+		"The number or the name of signal to kill the processes, such as 15, SIGTERM or TERM")
+	cmd.Flags().StringVar(&options.RestartTimeout, "timeout", core.DefaultRestartTimeout,
+		"The time to wait for the new processes matching the same selectors to come back")
+	cmd.Flags().StringVar(&options.ProbeTCP, "probe-tcp", "",
+		"The address to connect to after the processes come back, such as 127.0.0.1:80, they are ready once it's connected")
+	cmd.Flags().StringVar(&options.ProbeHTTP, "probe-http", "",
+		"The url to request after the processes come back, they are ready once it answers 2xx or 3xx")
+	setProcessSelectorFlags(cmd, options)
+	setKillChildrenFlags(cmd, options)
+
+	return cmd
+}
+
+func NewProcessFreezeCommand(dep fx.Option, options *core.ProcessCommand) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "freeze",
+		Short: "freeze the cgroup of process, all the processes and threads in the cgroup are frozen",
+		Run: func(*cobra.Command, []string) {
+			options.Action = core.ProcessFreezeAction
+			utils.FxNewAppWithoutLog(dep, fx.Invoke(processAttackF)).Run()
+		},
+	}
+
+	setProcessSelectorFlags(cmd, options)
 
 	return cmd
 }
 
+var previewProcess bool
+
+func setKillChildrenFlags(cmd *cobra.Command, options *core.ProcessCommand) {
+	cmd.Flags().BoolVar(&options.KillChildren, "kill-children", false,
+		"Send the signal to all the descendants of the processes too, the children are stopped before their parents and killed after them")
+	cmd.Flags().BoolVar(&options.KillChildren, "tree", false, "The alias of --kill-children")
+}
+
+func setProcessSelectorFlags(cmd *cobra.Command, options *core.ProcessCommand) {
+	cmd.Flags().StringVarP(&options.Process, "process", "p", "", "The process name or the process ID")
+	cmd.Flags().BoolVar(&options.Substring, "substring", false,
+		"Match the processes whose name contains the process, instead of the processes with the same name")
+	cmd.Flags().StringVar(&options.Cmdline, "cmdline", "", "The regular expression to match the full command line of processes")
+	cmd.Flags().StringVar(&options.User, "user", "", "The name or uid of the user owning the processes")
+	cmd.Flags().IntVar(&options.PPid, "ppid", 0, "The pid of the parent of the processes")
+	cmd.Flags().StringVar(&options.Cgroup, "cgroup", "",
+		"The cgroup v2 path of the processes, such as /system.slice/nginx.service, the processes in its child cgroups are matched too")
+	cmd.Flags().BoolVar(&options.Newest, "newest", false, "Only attack the newest processes of the matched ones")
+	cmd.Flags().BoolVar(&options.Oldest, "oldest", false, "Only attack the oldest processes of the matched ones")
+	cmd.Flags().IntVar(&options.Count, "count", 0,
+		"The number of processes to attack, they are picked at random unless newest or oldest is set. "+
+			"All the matched processes are attacked if it is 0, or only one if newest or oldest is set")
+	cmd.Flags().BoolVar(&options.AllowMany, "allow-many", false,
+		fmt.Sprintf("Allow attacking more than %d processes", core.MaxAttackedProcesses))
+	cmd.Flags().BoolVar(&previewProcess, "preview", false, "List the processes which would be attacked without attacking them")
+}
+
 func processAttackF(options *core.ProcessCommand, chaos *chaosd.Server) {
 	if err := options.Validate(); err != nil {
 		utils.ExitWithError(utils.ExitBadArgs, err)
 	}
 
+	if previewProcess {
+		previewProcessAttack(options, chaos)
+		return
+	}
+
 	uid, err := chaos.ExecuteAttack(chaosd.ProcessAttack, options, core.CommandMode)
 	if err != nil {
 		utils.ExitWithError(utils.ExitError, err)
 	}
 
-	utils.NormalExit(fmt.Sprintf("Attack process %s successfully, uid: %s", options.Process, uid))
+	process := options.Process
+	if len(process) == 0 {
+		process = fmt.Sprint(options.PIDs)
+	}
+	// the processes are observed in background, the result of a scheduled experiment is recorded in its runs
+	if options.Action == core.ProcessRestartAction && len(options.Cron()) == 0 {
+		result, err := chaos.RestartResult(uid)
+		if err != nil {
+			utils.ExitWithError(utils.ExitError, err)
+		}
+
+		if result != nil && !result.Recovered {
+			utils.NormalExit(fmt.Sprintf("Attack process %s successfully, but %s, uid: %s", process, result.Message, uid))
+		}
+		if result != nil {
+			utils.NormalExit(fmt.Sprintf("Attack process %s successfully, the new processes %v are ready in %.3fs, uid: %s",
+				process, result.NewPIDs, result.TimeToRecovery, uid))
+		}
+	}
+	utils.NormalExit(fmt.Sprintf("Attack process %s successfully, uid: %s", process, uid))
+}
+
+func previewProcessAttack(options *core.ProcessCommand, chaos *chaosd.Server) {
+	processes, err := chaos.PreviewProcesses(options)
+	if err != nil {
+		utils.ExitWithError(utils.ExitError, err)
+	}
+
+	tw := tablewriter.NewWriter(os.Stdout)
+	tw.SetHeader([]string{"PID", "PPID", "Name", "Create Time", "Command"})
+	tw.SetBorders(tablewriter.Border{Left: false, Top: false, Right: false, Bottom: false})
+	tw.SetAlignment(3)
+	tw.SetRowSeparator("-")
+	tw.SetCenterSeparator(" ")
+	tw.SetColumnSeparator(" ")
+	tw.SetAutoWrapText(false)
+
+	for _, p := range processes {
+		tw.Append([]string{
+			strconv.Itoa(p.Pid), strconv.Itoa(p.PPid), p.Name,
+			time.Unix(0, p.CreateTime*int64(time.Millisecond)).Format(time.RFC3339), p.Cmdline,
+		})
+	}
+
+	tw.Render()
+
+	if count := options.PickCount(); count > 0 && count < len(processes) && !options.Newest && !options.Oldest {
+		utils.NormalExit(fmt.Sprintf("%d of the %d processes will be picked at random", count, len(processes)))
+	}
+
+	utils.NormalExit("")
 }
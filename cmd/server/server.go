@@ -36,6 +36,15 @@ func NewServerCommand() *cobra.Command {
 	cmd.Flags().BoolVar(&conf.EnablePprof, "enable-pprof", true, "enable pprof")
 	cmd.Flags().IntVar(&conf.PprofPort, "pprof-port", 31766, "listen port of the pprof server")
 	cmd.Flags().StringVarP(&conf.Platform, "platform", "f", "local", "platform to deploy, default: local, supported platform: local, kubernetes")
+	cmd.Flags().DurationVar(&conf.ReconcileInterval, "reconcile-interval", 0,
+		"the interval of comparing the recorded network rules with the kernel, the drifts are reported by /api/system/drift. "+
+			"It's disabled by default, and the drifts are only checked when /api/system/drift is requested with refresh")
+	cmd.Flags().BoolVar(&conf.ReconcileReapply, "reconcile-reapply", false,
+		"apply the drifted network rules of active experiments again every reconcile-interval, "+
+			"the experiments are marked error if they can't be applied again")
+	cmd.Flags().DurationVar(&conf.ResolveInterval, "resolve-interval", 0,
+		"the interval of resolving the hostnames of active network experiments again, the ipsets are updated if the addresses change. "+
+			"It's disabled by default")
 
 	return cmd
 }
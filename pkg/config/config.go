@@ -15,6 +15,7 @@ package config
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/pingcap/errors"
 	flag "github.com/spf13/pflag"
@@ -32,6 +33,15 @@ type Config struct {
 	EnablePprof bool
 	PprofPort   int
 	Platform    string
+
+	// ReconcileInterval is the interval of comparing the recorded network rules with the kernel,
+	// the reconciler is disabled if it is 0. The rules are applied again if ReconcileReapply is true.
+	ReconcileInterval time.Duration
+	ReconcileReapply  bool
+
+	// ResolveInterval is the interval of resolving the hostnames of active network experiments
+	// again, the ipsets are updated if the addresses change. It is disabled if it is 0.
+	ResolveInterval time.Duration
 }
 
 // Parse parses flag definitions from the argument list.
@@ -58,6 +68,14 @@ func (c *Config) Validate() error {
 		return errors.Errorf("container runtime %s is not supported", c.Runtime)
 	}
 
+	if c.ReconcileInterval < 0 {
+		return errors.Errorf("reconcile interval %s is not valid", c.ReconcileInterval)
+	}
+
+	if c.ResolveInterval < 0 {
+		return errors.Errorf("resolve interval %s is not valid", c.ResolveInterval)
+	}
+
 	return nil
 }
 
@@ -17,6 +17,7 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+	"strings"
 	"syscall"
 
 	"github.com/containerd/containerd"
@@ -49,10 +50,38 @@ type CRIClient interface {
 
 // NewCRIClient creates a container runtime information client.
 func NewCRIClient(conf *config.Config) (CRIClient, error) {
+	return newCRIClient(conf.Runtime)
+}
+
+// NewCRIClientFromContainerID creates a container runtime information client
+// according to the protocol prefix of the container ID.
+func NewCRIClientFromContainerID(containerID string) (CRIClient, error) {
+	runtime, err := ContainerRuntime(containerID)
+	if err != nil {
+		return nil, err
+	}
+
+	return newCRIClient(runtime)
+}
+
+// ContainerRuntime returns the container runtime according to the protocol prefix of the container ID.
+func ContainerRuntime(containerID string) (string, error) {
+	switch {
+	case strings.HasPrefix(containerID, dockerProtocolPrefix):
+		return containerRuntimeDocker, nil
+	case strings.HasPrefix(containerID, containerdProtocolPrefix):
+		return containerRuntimeContainerd, nil
+	default:
+		return "", fmt.Errorf("container id %s should start with %s or %s",
+			containerID, dockerProtocolPrefix, containerdProtocolPrefix)
+	}
+}
+
+func newCRIClient(runtime string) (CRIClient, error) {
 	// TODO: support more container runtime
 
 	var cli CRIClient
-	switch conf.Runtime {
+	switch runtime {
 	case containerRuntimeDocker:
 		client, err := newDockerClient(defaultDockerSocket, "", nil, nil)
 		if err != nil {
@@ -69,7 +98,7 @@ func NewCRIClient(conf *config.Config) (CRIClient, error) {
 		cli = ContainerdClient{client}
 
 	default:
-		return nil, fmt.Errorf("only docker and containerd is supported, but got %s", conf.Runtime)
+		return nil, fmt.Errorf("only docker and containerd is supported, but got %s", runtime)
 	}
 
 	return cli, nil
@@ -33,8 +33,12 @@ type ExperimentRunStore interface {
 	ListByExperimentUID(ctx context.Context, uid string) ([]*ExperimentRun, error)
 	LatestRun(ctx context.Context, id uint) (*ExperimentRun, error)
 
+	FindByUID(ctx context.Context, runUid string) (*ExperimentRun, error)
+
 	NewRun(ctx context.Context, expRun *ExperimentRun) error
 	Update(ctx context.Context, runUid string, status string, message string) error
+	UpdateResult(ctx context.Context, runUid string, result string) error
+	UpdateRecoverCommand(ctx context.Context, runUid string, recoverCommand string) error
 }
 
 // ExperimentRun represents a run of an experiment
@@ -47,6 +51,12 @@ type ExperimentRun struct {
 	Message      string    `json:"error"`
 	ExperimentID uint
 	Experiment   Experiment `gorm:"foreignKey:ExperimentID" json:"experiment"`
+	// Result is what the attack observed during the run in JSON,
+	// such as the time to recovery of the restarted processes.
+	Result string `json:"result,omitempty"`
+	// RecoverCommand is the attack of the run with the state recorded by it, such as the pid of
+	// the background process, the run is recovered with it like the RecoverCommand of Experiment.
+	RecoverCommand string `json:"recover_command,omitempty"`
 }
 
 func (exp Experiment) NewRun() *ExperimentRun {
@@ -0,0 +1,116 @@
+// Copyright 2021 Chaos Mesh Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path"
+	"time"
+
+	"github.com/pingcap/errors"
+)
+
+const (
+	HTTPAbortAction   = "abort"
+	HTTPDelayAction   = "delay"
+	HTTPReplaceAction = "replace"
+	HTTPPatchAction   = "patch"
+)
+
+var _ AttackConfig = &HTTPCommand{}
+
+type HTTPCommand struct {
+	CommonAttackConfig
+
+	// Port is the local port of the HTTP service, the TCP traffic to it is redirected
+	// by iptables to the proxy listening on ProxyPort, which is chosen automatically if it's 0.
+	Port      int
+	ProxyPort int
+
+	// Method, Path and Headers select the requests to impact, Path is a pattern such as /api/*
+	Method  string
+	Path    string
+	Headers map[string]string
+
+	// used for abort attack, the requests are responded with the Code
+	Code int
+	// used for delay attack
+	Delay string
+	// used for replace attack, the body of responses is replaced with the Body
+	Body string
+	// used for patch attack, the PatchHeaders are set in the responses
+	PatchHeaders map[string]string
+
+	// the proxy process is identified by its pid and create time
+	ProxyPid           int32
+	ProxyPidCreateTime int64
+}
+
+func (h *HTTPCommand) Validate() error {
+	if err := h.CommonAttackConfig.Validate(); err != nil {
+		return err
+	}
+
+	if h.Port <= 0 || h.Port > 65535 {
+		return errors.Errorf("port %d not valid", h.Port)
+	}
+
+	if h.ProxyPort < 0 || h.ProxyPort > 65535 || h.ProxyPort == h.Port {
+		return errors.Errorf("proxy port %d not valid", h.ProxyPort)
+	}
+
+	if _, err := path.Match(h.Path, ""); err != nil {
+		return errors.Errorf("path %s not valid", h.Path)
+	}
+
+	switch h.Action {
+	case HTTPAbortAction:
+		if len(http.StatusText(h.Code)) == 0 {
+			return errors.Errorf("status code %d not valid", h.Code)
+		}
+	case HTTPDelayAction:
+		if len(h.Delay) == 0 {
+			return errors.New("delay is required")
+		}
+
+		if _, err := time.ParseDuration(h.Delay); err != nil {
+			return errors.WithMessage(err, fmt.Sprintf("delay %s not valid", h.Delay))
+		}
+	case HTTPReplaceAction:
+	case HTTPPatchAction:
+		if len(h.PatchHeaders) == 0 {
+			return errors.New("patch headers are required")
+		}
+	default:
+		return errors.Errorf("http action %s not supported", h.Action)
+	}
+
+	return nil
+}
+
+func (h HTTPCommand) RecoverData() string {
+	data, _ := json.Marshal(h)
+
+	return string(data)
+}
+
+func NewHTTPCommand() *HTTPCommand {
+	return &HTTPCommand{
+		CommonAttackConfig: CommonAttackConfig{
+			Kind: HTTPAttack,
+		},
+	}
+}
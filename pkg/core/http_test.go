@@ -0,0 +1,112 @@
+// Copyright 2021 Chaos Mesh Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestHTTPCommand(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	testCases := []struct {
+		cmd    *HTTPCommand
+		errMsg string
+	}{
+		{
+			&HTTPCommand{
+				CommonAttackConfig: CommonAttackConfig{Action: HTTPAbortAction},
+				Code:               503,
+			},
+			"port 0 not valid",
+		},
+		{
+			&HTTPCommand{
+				CommonAttackConfig: CommonAttackConfig{Action: HTTPAbortAction},
+				Port:               8080,
+				ProxyPort:          8080,
+				Code:               503,
+			},
+			"proxy port 8080 not valid",
+		},
+		{
+			&HTTPCommand{
+				CommonAttackConfig: CommonAttackConfig{Action: HTTPAbortAction},
+				Port:               8080,
+				Path:               "/api/[",
+				Code:               503,
+			},
+			"path /api/[ not valid",
+		},
+		{
+			&HTTPCommand{
+				CommonAttackConfig: CommonAttackConfig{Action: HTTPAbortAction},
+				Port:               8080,
+				Code:               999,
+			},
+			"status code 999 not valid",
+		},
+		{
+			&HTTPCommand{
+				CommonAttackConfig: CommonAttackConfig{Action: HTTPDelayAction},
+				Port:               8080,
+				Delay:              "10",
+			},
+			"delay 10 not valid",
+		},
+		{
+			&HTTPCommand{
+				CommonAttackConfig: CommonAttackConfig{Action: HTTPPatchAction},
+				Port:               8080,
+			},
+			"patch headers are required",
+		},
+		{
+			&HTTPCommand{
+				CommonAttackConfig: CommonAttackConfig{Action: "rewrite"},
+				Port:               8080,
+			},
+			"http action rewrite not supported",
+		},
+		{
+			&HTTPCommand{
+				CommonAttackConfig: CommonAttackConfig{Action: HTTPDelayAction},
+				Port:               8080,
+				Method:             "GET",
+				Path:               "/api/*",
+				Headers:            map[string]string{"X-User": "chaos"},
+				Delay:              "1s",
+			},
+			"",
+		},
+		{
+			&HTTPCommand{
+				CommonAttackConfig: CommonAttackConfig{Action: HTTPReplaceAction},
+				Port:               8080,
+			},
+			"",
+		},
+	}
+
+	for _, testCase := range testCases {
+		err := testCase.cmd.Validate()
+		if len(testCase.errMsg) == 0 {
+			g.Expect(err).ShouldNot(HaveOccurred())
+		} else {
+			g.Expect(err.Error()).Should(ContainSubstring(testCase.errMsg))
+		}
+	}
+}
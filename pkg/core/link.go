@@ -0,0 +1,34 @@
+// Copyright 2021 Chaos Mesh Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+// LinkState is the state of a network device to restore after it is brought down,
+// the addresses and routes of the device are removed by the kernel when it is down.
+type LinkState struct {
+	Up        bool        `json:"up"`
+	MTU       int         `json:"mtu"`
+	Addresses []string    `json:"addresses"`
+	Routes    []LinkRoute `json:"routes"`
+}
+
+// LinkRoute is a route in the main table whose output device is the device.
+type LinkRoute struct {
+	Dst      string `json:"dst,omitempty"`
+	Gw       string `json:"gw,omitempty"`
+	Src      string `json:"src,omitempty"`
+	Scope    uint8  `json:"scope"`
+	Protocol int    `json:"protocol"`
+	Priority int    `json:"priority"`
+	Table    int    `json:"table"`
+}
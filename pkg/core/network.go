@@ -16,6 +16,7 @@ package core
 import (
 	"encoding/json"
 	"fmt"
+	"net"
 	"strconv"
 	"strings"
 	"time"
@@ -40,13 +41,91 @@ type NetworkCommand struct {
 	IPAddress   string
 	IPProtocol  string
 	Hostname    string
+	Direction   string
+	// ContainerID is the id of container whose network namespace is attacked, such as docker://xxx,
+	// the network of the host is attacked if it is empty.
+	ContainerID string
+	// Pid and Cgroup select the workload whose traffic is attacked, the packets sent by the cgroup
+	// of the process or by the cgroup v2 path such as /system.slice/nginx.service are impacted.
+	Pid    int
+	Cgroup string
+	// used for reorder attack, packets are reordered every Gap packets if it is set
+	Gap int
+	// used for reject attack, the packets are rejected with the RejectWith, such as tcp-reset,
+	// and only Percent of the packets are rejected if it is less than 100.
+	RejectWith string
+
+	// used for delay attack, the jitter follows the Distribution, the rate of packets is limited
+	// to DelayRate with the PacketOverhead added to every packet, and the packets are sent in
+	// slots every Slot to SlotMax, at most SlotPackets packets and SlotBytes bytes per slot.
+	Distribution   string
+	DelayRate      string
+	PacketOverhead int
+	Slot           string
+	SlotMax        string
+	SlotPackets    int
+	SlotBytes      int
+
+	// used for loss attack, the packets are lost by the LossModel instead of the Percent if it is set,
+	// the LossProbabilities are the percentages separated by comma, such as p13,p31,p32,p23,p14 of
+	// the state model, or p,r,1-h,1-k of the gemodel, the omitted ones are set by netem.
+	LossModel         string
+	LossProbabilities string
+
+	// used for packet attack, the packets with the TCPFlags, such as syn or fin,rst, and in the ConnState
+	// of conntrack, such as NEW,INVALID, are dropped, or delayed by Latency if the PacketFault is delay.
+	TCPFlags    string
+	ConnState   string
+	PacketFault string
+
+	// used for netem attack, which combines the network emulations in one tc rule
+	Loss      string
+	Corrupt   string
+	Duplicate string
+	Reorder   string
+
+	// used for bandwidth attack
+	Rate     string
+	Limit    uint32
+	Buffer   uint32
+	Peakrate uint64
+	Minburst uint32
 
 	// used for DNS attack
 	DNSServer string
 	Port      string
 	PortPid   int32
-	DNSIp     string
-	DNSHost   string
+	// used for port occupied attack, the ports of IPProtocol (tcp, udp or all) are occupied in
+	// PortOccupyMode, and the occupier process is identified by its pid and create time.
+	PortOccupyMode    string
+	PortPidCreateTime int64
+	// DNSIp and DNSHost are the lists separated by comma, the hosts are mapped to the IP addresses
+	// in /etc/hosts by order. EtcHostsBackup is the original content of /etc/hosts to recover,
+	// which is only valid if EtcHostsBackedUp is true, because /etc/hosts may be empty.
+	DNSIp            string
+	DNSHost          string
+	EtcHostsBackup   string
+	EtcHostsBackedUp bool
+
+	// used for DNS attack with the fake DNS server, which listens on the DNSServer and answers
+	// the queries of domains matching DNSPatterns with DNSFault, other queries are sent to DNSUpstream.
+	// The fake DNS server process is identified by its pid and create time.
+	DNSFault               string
+	DNSPatterns            string
+	DNSAnswer              string
+	DNSDelay               string
+	DNSUpstream            string
+	DNSServerPid           int32
+	DNSServerPidCreateTime int64
+
+	// used for flap attack, the Device is brought down for FlapDownTime and up for FlapUpTime
+	// by turns, or kept down until recovered if both are empty. FlapLinkState is the original
+	// state of the Device to restore, and the flapper process is identified by its pid and create time.
+	FlapDownTime      string
+	FlapUpTime        string
+	FlapLinkState     *LinkState
+	FlapPid           int32
+	FlapPidCreateTime int64
 }
 
 var _ AttackConfig = &NetworkCommand{}
@@ -56,113 +135,771 @@ const (
 	NetworkLossAction      = "loss"
 	NetworkCorruptAction   = "corrupt"
 	NetworkDuplicateAction = "duplicate"
+	NetworkBandwidthAction = "bandwidth"
+	NetworkPartitionAction = "partition"
+	NetworkReorderAction   = "reorder"
+	NetworkNetemAction     = "netem"
 	NetworkDNSAction       = "dns"
 	NetworkPortOccupied    = "occupied"
+	NetworkFlapAction      = "flap"
+	NetworkRejectAction    = "reject"
+	NetworkPacketAction    = "packet"
+)
+
+// The faults of the packets selected by the packet attack.
+const (
+	PacketFaultDrop  = "drop"
+	PacketFaultDelay = "delay"
+)
+
+// The faults answered by the fake DNS server of DNS attack.
+const (
+	// DNSFaultNXDomain answers that the domain doesn't exist.
+	DNSFaultNXDomain = "nxdomain"
+	// DNSFaultServFail answers that the server failed.
+	DNSFaultServFail = "servfail"
+	// DNSFaultRandom answers random addresses.
+	DNSFaultRandom = "random"
+	// DNSFaultWrong answers the given address.
+	DNSFaultWrong = "wrong"
+	// DNSFaultSlow sends the queries to the upstream after the given delay.
+	DNSFaultSlow = "slow"
+	// DNSFaultTruncate answers truncated responses without any records.
+	DNSFaultTruncate = "truncate"
+)
+
+// The modes of occupying ports by the port occupied attack.
+const (
+	// PortOccupyModeAccept listens on the ports and accepts the connections.
+	PortOccupyModeAccept = "accept"
+	// PortOccupyModeListen listens on the ports but never accepts the connections, so the backlog
+	// of TCP is full soon, and the UDP packets are never read.
+	PortOccupyModeListen = "listen"
+	// PortOccupyModeBind only binds the ports.
+	PortOccupyModeBind = "bind"
+)
+
+// The TCP flags selecting the packets of packet attack, syn only selects the packets
+// starting new connections, fin and rst select the packets closing connections.
+const (
+	TCPFlagsSYN = "syn"
+	TCPFlagsFIN = "fin"
+	TCPFlagsRST = "rst"
+)
+
+var tcpFlagsMatches = map[string][]string{
+	TCPFlagsSYN: {"--tcp-flags", "SYN,ACK,FIN,RST", "SYN"},
+	TCPFlagsFIN: {"--tcp-flags", "FIN", "FIN"},
+	TCPFlagsRST: {"--tcp-flags", "RST", "RST"},
+}
+
+// the states of conntrack supported by the packet attack
+var connStates = map[string]bool{
+	"NEW":         true,
+	"ESTABLISHED": true,
+	"RELATED":     true,
+	"INVALID":     true,
+	"UNTRACKED":   true,
+}
+
+// The types of ICMP or TCP reset packets sent by the reject attack.
+const (
+	RejectWithTCPReset        = "tcp-reset"
+	RejectWithPortUnreachable = "icmp-port-unreachable"
+	RejectWithHostUnreachable = "icmp-host-unreachable"
+)
+
+// The models of bursty loss supported by netem, the state model is a Markov chain with
+// 4 states, and the gemodel is the Gilbert-Elliott model with 2 states.
+const (
+	LossModelState          = "state"
+	LossModelGilbertElliott = "gemodel"
+)
+
+// The distributions of the jitter of delay attack, the tables of them except uniform are
+// installed with tc, and the jitter is uniformly distributed without a distribution.
+const (
+	DistributionUniform      = "uniform"
+	DistributionNormal       = "normal"
+	DistributionPareto       = "pareto"
+	DistributionParetoNormal = "paretonormal"
+)
+
+// DeviceAllNonLoopback selects all the network interfaces except loopback, and the ifb
+// devices created by chaosd, in the network namespace of the attack. The veth and bridge
+// interfaces of containers are excluded on the host.
+const DeviceAllNonLoopback = "all-non-loopback"
+
+const (
+	NetworkDirectionIngress = "ingress"
+	NetworkDirectionEgress  = "egress"
+	NetworkDirectionBoth    = "both"
 )
 
 func (n *NetworkCommand) Validate() error {
 	if err := n.CommonAttackConfig.Validate(); err != nil {
 		return err
 	}
+
+	if err := n.validContainerID(); err != nil {
+		return err
+	}
+
+	if err := n.validSelector(); err != nil {
+		return err
+	}
+
 	switch n.Action {
 	case NetworkDelayAction:
 		return n.validNetworkDelay()
-	case NetworkLossAction, NetworkCorruptAction, NetworkDuplicateAction:
+	case NetworkLossAction:
+		if err := n.validLossModel(); err != nil {
+			return err
+		}
+		return n.validNetworkCommon()
+	case NetworkCorruptAction, NetworkDuplicateAction:
 		return n.validNetworkCommon()
+	case NetworkBandwidthAction:
+		return n.validNetworkBandwidth()
+	case NetworkReorderAction:
+		return n.validNetworkReorder()
+	case NetworkNetemAction:
+		return n.validNetworkNetem()
+	case NetworkPartitionAction:
+		return n.validNetworkPartition()
+	case NetworkRejectAction:
+		return n.validNetworkReject()
+	case NetworkPacketAction:
+		return n.validNetworkPacket()
 	case NetworkDNSAction:
 		return n.validNetworkDNS()
 	case NetworkPortOccupied:
 		return n.validNetworkOccupied()
+	case NetworkFlapAction:
+		return n.validNetworkFlap()
 	default:
 		return errors.Errorf("network action %s not supported", n.Action)
 	}
 }
 
-func (n *NetworkCommand) validNetworkDelay() error {
-	if len(n.Latency) == 0 {
-		return errors.New("delay is required")
+// validDelayEmulation checks the distribution, rate and slot of the delay attack.
+func (n *NetworkCommand) validDelayEmulation() error {
+	switch n.Distribution {
+	case "", DistributionUniform:
+	case DistributionNormal, DistributionPareto, DistributionParetoNormal:
+		if jitter, err := time.ParseDuration(n.Jitter); len(n.Jitter) == 0 || err != nil || jitter <= 0 {
+			return errors.Errorf("distribution %s requires jitter", n.Distribution)
+		}
+	default:
+		return errors.Errorf("distribution %s not supported", n.Distribution)
+	}
+
+	if len(n.DelayRate) > 0 {
+		if rate, err := convertUnitToBytes(n.DelayRate); err != nil || rate == 0 {
+			return errors.Errorf("rate %s not valid", n.DelayRate)
+		}
+	} else if n.PacketOverhead != 0 {
+		return errors.New("packet overhead requires rate")
+	}
+
+	if len(n.Slot) == 0 {
+		if len(n.SlotMax) > 0 || n.SlotPackets != 0 || n.SlotBytes != 0 {
+			return errors.New("slot is required")
+		}
+		return nil
+	}
+
+	slot, err := time.ParseDuration(n.Slot)
+	if err != nil || slot <= 0 {
+		return errors.Errorf("slot %s not valid", n.Slot)
+	}
+
+	if len(n.SlotMax) > 0 {
+		if slotMax, err := time.ParseDuration(n.SlotMax); err != nil || slotMax < slot {
+			return errors.Errorf("slot max %s not valid", n.SlotMax)
+		}
+	}
+
+	if n.SlotPackets < 0 || n.SlotBytes < 0 {
+		return errors.New("slot packets and bytes must not be negative")
+	}
+
+	return nil
+}
+
+func (n *NetworkCommand) validNetworkDelay() error {
+	if len(n.Latency) == 0 {
+		return errors.New("delay is required")
+	}
+
+	if _, err := time.ParseDuration(n.Latency); err != nil {
+		return errors.WithMessage(err, fmt.Sprintf("latency %s not valid", n.Latency))
+	}
+
+	if len(n.Jitter) > 0 {
+		if _, err := time.ParseDuration(n.Jitter); err != nil {
+			return errors.WithMessage(err, fmt.Sprintf("jitter %s not valid", n.Jitter))
+		}
+	}
+
+	if !utils.CheckPercent(n.Correlation) {
+		return errors.Errorf("correlation %s not valid", n.Correlation)
+	}
+
+	if err := n.validDelayEmulation(); err != nil {
+		return err
+	}
+
+	if err := n.validDevices(); err != nil {
+		return err
+	}
+
+	if !utils.CheckIPs(n.IPAddress) {
+		return errors.Errorf("ip addressed %s not valid", n.IPAddress)
+	}
+
+	if err := n.validTCDirection(); err != nil {
+		return err
+	}
+
+	return checkProtocolAndPorts(n.IPProtocol, n.SourcePort, n.EgressPort)
+}
+
+// validLossModel checks the probabilities of the loss model, the probabilities of
+// the transitions from the same state can't add up to more than 100.
+func (n *NetworkCommand) validLossModel() error {
+	if len(n.LossModel) == 0 {
+		if len(n.LossProbabilities) > 0 {
+			return errors.New("loss model is required")
+		}
+		return nil
+	}
+
+	probabilities := n.lossProbabilities()
+	var max int
+	switch n.LossModel {
+	case LossModelState:
+		max = 5
+	case LossModelGilbertElliott:
+		max = 4
+	default:
+		return errors.Errorf("loss model %s not supported", n.LossModel)
+	}
+
+	if len(probabilities) == 0 || len(probabilities) > max {
+		return errors.Errorf("loss model %s requires 1 to %d probabilities", n.LossModel, max)
+	}
+
+	values := make([]float64, max)
+	for i, p := range probabilities {
+		v, err := strconv.ParseFloat(p, 64)
+		if err != nil || v < 0 || v > 100 {
+			return errors.Errorf("probability %s not valid", p)
+		}
+		values[i] = v
+	}
+
+	// p13 + p14 and p31 + p32 are the probabilities of leaving the state 1 and state 3
+	if n.LossModel == LossModelState && (values[0]+values[4] > 100 || values[1]+values[2] > 100) {
+		return errors.Errorf("probabilities %s not valid, p13 + p14 and p31 + p32 can't be more than 100", n.LossProbabilities)
+	}
+
+	return nil
+}
+
+func (n *NetworkCommand) lossProbabilities() []string {
+	var probabilities []string
+	for _, p := range strings.Split(n.LossProbabilities, ",") {
+		if p = strings.TrimSpace(p); len(p) > 0 {
+			probabilities = append(probabilities, p)
+		}
+	}
+
+	return probabilities
+}
+
+func (n *NetworkCommand) validNetworkCommon() error {
+	// the loss model takes the place of the percent
+	if len(n.Percent) == 0 && len(n.LossModel) == 0 {
+		return errors.New("percent is required")
+	}
+
+	if !utils.CheckPercent(n.Percent) {
+		return errors.Errorf("percent %s not valid", n.Percent)
+	}
+
+	if !utils.CheckPercent(n.Correlation) {
+		return errors.Errorf("correlation %s not valid", n.Correlation)
+	}
+
+	if err := n.validDevices(); err != nil {
+		return err
+	}
+
+	if !utils.CheckIPs(n.IPAddress) {
+		return errors.Errorf("ip addressed %s not valid", n.IPAddress)
+	}
+
+	if err := n.validTCDirection(); err != nil {
+		return err
+	}
+
+	return checkProtocolAndPorts(n.IPProtocol, n.SourcePort, n.EgressPort)
+}
+
+func (n *NetworkCommand) validNetworkReorder() error {
+	if len(n.Latency) == 0 {
+		return errors.New("latency is required, packets can't be reordered without delay")
+	}
+
+	if _, err := time.ParseDuration(n.Latency); err != nil {
+		return errors.WithMessage(err, fmt.Sprintf("latency %s not valid", n.Latency))
+	}
+
+	if len(n.Jitter) > 0 {
+		if _, err := time.ParseDuration(n.Jitter); err != nil {
+			return errors.WithMessage(err, fmt.Sprintf("jitter %s not valid", n.Jitter))
+		}
+	}
+
+	if n.Gap < 0 {
+		return errors.Errorf("gap %d not valid", n.Gap)
+	}
+
+	return n.validNetworkCommon()
+}
+
+func (n *NetworkCommand) validNetworkNetem() error {
+	if len(n.Latency) == 0 && len(n.Loss) == 0 && len(n.Corrupt) == 0 &&
+		len(n.Duplicate) == 0 && len(n.Reorder) == 0 {
+		return errors.New("at least one of latency, loss, corrupt, duplicate and reorder is required")
+	}
+
+	if len(n.Latency) > 0 {
+		if _, err := time.ParseDuration(n.Latency); err != nil {
+			return errors.WithMessage(err, fmt.Sprintf("latency %s not valid", n.Latency))
+		}
+	}
+
+	if len(n.Jitter) > 0 {
+		if _, err := time.ParseDuration(n.Jitter); err != nil {
+			return errors.WithMessage(err, fmt.Sprintf("jitter %s not valid", n.Jitter))
+		}
+	}
+
+	if len(n.Reorder) > 0 && len(n.Latency) == 0 {
+		return errors.New("latency is required when reorder is set, packets can't be reordered without delay")
+	}
+
+	for _, p := range []struct{ name, percent string }{
+		{"loss", n.Loss},
+		{"corrupt", n.Corrupt},
+		{"duplicate", n.Duplicate},
+		{"reorder", n.Reorder},
+	} {
+		if len(p.percent) > 0 && !utils.CheckPercent(p.percent) {
+			return errors.Errorf("%s %s not valid", p.name, p.percent)
+		}
+	}
+
+	if !utils.CheckPercent(n.Correlation) {
+		return errors.Errorf("correlation %s not valid", n.Correlation)
+	}
+
+	if n.Gap < 0 {
+		return errors.Errorf("gap %d not valid", n.Gap)
+	}
+
+	if err := n.validDevices(); err != nil {
+		return err
+	}
+
+	if !utils.CheckIPs(n.IPAddress) {
+		return errors.Errorf("ip addressed %s not valid", n.IPAddress)
+	}
+
+	if err := n.validTCDirection(); err != nil {
+		return err
+	}
+
+	return checkProtocolAndPorts(n.IPProtocol, n.SourcePort, n.EgressPort)
+}
+
+func (n *NetworkCommand) validNetworkBandwidth() error {
+	if len(n.Rate) == 0 || n.Limit == 0 || n.Buffer == 0 {
+		return errors.New("rate, limit and buffer are required when action is bandwidth")
+	}
+
+	if _, err := convertUnitToBytes(n.Rate); err != nil {
+		return errors.WithMessage(err, fmt.Sprintf("rate %s not valid", n.Rate))
+	}
+
+	if (n.Peakrate == 0) != (n.Minburst == 0) {
+		return errors.New("peakrate and minburst must be set together")
+	}
+
+	if err := n.validDevices(); err != nil {
+		return err
+	}
+
+	if !utils.CheckIPs(n.IPAddress) {
+		return errors.Errorf("ip addressed %s not valid", n.IPAddress)
+	}
+
+	if err := n.validTCDirection(); err != nil {
+		return err
+	}
+
+	return checkProtocolAndPorts(n.IPProtocol, n.SourcePort, n.EgressPort)
+}
+
+func (n *NetworkCommand) validNetworkPartition() error {
+	if !n.NeedApplyIPSet() {
+		return errors.New("ip address or hostname is required when action is partition")
+	}
+
+	if !utils.CheckIPs(n.IPAddress) {
+		return errors.Errorf("ip addressed %s not valid", n.IPAddress)
+	}
+
+	if !checkDirection(n.Direction) {
+		return errors.Errorf("direction %s not valid", n.Direction)
+	}
+
+	return checkProtocolAndPorts(n.IPProtocol, n.SourcePort, n.EgressPort)
+}
+
+func (n *NetworkCommand) validNetworkReject() error {
+	if !n.NeedApplyIPSet() {
+		return errors.New("ip address or hostname is required when action is reject")
+	}
+
+	if !utils.CheckIPs(n.IPAddress) {
+		return errors.Errorf("ip addressed %s not valid", n.IPAddress)
+	}
+
+	if !checkDirection(n.Direction) {
+		return errors.Errorf("direction %s not valid", n.Direction)
+	}
+
+	switch n.RejectWith {
+	case RejectWithTCPReset:
+		if n.IPProtocol != "tcp" {
+			return errors.Errorf("reject with %s can only be used with protocol tcp", n.RejectWith)
+		}
+	case RejectWithPortUnreachable, RejectWithHostUnreachable:
+	default:
+		return errors.Errorf("reject with %s not supported", n.RejectWith)
+	}
+
+	if !utils.CheckPercent(n.Percent) {
+		return errors.Errorf("percent %s not valid", n.Percent)
+	}
+
+	return checkProtocolAndPorts(n.IPProtocol, n.SourcePort, n.EgressPort)
+}
+
+// validNetworkPacket checks the packet attack, the packets are dropped by iptables in the
+// direction, or marked by iptables and redirected to an ifb device to be delayed by tc, so
+// only the egress packets can be delayed.
+func (n *NetworkCommand) validNetworkPacket() error {
+	if len(n.TCPFlags) == 0 && len(n.ConnState) == 0 {
+		return errors.New("tcp flags or connection state is required")
+	}
+
+	for _, flags := range splitList(n.TCPFlags) {
+		if _, ok := tcpFlagsMatches[strings.ToLower(flags)]; !ok {
+			return errors.Errorf("tcp flags %s not supported", flags)
+		}
+	}
+
+	if len(n.TCPFlags) > 0 && n.IPProtocol != "tcp" {
+		return errors.New("tcp flags can only be used with protocol tcp")
+	}
+
+	for _, state := range splitList(n.ConnState) {
+		if !connStates[strings.ToUpper(state)] {
+			return errors.Errorf("connection state %s not supported", state)
+		}
+	}
+
+	if !n.NeedApplyIPSet() {
+		return errors.New("ip address or hostname is required when action is packet")
+	}
+
+	if !utils.CheckIPs(n.IPAddress) {
+		return errors.Errorf("ip addressed %s not valid", n.IPAddress)
+	}
+
+	switch n.PacketFault {
+	case PacketFaultDrop:
+		if !checkDirection(n.Direction) {
+			return errors.Errorf("direction %s not valid", n.Direction)
+		}
+
+		if !utils.CheckPercent(n.Percent) {
+			return errors.Errorf("percent %s not valid", n.Percent)
+		}
+	case PacketFaultDelay:
+		if _, err := time.ParseDuration(n.Latency); err != nil {
+			return errors.WithMessage(err, fmt.Sprintf("latency %s not valid", n.Latency))
+		}
+
+		if len(n.Jitter) > 0 {
+			if _, err := time.ParseDuration(n.Jitter); err != nil {
+				return errors.WithMessage(err, fmt.Sprintf("jitter %s not valid", n.Jitter))
+			}
+		}
+
+		if !utils.CheckPercent(n.Correlation) {
+			return errors.Errorf("correlation %s not valid", n.Correlation)
+		}
+
+		if err := n.validDevices(); err != nil {
+			return err
+		}
+
+		if len(n.Direction) > 0 && n.Direction != NetworkDirectionEgress {
+			return errors.Errorf("packet fault %s is not supported when direction is %s", n.PacketFault, n.Direction)
+		}
+	default:
+		return errors.Errorf("packet fault %s not supported", n.PacketFault)
+	}
+
+	return checkProtocolAndPorts(n.IPProtocol, n.SourcePort, n.EgressPort)
+}
+
+// validContainerID checks the container id, only the attacks based on tc and iptables
+// can be applied in the network namespace of a container.
+func (n *NetworkCommand) validContainerID() error {
+	if len(n.ContainerID) == 0 {
+		return nil
+	}
+
+	if !n.NeedApplyTC() && n.Action != NetworkPartitionAction && n.Action != NetworkRejectAction &&
+		n.Action != NetworkPacketAction {
+		return errors.Errorf("container id is not supported by network %s attack", n.Action)
+	}
+
+	if !strings.HasPrefix(n.ContainerID, "docker://") && !strings.HasPrefix(n.ContainerID, "containerd://") {
+		return errors.Errorf("container id %s not valid, it should start with docker:// or containerd://", n.ContainerID)
+	}
+
+	return nil
+}
+
+// validSelector checks the pid and cgroup. The packets sent by them are marked by iptables
+// and redirected to an ifb device, so only the egress traffic of tc attacks can be selected.
+func (n *NetworkCommand) validSelector() error {
+	if n.Pid == 0 && len(n.Cgroup) == 0 {
+		return nil
+	}
+
+	if n.Pid != 0 && len(n.Cgroup) > 0 {
+		return errors.New("pid and cgroup can't be set at the same time")
+	}
+
+	if n.Pid < 0 {
+		return errors.Errorf("pid %d not valid", n.Pid)
+	}
+
+	if len(n.Cgroup) > 0 && !strings.HasPrefix(n.Cgroup, "/") {
+		return errors.Errorf("cgroup %s not valid, it should be an absolute path", n.Cgroup)
+	}
+
+	// all the packets of the host are sent by the root cgroup and its children
+	if len(n.Cgroup) > 0 && strings.Trim(n.Cgroup, "/") == "" {
+		return errors.Errorf("cgroup %s not valid, the root cgroup can't be selected", n.Cgroup)
+	}
+
+	if !n.NeedApplyTC() {
+		return errors.Errorf("pid and cgroup are not supported by network %s attack", n.Action)
+	}
+
+	if len(n.Direction) > 0 && n.Direction != NetworkDirectionEgress {
+		return errors.Errorf("pid and cgroup are not supported when direction is %s", n.Direction)
+	}
+
+	return nil
+}
+
+// Devices returns the network interfaces of the attack, the Device is the interfaces separated
+// by comma, or DeviceAllNonLoopback which is resolved to the interfaces when attacking.
+func (n *NetworkCommand) Devices() []string {
+	return splitList(n.Device)
+}
+
+// validDevices checks the list of devices, DeviceAllNonLoopback can't be listed with other devices.
+func (n *NetworkCommand) validDevices() error {
+	devices := n.Devices()
+	if len(devices) == 0 {
+		return errors.New("device is required")
+	}
+
+	seen := make(map[string]bool)
+	for _, device := range devices {
+		if device == DeviceAllNonLoopback && len(devices) > 1 {
+			return errors.Errorf("device %s can't be used with other devices", DeviceAllNonLoopback)
+		}
+
+		if seen[device] {
+			return errors.Errorf("device %s is duplicated", device)
+		}
+		seen[device] = true
+	}
+
+	return nil
+}
+
+// validTCDirection checks the direction of the attacks based on tc. The ingress traffic
+// is redirected to an ifb device by the ipset, so it can't be filtered by protocol or ports.
+func (n *NetworkCommand) validTCDirection() error {
+	if len(n.Direction) == 0 || n.Direction == NetworkDirectionEgress {
+		return nil
+	}
+
+	if !checkDirection(n.Direction) {
+		return errors.Errorf("direction %s not valid", n.Direction)
+	}
+
+	if len(n.IPProtocol) > 0 || len(n.SourcePort) > 0 || len(n.EgressPort) > 0 {
+		return errors.Errorf("protocol and ports are not supported when direction is %s", n.Direction)
+	}
+
+	return nil
+}
+
+func (n *NetworkCommand) validNetworkDNS() error {
+	if !utils.CheckIPs(n.DNSServer) {
+		return errors.Errorf("server addresse %s not valid", n.DNSServer)
 	}
 
-	if _, err := time.ParseDuration(n.Latency); err != nil {
-		return errors.WithMessage(err, fmt.Sprintf("latency %s not valid", n.Latency))
+	hosts, ips := splitList(n.DNSHost), splitList(n.DNSIp)
+	for _, ip := range ips {
+		if net.ParseIP(ip) == nil {
+			return errors.Errorf("ip addresse %s not valid", ip)
+		}
 	}
 
-	if len(n.Jitter) > 0 {
-		if _, err := time.ParseDuration(n.Jitter); err != nil {
-			return errors.WithMessage(err, fmt.Sprintf("jitter %s not valid", n.Jitter))
+	if len(hosts) != len(ips) {
+		return errors.Errorf("DNS host %s must match a DNS ip %s", n.DNSHost, n.DNSIp)
+	}
+
+	if len(n.DNSFault) == 0 {
+		if len(n.DNSPatterns) > 0 {
+			return errors.New("DNS fault is required when DNS patterns are set")
 		}
+		return nil
 	}
 
-	if !utils.CheckPercent(n.Correlation) {
-		return errors.Errorf("correlation %s not valid", n.Correlation)
+	switch n.DNSFault {
+	case DNSFaultNXDomain, DNSFaultServFail, DNSFaultRandom, DNSFaultWrong, DNSFaultSlow, DNSFaultTruncate:
+	default:
+		return errors.Errorf("DNS fault %s not supported", n.DNSFault)
 	}
 
-	if len(n.Device) == 0 {
-		return errors.New("device is required")
+	if n.DNSFault == DNSFaultWrong && net.ParseIP(n.DNSAnswer) == nil {
+		return errors.Errorf("DNS answer %s not valid", n.DNSAnswer)
 	}
 
-	if !utils.CheckIPs(n.IPAddress) {
-		return errors.Errorf("ip addressed %s not valid", n.IPAddress)
+	if n.DNSFault == DNSFaultSlow {
+		if _, err := time.ParseDuration(n.DNSDelay); err != nil {
+			return errors.WithMessage(err, fmt.Sprintf("DNS delay %s not valid", n.DNSDelay))
+		}
 	}
 
-	return checkProtocolAndPorts(n.IPProtocol, n.SourcePort, n.EgressPort)
-}
+	if len(n.DNSUpstream) > 0 && net.ParseIP(n.DNSUpstream) == nil {
+		return errors.Errorf("DNS upstream %s not valid", n.DNSUpstream)
+	}
 
-func (n *NetworkCommand) validNetworkCommon() error {
-	if len(n.Percent) == 0 {
-		return errors.New("percent is required")
+	if n.DNSUpstream == n.DNSServer {
+		return errors.New("DNS upstream can't be the address of the fake DNS server")
 	}
 
-	if !utils.CheckPercent(n.Percent) {
-		return errors.Errorf("percent %s not valid", n.Percent)
+	return nil
+}
+
+func (n *NetworkCommand) validNetworkOccupied() error {
+	if len(n.Port) == 0 {
+		return errors.New("port is required")
 	}
 
-	if !utils.CheckPercent(n.Correlation) {
-		return errors.Errorf("correlation %s not valid", n.Correlation)
+	if _, err := utils.ParsePorts(n.Port); err != nil {
+		return err
 	}
 
-	if len(n.Device) == 0 {
-		return errors.New("device is required")
+	if len(n.OccupiedProtocols()) == 0 {
+		return errors.Errorf("protocol %s not supported by port occupied attack", n.IPProtocol)
 	}
 
-	if !utils.CheckIPs(n.IPAddress) {
-		return errors.Errorf("ip addressed %s not valid", n.IPAddress)
+	switch n.PortOccupyMode {
+	case PortOccupyModeAccept, PortOccupyModeListen, PortOccupyModeBind:
+	default:
+		return errors.Errorf("port occupy mode %s not supported", n.PortOccupyMode)
 	}
 
-	return checkProtocolAndPorts(n.IPProtocol, n.SourcePort, n.EgressPort)
+	return nil
 }
 
-func (n *NetworkCommand) validNetworkDNS() error {
-	if !utils.CheckIPs(n.DNSServer) {
-		return errors.Errorf("server addresse %s not valid", n.DNSServer)
+func (n *NetworkCommand) validNetworkFlap() error {
+	if err := n.validDevices(); err != nil {
+		return err
 	}
 
-	if !utils.CheckIPs(n.DNSIp) {
-		return errors.Errorf("ip addresse %s not valid", n.DNSIp)
+	if devices := n.Devices(); len(devices) > 1 || devices[0] == DeviceAllNonLoopback {
+		return errors.New("flap attack only supports one device")
 	}
 
-	if (len(n.DNSHost) != 0 && len(n.DNSIp) == 0) || (len(n.DNSHost) == 0 && len(n.DNSIp) != 0) {
-		return errors.Errorf("DNS host %s must match a DNS ip %s", n.DNSHost, n.DNSIp)
+	if !n.NeedFlap() {
+		if len(n.FlapUpTime) > 0 {
+			return errors.New("down time is required when up time is set")
+		}
+		return nil
 	}
 
-	return nil
-}
+	if len(n.FlapUpTime) == 0 {
+		return errors.New("up time is required when down time is set")
+	}
 
-func (n *NetworkCommand) validNetworkOccupied() error {
-	if len(n.Port) == 0 {
-		return errors.New("port is required")
+	for _, d := range []struct{ name, duration string }{
+		{"down time", n.FlapDownTime},
+		{"up time", n.FlapUpTime},
+	} {
+		duration, err := time.ParseDuration(d.duration)
+		if err != nil {
+			return errors.WithMessage(err, fmt.Sprintf("%s %s not valid", d.name, d.duration))
+		}
+
+		if duration <= 0 {
+			return errors.Errorf("%s %s not valid", d.name, d.duration)
+		}
 	}
+
 	return nil
 }
 
 func (n *NetworkCommand) CompleteDefaults() {
+	if n.NeedApplyTC() && len(n.Direction) == 0 {
+		n.Direction = NetworkDirectionEgress
+	}
+
 	switch n.Action {
 	case NetworkDelayAction:
 		n.setDefaultForNetworkDelay()
 	case NetworkLossAction:
 		n.setDefaultForNetworkLoss()
+	case NetworkReorderAction, NetworkNetemAction:
+		n.setDefaultForNetworkDelay()
+	case NetworkPartitionAction:
+		n.setDefaultForNetworkPartition()
+	case NetworkRejectAction:
+		n.setDefaultForNetworkReject()
+	case NetworkPacketAction:
+		n.setDefaultForNetworkPacket()
 	case NetworkDNSAction:
 		n.setDefaultForNetworkDNS()
+	case NetworkPortOccupied:
+		n.setDefaultForNetworkOccupied()
 	}
 }
 
@@ -182,9 +919,78 @@ func (n *NetworkCommand) setDefaultForNetworkLoss() {
 	}
 }
 
+func (n *NetworkCommand) setDefaultForNetworkPartition() {
+	if len(n.Direction) == 0 {
+		n.Direction = NetworkDirectionBoth
+	}
+}
+
+func (n *NetworkCommand) setDefaultForNetworkReject() {
+	if len(n.Direction) == 0 {
+		n.Direction = NetworkDirectionEgress
+	}
+
+	if len(n.RejectWith) == 0 {
+		if n.IPProtocol == "tcp" {
+			n.RejectWith = RejectWithTCPReset
+		} else {
+			n.RejectWith = RejectWithPortUnreachable
+		}
+	}
+
+	if len(n.Percent) == 0 {
+		n.Percent = "100"
+	}
+}
+
+func (n *NetworkCommand) setDefaultForNetworkPacket() {
+	if len(n.Direction) == 0 {
+		n.Direction = NetworkDirectionEgress
+	}
+
+	if len(n.PacketFault) == 0 {
+		n.PacketFault = PacketFaultDrop
+	}
+
+	if len(n.TCPFlags) > 0 && len(n.IPProtocol) == 0 {
+		n.IPProtocol = "tcp"
+	}
+
+	if n.PacketFault == PacketFaultDelay {
+		n.setDefaultForNetworkDelay()
+	}
+}
+
 func (n *NetworkCommand) setDefaultForNetworkDNS() {
 	if len(n.DNSServer) == 0 {
-		n.DNSServer = "123.123.123.123"
+		if n.NeedApplyFakeDNSServer() {
+			n.DNSServer = "127.0.0.1"
+		} else {
+			n.DNSServer = "123.123.123.123"
+		}
+	}
+
+	if n.DNSFault == DNSFaultSlow && len(n.DNSDelay) == 0 {
+		n.DNSDelay = "1s"
+	}
+}
+
+func (n *NetworkCommand) setDefaultForNetworkOccupied() {
+	if len(n.IPProtocol) == 0 {
+		n.IPProtocol = "tcp"
+	}
+
+	if len(n.PortOccupyMode) == 0 {
+		n.PortOccupyMode = PortOccupyModeAccept
+	}
+}
+
+func checkDirection(d string) bool {
+	switch d {
+	case NetworkDirectionIngress, NetworkDirectionEgress, NetworkDirectionBoth:
+		return true
+	default:
+		return false
 	}
 }
 
@@ -243,7 +1049,27 @@ func (n *NetworkCommand) ToDelayNetem() (*pb.Netem, error) {
 	return netem, nil
 }
 
+// ToReorderDelaySpec converts the reorder attack to a DelaySpec,
+// because netem can only reorder packets together with delay.
+func (n *NetworkCommand) ToReorderDelaySpec() *DelaySpec {
+	return &DelaySpec{
+		Latency:     n.Latency,
+		Correlation: "0",
+		Jitter:      n.Jitter,
+		Reorder: &ReorderSpec{
+			Reorder:     n.Percent,
+			Correlation: n.Correlation,
+			Gap:         n.Gap,
+		},
+	}
+}
+
 func (n *NetworkCommand) ToLossNetem() (*pb.Netem, error) {
+	// the loss model is set by chaosd after the netem is set by the chaos daemon
+	if len(n.LossModel) > 0 {
+		return lossModelNetem(), nil
+	}
+
 	percent, corr, err := n.parsePercentAndCorr()
 	if err != nil {
 		return nil, errors.WithStack(err)
@@ -292,6 +1118,125 @@ func (n *NetworkCommand) ToDuplicateNetem() (*pb.Netem, error) {
 	}, nil
 }
 
+func (n *NetworkCommand) ToBandwidthSpec() *BandwidthSpec {
+	spec := &BandwidthSpec{
+		Rate:   n.Rate,
+		Limit:  n.Limit,
+		Buffer: n.Buffer,
+	}
+
+	if n.Peakrate > 0 && n.Minburst > 0 {
+		peakrate, minburst := n.Peakrate, n.Minburst
+		spec.Peakrate = &peakrate
+		spec.Minburst = &minburst
+	}
+
+	return spec
+}
+
+// ToTcParameter converts the attack to the parameters of tc rule, which are
+// recorded to set the tc rules again when other experiments change the device.
+func (n *NetworkCommand) ToTcParameter(device string) (*TcParameter, error) {
+	tc := &TcParameter{
+		Device: device,
+	}
+	switch n.Action {
+	case NetworkDelayAction:
+		tc.Delay = &DelaySpec{
+			Latency:        n.Latency,
+			Correlation:    n.Correlation,
+			Jitter:         n.Jitter,
+			Distribution:   n.Distribution,
+			Rate:           n.DelayRate,
+			PacketOverhead: n.PacketOverhead,
+		}
+		if len(n.Slot) > 0 {
+			tc.Delay.Slot = &SlotSpec{
+				MinDelay: n.Slot,
+				MaxDelay: n.SlotMax,
+				Packets:  n.SlotPackets,
+				Bytes:    n.SlotBytes,
+			}
+		}
+	case NetworkLossAction:
+		tc.Loss = &LossSpec{
+			Loss:        n.Percent,
+			Correlation: n.Correlation,
+		}
+		if len(n.LossModel) > 0 {
+			tc.Loss = &LossSpec{
+				Model:         n.LossModel,
+				Probabilities: n.lossProbabilities(),
+			}
+		}
+	case NetworkCorruptAction:
+		tc.Corrupt = &CorruptSpec{
+			Corrupt:     n.Percent,
+			Correlation: n.Correlation,
+		}
+	case NetworkDuplicateAction:
+		tc.Duplicate = &DuplicateSpec{
+			Duplicate:   n.Percent,
+			Correlation: n.Correlation,
+		}
+	case NetworkReorderAction:
+		tc.Delay = n.ToReorderDelaySpec()
+	case NetworkPacketAction:
+		tc.Delay = &DelaySpec{
+			Latency:     n.Latency,
+			Correlation: n.Correlation,
+			Jitter:      n.Jitter,
+		}
+	case NetworkNetemAction:
+		n.setNetemSpecs(tc)
+	case NetworkBandwidthAction:
+		tc.Bandwidth = n.ToBandwidthSpec()
+	default:
+		return nil, errors.Errorf("network %s attack not supported", n.Action)
+	}
+
+	return tc, nil
+}
+
+// setNetemSpecs sets every network emulation given by the netem attack to the tc parameter.
+func (n *NetworkCommand) setNetemSpecs(tc *TcParameter) {
+	if len(n.Latency) > 0 {
+		tc.Delay = &DelaySpec{
+			Latency:     n.Latency,
+			Correlation: n.Correlation,
+			Jitter:      n.Jitter,
+		}
+		if len(n.Reorder) > 0 {
+			tc.Delay.Reorder = &ReorderSpec{
+				Reorder:     n.Reorder,
+				Correlation: n.Correlation,
+				Gap:         n.Gap,
+			}
+		}
+	}
+
+	if len(n.Loss) > 0 {
+		tc.Loss = &LossSpec{
+			Loss:        n.Loss,
+			Correlation: n.Correlation,
+		}
+	}
+
+	if len(n.Corrupt) > 0 {
+		tc.Corrupt = &CorruptSpec{
+			Corrupt:     n.Corrupt,
+			Correlation: n.Correlation,
+		}
+	}
+
+	if len(n.Duplicate) > 0 {
+		tc.Duplicate = &DuplicateSpec{
+			Duplicate:   n.Duplicate,
+			Correlation: n.Correlation,
+		}
+	}
+}
+
 func (n *NetworkCommand) ToTC(ipset string) (*pb.Tc, error) {
 	tc := &pb.Tc{
 		Type:       pb.Tc_NETEM,
@@ -301,15 +1246,30 @@ func (n *NetworkCommand) ToTC(ipset string) (*pb.Tc, error) {
 		EgressPort: n.EgressPort,
 	}
 
+	if n.Action == NetworkBandwidthAction {
+		tbf, err := n.ToBandwidthSpec().ToTbf()
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		tc.Type = pb.Tc_BANDWIDTH
+		tc.Tbf = tbf
+		return tc, nil
+	}
+
 	var (
 		netem *pb.Netem
 		err   error
 	)
 	switch n.Action {
-	case NetworkDelayAction:
+	case NetworkDelayAction, NetworkPacketAction:
 		if netem, err = n.ToDelayNetem(); err != nil {
 			return nil, errors.WithStack(err)
 		}
+	case NetworkReorderAction:
+		if netem, err = n.ToReorderDelaySpec().ToNetem(); err != nil {
+			return nil, errors.WithStack(err)
+		}
 	case NetworkLossAction:
 		if netem, err = n.ToLossNetem(); err != nil {
 			return nil, errors.WithStack(err)
@@ -322,6 +1282,15 @@ func (n *NetworkCommand) ToTC(ipset string) (*pb.Tc, error) {
 		if netem, err = n.ToDuplicateNetem(); err != nil {
 			return nil, errors.WithStack(err)
 		}
+	case NetworkNetemAction:
+		tcp, err := n.ToTcParameter("")
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		if netem, err = toNetem(tcp); err != nil {
+			return nil, errors.WithStack(err)
+		}
 	default:
 		return nil, errors.Errorf("action %s not supported", n.Action)
 	}
@@ -331,7 +1300,9 @@ func (n *NetworkCommand) ToTC(ipset string) (*pb.Tc, error) {
 	return tc, nil
 }
 
-func (n *NetworkCommand) ToIPSet(name string) (*pb.IPSet, error) {
+// ToIPSets converts the targets of attack to ipsets. The IPv6 cidrs are put in another ipset
+// named by IPv6SetName, which is nil if there is no IPv6 cidr.
+func (n *NetworkCommand) ToIPSets(name string) (*pb.IPSet, *pb.IPSet, error) {
 	var (
 		cidrs []string
 		err   error
@@ -339,21 +1310,31 @@ func (n *NetworkCommand) ToIPSet(name string) (*pb.IPSet, error) {
 	if len(n.IPAddress) > 0 {
 		cidrs, err = utils.ResolveCidrs(strings.Split(n.IPAddress, ","))
 		if err != nil {
-			return nil, errors.WithStack(err)
+			return nil, nil, errors.WithStack(err)
 		}
 	}
 
 	if len(n.Hostname) > 0 {
 		cs, err := utils.ResolveCidrs(strings.Split(n.Hostname, ","))
 		if err != nil {
-			return nil, errors.WithStack(err)
+			return nil, nil, errors.WithStack(err)
 		}
 		cidrs = append(cidrs, cs...)
 	}
 
-	return &pb.IPSet{
+	ipv4, ipv6 := utils.SplitCidrsByFamily(cidrs)
+	ipv4Set := &pb.IPSet{
 		Name:  name,
-		Cidrs: cidrs,
+		Cidrs: ipv4,
+	}
+
+	if len(ipv6) == 0 {
+		return ipv4Set, nil, nil
+	}
+
+	return ipv4Set, &pb.IPSet{
+		Name:  IPv6SetName(name),
+		Cidrs: ipv6,
 	}, nil
 }
 
@@ -371,13 +1352,40 @@ func (n *NetworkCommand) NeedApplyIptables() bool {
 
 func (n *NetworkCommand) NeedApplyTC() bool {
 	switch n.Action {
-	case NetworkDelayAction, NetworkLossAction, NetworkCorruptAction, NetworkDuplicateAction:
+	case NetworkDelayAction, NetworkLossAction, NetworkCorruptAction, NetworkDuplicateAction,
+		NetworkBandwidthAction, NetworkReorderAction, NetworkNetemAction:
 		return true
+	case NetworkPacketAction:
+		return n.PacketFault == PacketFaultDelay
 	default:
 		return false
 	}
 }
 
+// EnterNS returns true if the rules should be applied in the network namespace of a container.
+func (n *NetworkCommand) EnterNS() bool {
+	return len(n.ContainerID) > 0
+}
+
+// NeedApplyEgressTC returns true if the tc rule should be applied on the device,
+// the attacks recorded before the direction was introduced only impact egress traffic.
+func (n *NetworkCommand) NeedApplyEgressTC() bool {
+	return n.NeedApplyTC() && n.Direction != NetworkDirectionIngress && !n.NeedApplyMarkTC()
+}
+
+// NeedApplyMarkTC returns true if only the egress packets sent by the pid or cgroup, or selected
+// by the packet attack, should be marked by iptables and redirected to an ifb device, and the tc
+// rule should be applied on it.
+func (n *NetworkCommand) NeedApplyMarkTC() bool {
+	return n.NeedApplyTC() && (n.Pid > 0 || len(n.Cgroup) > 0 || n.Action == NetworkPacketAction)
+}
+
+// NeedApplyIngressTC returns true if the ingress traffic of the device should be
+// redirected to an ifb device and the tc rule should be applied on it.
+func (n *NetworkCommand) NeedApplyIngressTC() bool {
+	return n.NeedApplyTC() && (n.Direction == NetworkDirectionIngress || n.Direction == NetworkDirectionBoth)
+}
+
 func (n *NetworkCommand) NeedApplyEtcHosts() bool {
 	if len(n.DNSHost) > 0 || len(n.DNSIp) > 0 {
 		return true
@@ -386,12 +1394,234 @@ func (n *NetworkCommand) NeedApplyEtcHosts() bool {
 	return false
 }
 
+// OccupiedProtocols returns the protocols whose ports are occupied by the port occupied attack.
+func (n *NetworkCommand) OccupiedProtocols() []string {
+	switch n.IPProtocol {
+	case "tcp", "udp":
+		return []string{n.IPProtocol}
+	case "all":
+		return []string{"tcp", "udp"}
+	default:
+		return nil
+	}
+}
+
+// HostEntry maps the host to the IP address in /etc/hosts.
+type HostEntry struct {
+	Host string
+	IP   string
+}
+
+// HostEntries pairs the hosts with the IP addresses by order.
+func (n *NetworkCommand) HostEntries() []HostEntry {
+	hosts, ips := splitList(n.DNSHost), splitList(n.DNSIp)
+	entries := make([]HostEntry, 0, len(hosts))
+	for i := 0; i < len(hosts) && i < len(ips); i++ {
+		entries = append(entries, HostEntry{Host: hosts[i], IP: ips[i]})
+	}
+
+	return entries
+}
+
+// MapEtcHosts maps the hosts to the IP addresses in the content of /etc/hosts. The hosts are
+// removed from the existing lines and the lines without any host left are dropped, then the
+// entries of the hosts are appended.
+func (n *NetworkCommand) MapEtcHosts(content string) string {
+	entries := n.HostEntries()
+	mapped := make(map[string]bool)
+	for _, entry := range entries {
+		mapped[strings.ToLower(entry.Host)] = true
+	}
+
+	var lines []string
+	if len(content) > 0 {
+		lines = strings.Split(strings.TrimSuffix(content, "\n"), "\n")
+	}
+
+	newLines := make([]string, 0, len(lines)+len(entries))
+	for _, line := range lines {
+		entry, comment := line, ""
+		if i := strings.Index(line, "#"); i >= 0 {
+			entry, comment = line[:i], line[i:]
+		}
+		fields := strings.Fields(entry)
+
+		// the line looks like: 127.0.0.1 localhost localhost.localdomain # comment
+		if len(fields) < 2 {
+			newLines = append(newLines, line)
+			continue
+		}
+
+		names := make([]string, 0, len(fields)-1)
+		for _, name := range fields[1:] {
+			if !mapped[strings.ToLower(name)] {
+				names = append(names, name)
+			}
+		}
+
+		switch len(names) {
+		case len(fields) - 1:
+			newLines = append(newLines, line)
+		case 0:
+		default:
+			newLine := fields[0] + "\t" + strings.Join(names, " ")
+			if len(comment) > 0 {
+				newLine += " " + comment
+			}
+			newLines = append(newLines, newLine)
+		}
+	}
+
+	for _, entry := range entries {
+		newLines = append(newLines, entry.IP+"\t"+entry.Host)
+	}
+
+	return strings.Join(newLines, "\n") + "\n"
+}
+
+// ConnStateMatch returns the conntrack match of the connection states separated by comma,
+// such as NEW,INVALID, it is nil if no state is set.
+func ConnStateMatch(connState string) []string {
+	states := splitList(connState)
+	if len(states) == 0 {
+		return nil
+	}
+
+	return []string{"-m", "conntrack", "--ctstate", strings.ToUpper(strings.Join(states, ","))}
+}
+
+// TCPFlagsMatch returns the match of tcp flags, such as syn, which requires the protocol tcp.
+func TCPFlagsMatch(flags string) []string {
+	return tcpFlagsMatches[strings.ToLower(flags)]
+}
+
+// splitList splits the list separated by comma, the empty items are ignored.
+func splitList(list string) []string {
+	items := make([]string, 0)
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); len(item) > 0 {
+			items = append(items, item)
+		}
+	}
+
+	return items
+}
+
 func (n *NetworkCommand) NeedApplyDNSServer() bool {
 	return len(n.DNSServer) > 0
 }
 
-func (n *NetworkCommand) ToChain() (*pb.Chain, error) {
-	return nil, nil
+// NeedFlap returns true if the device of flap attack should be brought down and up by turns,
+// otherwise it is kept down until the attack is recovered.
+func (n *NetworkCommand) NeedFlap() bool {
+	return len(n.FlapDownTime) > 0
+}
+
+// NeedApplyFakeDNSServer returns true if the fake DNS server should be started,
+// the DNS server in /etc/resolv.conf is updated to the address it listens on.
+func (n *NetworkCommand) NeedApplyFakeDNSServer() bool {
+	return len(n.DNSFault) > 0
+}
+
+// ToChains converts the partition or reject attack to iptables chains which drop or reject
+// the packets matching the ipset, every direction of the attack is converted to a chain
+// named by the direction and the given name.
+func (n *NetworkCommand) ToChains(name string, ipset string) ([]*pb.Chain, error) {
+	target := "DROP"
+	switch n.Action {
+	case NetworkPartitionAction:
+	case NetworkRejectAction:
+		target = "REJECT --reject-with " + n.RejectWith
+	case NetworkPacketAction:
+		// the delayed packets are marked by the mark chain instead
+		if n.PacketFault != PacketFaultDrop {
+			return nil, nil
+		}
+	default:
+		return nil, nil
+	}
+
+	// the statistic and conntrack matches are put before the protocol, because
+	// the ports are appended to the protocol by the chaos daemon
+	var statistic string
+	if (n.Action == NetworkRejectAction || n.Action == NetworkPacketAction) && len(n.Percent) > 0 {
+		percent, err := strconv.ParseFloat(n.Percent, 64)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		if percent < 100 {
+			statistic = fmt.Sprintf("-m statistic --mode random --probability %s",
+				strconv.FormatFloat(percent/100, 'f', -1, 64))
+		}
+	}
+
+	if connState := ConnStateMatch(n.ConnState); len(connState) > 0 {
+		statistic = strings.TrimSpace(statistic + " " + strings.Join(connState, " "))
+	}
+
+	// the packets with any of the tcp flags are dropped, every tcp flags is matched by a chain
+	flagsList := splitList(n.TCPFlags)
+	if len(flagsList) == 0 {
+		flagsList = []string{""}
+	}
+
+	var directions []pb.Chain_Direction
+	switch n.Direction {
+	case NetworkDirectionIngress:
+		directions = []pb.Chain_Direction{pb.Chain_INPUT}
+	case NetworkDirectionEgress:
+		directions = []pb.Chain_Direction{pb.Chain_OUTPUT}
+	case NetworkDirectionBoth:
+		directions = []pb.Chain_Direction{pb.Chain_INPUT, pb.Chain_OUTPUT}
+	default:
+		return nil, errors.Errorf("direction %s not supported", n.Direction)
+	}
+
+	chains := make([]*pb.Chain, 0, len(directions)*len(flagsList))
+	for _, direction := range directions {
+		for _, flags := range flagsList {
+			chains = append(chains, n.toChain(fmt.Sprintf("%s/%s", direction.String(), name), direction, ipset, target, statistic, flags))
+		}
+	}
+
+	return chains, nil
+}
+
+// toChain returns the chain of the direction, the chain is named with the tcp flags if it is set.
+func (n *NetworkCommand) toChain(name string, direction pb.Chain_Direction, ipset string, target string, statistic string, flags string) *pb.Chain {
+	chain := &pb.Chain{
+		Name:      name,
+		Direction: direction,
+		Ipsets:    []string{ipset},
+		Target:    target,
+		Protocol:  statistic,
+	}
+
+	if len(n.IPProtocol) > 0 {
+		chain.Protocol = strings.TrimSpace(fmt.Sprintf("%s --protocol %s", statistic, n.IPProtocol))
+	}
+
+	if len(flags) > 0 {
+		chain.Name = fmt.Sprintf("%s/%s", name, strings.ToLower(flags))
+		chain.Protocol = fmt.Sprintf("%s %s", chain.Protocol, strings.Join(TCPFlagsMatch(flags), " "))
+	}
+
+	if len(n.SourcePort) > 0 {
+		chain.SourcePorts = fmt.Sprintf("--source-port %s", n.SourcePort)
+		if strings.Contains(n.SourcePort, ",") {
+			chain.SourcePorts = fmt.Sprintf("-m multiport --source-ports %s", n.SourcePort)
+		}
+	}
+
+	if len(n.EgressPort) > 0 {
+		chain.DestinationPorts = fmt.Sprintf("--destination-port %s", n.EgressPort)
+		if strings.Contains(n.EgressPort, ",") {
+			chain.DestinationPorts = fmt.Sprintf("-m multiport --destination-ports %s", n.EgressPort)
+		}
+	}
+
+	return chain
 }
 
 func NewNetworkCommand() *NetworkCommand {
@@ -16,6 +16,7 @@ package core
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"math"
 	"strconv"
 	"strings"
@@ -35,14 +36,33 @@ type IPSetRuleStore interface {
 	DeleteByExperiment(ctx context.Context, experiment string) error
 }
 
+const (
+	// FamilyIPv4 is the family of IPv4 ipsets and iptables rules,
+	// the rules recorded without family belong to it.
+	FamilyIPv4 = "inet"
+	// FamilyIPv6 is the family of IPv6 ipsets and ip6tables rules.
+	FamilyIPv6 = "inet6"
+)
+
+// IPv6SetName returns the name of ipset which contains the IPv6 cidrs of the ipset,
+// because an ipset can only contain the addresses of one family.
+func IPv6SetName(name string) string {
+	return name + "-6"
+}
+
 type IPSetRule struct {
 	gorm.Model
 	// The name of ipset
 	Name string `gorm:"index:name" json:"name"`
 	// The contents of ipset
 	Cidrs string `json:"cidrs"`
+	// The family of ipset, inet or inet6
+	Family string `json:"family,omitempty"`
 	// Experiment represents the experiment which the rule belong to.
 	Experiment string `gorm:"index:experiment" json:"experiment"`
+	// ContainerID is the id of container in whose network namespace the rule is applied,
+	// it is empty if the rule is applied on the host.
+	ContainerID string `json:"container_id,omitempty"`
 }
 
 type Cidr struct {
@@ -57,6 +77,7 @@ type IptablesRuleStore interface {
 	List(ctx context.Context) ([]*IptablesRule, error)
 	Set(ctx context.Context, rule *IptablesRule) error
 	FindByExperiment(ctx context.Context, experiment string) ([]*IptablesRule, error)
+	FindByContainerID(ctx context.Context, containerID string) ([]*IptablesRule, error)
 	DeleteByExperiment(ctx context.Context, experiment string) error
 }
 
@@ -68,23 +89,91 @@ type IptablesRule struct {
 	IPSets string `json:"ipsets"`
 	// The block direction of this iptables rule
 	Direction string `json:"direction"`
+	// The family of this rule, the rule of inet6 family is set by ip6tables
+	Family string `json:"family,omitempty"`
 	// Experiment represents the experiment which the rule belong to.
 	Experiment string `gorm:"index:experiment" json:"experiment"`
+	// ContainerID is the id of container in whose network namespace the rule is applied,
+	// it is empty if the rule is applied on the host.
+	ContainerID string `json:"container_id,omitempty"`
+
+	// The matching options of protocol and ports, such as `--protocol tcp`,
+	// the statistic and conntrack matches and the tcp flags are put in the Protocol too.
+	Protocol         string `json:"protocol,omitempty"`
+	SourcePorts      string `json:"source_ports,omitempty"`
+	DestinationPorts string `json:"destination_ports,omitempty"`
+	// The target of the rule, such as `REJECT --reject-with tcp-reset`, it's DROP if empty.
+	Target string `json:"target,omitempty"`
 }
 
 func (i *IptablesRule) ToChain() *pb.Chain {
 	ch := &pb.Chain{
-		Name:      i.Name,
-		Ipsets:    strings.Split(i.IPSets, ","),
-		Direction: pb.Chain_Direction(pb.Chain_Direction_value[i.Direction]),
-		Target:    "DROP",
+		Name:             i.Name,
+		Ipsets:           strings.Split(i.IPSets, ","),
+		Direction:        pb.Chain_Direction(pb.Chain_Direction_value[i.Direction]),
+		Target:           i.target(),
+		Protocol:         i.protocol(),
+		SourcePorts:      i.SourcePorts,
+		DestinationPorts: i.DestinationPorts,
 	}
 
 	return ch
 }
 
+// target returns the target of the rule, the ICMP types of REJECT are
+// replaced by the ICMPv6 types for the rule of inet6 family.
+func (i *IptablesRule) target() string {
+	if len(i.Target) == 0 {
+		return "DROP"
+	}
+
+	if i.Family != FamilyIPv6 {
+		return i.Target
+	}
+
+	return strings.NewReplacer(
+		RejectWithPortUnreachable, "icmp6-port-unreachable",
+		RejectWithHostUnreachable, "icmp6-addr-unreachable",
+	).Replace(i.Target)
+}
+
+// protocol returns the matching options of protocol, the icmp protocol is replaced by
+// ipv6-icmp for the rule of inet6 family, because ICMPv6 is another protocol.
+func (i *IptablesRule) protocol() string {
+	if i.Family != FamilyIPv6 {
+		return i.Protocol
+	}
+
+	return IPv6Protocol(i.Protocol)
+}
+
+// IPv6Protocol replaces the icmp protocol in the matching options by ipv6-icmp.
+func IPv6Protocol(options string) string {
+	args := strings.Fields(options)
+	for n := 1; n < len(args); n++ {
+		if (args[n-1] == "--protocol" || args[n-1] == "-p") && args[n] == "icmp" {
+			args[n] = "ipv6-icmp"
+		}
+	}
+
+	return strings.Join(args, " ")
+}
+
 type IptablesRuleList []*IptablesRule
 
+// SplitByFamily splits the rules into the rules set by iptables and the rules set by ip6tables.
+func (l IptablesRuleList) SplitByFamily() (ipv4 IptablesRuleList, ipv6 IptablesRuleList) {
+	for _, rule := range l {
+		if rule.Family == FamilyIPv6 {
+			ipv6 = append(ipv6, rule)
+		} else {
+			ipv4 = append(ipv4, rule)
+		}
+	}
+
+	return
+}
+
 func (l IptablesRuleList) ToChains() []*pb.Chain {
 	chains := make([]*pb.Chain, 0)
 
@@ -97,11 +186,15 @@ func (l IptablesRuleList) ToChains() []*pb.Chain {
 
 type TCRuleStore interface {
 	List(ctx context.Context) ([]*TCRule, error)
-	ListGroupDevice(ctx context.Context) (map[string][]*TCRule, error)
+	// ListGroupDevice lists the tc rules applied in the network namespace of the container, grouped by device.
+	ListGroupDevice(ctx context.Context, containerID string) (map[string][]*TCRule, error)
 	Set(ctx context.Context, rule *TCRule) error
-	FindByDevice(ctx context.Context, experiment string) ([]*TCRule, error)
+	FindByDevice(ctx context.Context, containerID string, device string) ([]*TCRule, error)
+	FindByIngressDevice(ctx context.Context, containerID string, device string) ([]*TCRule, error)
+	FindByEgressDevice(ctx context.Context, containerID string, device string) ([]*TCRule, error)
 	FindByExperiment(ctx context.Context, experiment string) ([]*TCRule, error)
 	DeleteByExperiment(ctx context.Context, experiment string) error
+	Delete(ctx context.Context, rule *TCRule) error
 }
 
 type TCRule struct {
@@ -114,6 +207,26 @@ type TCRule struct {
 	IPSet string `json:"ipset,omitempty"`
 	// Experiment represents the experiment which the rule belong to.
 	Experiment string `gorm:"index:experiment" json:"experiment"`
+	// IngressDevice is the device whose ingress traffic is redirected to Device,
+	// it is empty if the rule only impacts the egress traffic of Device.
+	IngressDevice string `json:"ingress_device,omitempty"`
+	// EgressDevice is the device whose egress traffic with the Mark is redirected to Device,
+	// it is set if the rule only impacts the packets sent by the Cgroup, or the packets with
+	// the TCPFlags and in the ConnState.
+	EgressDevice string `json:"egress_device,omitempty"`
+	// Cgroup is the path of cgroup v2 whose packets are marked with the Mark by iptables.
+	Cgroup string `json:"cgroup,omitempty"`
+	Mark   uint32 `json:"mark,omitempty"`
+	// TCPFlags and ConnState select the packets marked with the Mark, the TCPFlags are separated
+	// by comma and the packets with any of them are marked.
+	TCPFlags  string `json:"tcp_flags,omitempty"`
+	ConnState string `json:"conn_state,omitempty"`
+	// ClsactCreated is true if the clsact qdisc of the IngressDevice or EgressDevice is created by
+	// chaosd, it's passed to another rule redirecting the traffic of the device when the rule is deleted.
+	ClsactCreated bool `json:"clsact_created,omitempty"`
+	// ContainerID is the id of container in whose network namespace the rule is applied,
+	// it is empty if the rule is applied on the host.
+	ContainerID string `json:"container_id,omitempty"`
 
 	Protocal   string
 	SourcePort string
@@ -121,11 +234,14 @@ type TCRule struct {
 }
 
 func (t *TCRule) ToTC() (*pb.Tc, error) {
-	tc := &pb.Tc{
-		Ipset:      t.IPSet,
-		Protocol:   t.Protocal,
-		SourcePort: t.SourcePort,
-		EgressPort: t.EgressPort,
+	tc := &pb.Tc{}
+	// the traffic has been filtered when it is redirected to the
+	// ifb device, so the rule applied on the ifb device needs no filter.
+	if len(t.IngressDevice) == 0 && len(t.EgressDevice) == 0 {
+		tc.Ipset = t.IPSet
+		tc.Protocol = t.Protocal
+		tc.SourcePort = t.SourcePort
+		tc.EgressPort = t.EgressPort
 	}
 
 	tcp := &TcParameter{}
@@ -155,6 +271,20 @@ func (t *TCRule) ToTC() (*pb.Tc, error) {
 	return tc, nil
 }
 
+// ToNetemArgs returns the full arguments of netem for the rule, see TcParameter.ToNetemArgs.
+func (t *TCRule) ToNetemArgs() ([]string, error) {
+	if t.Type != pb.Tc_NETEM.String() {
+		return nil, nil
+	}
+
+	tcp := &TcParameter{}
+	if err := json.Unmarshal([]byte(t.TC), tcp); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return tcp.ToNetemArgs()
+}
+
 type TCRuleList []*TCRule
 
 func (t TCRuleList) ToTCs() ([]*pb.Tc, error) {
@@ -171,6 +301,22 @@ func (t TCRuleList) ToTCs() ([]*pb.Tc, error) {
 	return tcs, nil
 }
 
+// ToNetemArgs returns the full arguments of netem for every rule in order,
+// the arguments are nil for the rules set by the chaos daemon entirely.
+func (t TCRuleList) ToNetemArgs() ([][]string, error) {
+	netemArgs := make([][]string, 0, len(t))
+	for _, rule := range t {
+		args, err := rule.ToNetemArgs()
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		netemArgs = append(netemArgs, args)
+	}
+
+	return netemArgs, nil
+}
+
 // TcParameter represents the parameters for a traffic control chaos
 type TcParameter struct {
 	Device string
@@ -192,6 +338,26 @@ type DelaySpec struct {
 	Correlation string       `json:"correlation,omitempty"`
 	Jitter      string       `json:"jitter,omitempty"`
 	Reorder     *ReorderSpec `json:"reorder,omitempty"`
+	// Distribution is the distribution of the jitter, such as normal or pareto,
+	// the jitter is uniformly distributed if it is empty.
+	Distribution string `json:"distribution,omitempty"`
+	// Rate limits the rate of packets like a slow link. Allows bps, kbps, mbps, gbps,
+	// tbps unit. bps means bytes per second. PacketOverhead is the bytes added to the
+	// size of every packet when the rate is calculated, it may be negative.
+	Rate           string    `json:"rate,omitempty"`
+	PacketOverhead int       `json:"packet_overhead,omitempty"`
+	Slot           *SlotSpec `json:"slot,omitempty"`
+}
+
+// SlotSpec defines the slots in which the packets are sent in bursts,
+// like the transmission opportunities of Wi-Fi and cellular networks.
+type SlotSpec struct {
+	// MinDelay and MaxDelay are the range of the time between two slots.
+	MinDelay string `json:"min_delay"`
+	MaxDelay string `json:"max_delay,omitempty"`
+	// Packets and Bytes limit the packets and bytes sent in one slot.
+	Packets int `json:"packets,omitempty"`
+	Bytes   int `json:"bytes,omitempty"`
 }
 
 // ToNetem implements Netem interface.
@@ -235,6 +401,60 @@ func (in *DelaySpec) ToNetem() (*pb.Netem, error) {
 	return netem, nil
 }
 
+// needNetemArgs returns true if the delay uses the parameters of netem which
+// are not supported by the chaos daemon.
+func (in *DelaySpec) needNetemArgs() bool {
+	return (len(in.Distribution) > 0 && in.Distribution != DistributionUniform) ||
+		len(in.Rate) > 0 || in.Slot != nil
+}
+
+// netemArgs returns the arguments of netem for the parameters not supported by the chaos daemon.
+func (in *DelaySpec) netemArgs() ([]string, error) {
+	var args []string
+	if len(in.Distribution) > 0 && in.Distribution != DistributionUniform {
+		args = append(args, "distribution", in.Distribution)
+	}
+
+	if len(in.Rate) > 0 {
+		rate, err := convertUnitToBytes(in.Rate)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		args = append(args, "rate", fmt.Sprintf("%dbps", rate))
+		if in.PacketOverhead != 0 {
+			args = append(args, strconv.Itoa(in.PacketOverhead))
+		}
+	}
+
+	if in.Slot != nil {
+		minDelay, err := time.ParseDuration(in.Slot.MinDelay)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		args = append(args, "slot", fmt.Sprintf("%dus", minDelay.Microseconds()))
+		if len(in.Slot.MaxDelay) > 0 {
+			maxDelay, err := time.ParseDuration(in.Slot.MaxDelay)
+			if err != nil {
+				return nil, errors.WithStack(err)
+			}
+
+			args = append(args, fmt.Sprintf("%dus", maxDelay.Microseconds()))
+		}
+
+		if in.Slot.Packets > 0 {
+			args = append(args, "packets", strconv.Itoa(in.Slot.Packets))
+		}
+
+		if in.Slot.Bytes > 0 {
+			args = append(args, "bytes", strconv.Itoa(in.Slot.Bytes))
+		}
+	}
+
+	return args, nil
+}
+
 // ReorderSpec defines details of packet reorder.
 type ReorderSpec struct {
 	Reorder     string `json:"reorder"`
@@ -246,10 +466,19 @@ type ReorderSpec struct {
 type LossSpec struct {
 	Loss        string `json:"loss"`
 	Correlation string `json:"correlation"`
+	// Model is the model of bursty loss, such as state or gemodel, the packets are lost
+	// by the Probabilities of the model instead of the Loss if it is set.
+	Model         string   `json:"model,omitempty"`
+	Probabilities []string `json:"probabilities,omitempty"`
 }
 
 // ToNetem implements Netem interface.
 func (in *LossSpec) ToNetem() (*pb.Netem, error) {
+	// the chaos daemon doesn't support the loss model, see TcParameter.ToNetemArgs
+	if len(in.Model) > 0 {
+		return lossModelNetem(), nil
+	}
+
 	lossPercentage, err := strconv.ParseFloat(in.Loss, 32)
 	if err != nil {
 		return nil, errors.WithStack(err)
@@ -266,6 +495,16 @@ func (in *LossSpec) ToNetem() (*pb.Netem, error) {
 	}, nil
 }
 
+// netemDefaultLimit is the default limit of netem qdisc in packets.
+const netemDefaultLimit = 1000
+
+// lossModelNetem returns the netem set by the chaos daemon for the loss model, which is
+// changed to the loss model by chaosd later. The chaos daemon can't set a netem without
+// any argument, so it's set with the default limit.
+func lossModelNetem() *pb.Netem {
+	return &pb.Netem{Limit: netemDefaultLimit}
+}
+
 // DuplicateSpec defines detail of a duplicate action
 type DuplicateSpec struct {
 	Duplicate   string `json:"duplicate"`
@@ -429,6 +668,91 @@ func toNetem(spec *TcParameter) (*pb.Netem, error) {
 	return merged, nil
 }
 
+// ToNetemArgs returns the full arguments of netem for the tc parameter, or nil if
+// the netem qdisc set by the chaos daemon is enough. The chaos daemon doesn't support
+// some parameters of netem, such as the distribution of delay, so chaosd changes the
+// netem qdisc set by it with these arguments.
+func (in *TcParameter) ToNetemArgs() ([]string, error) {
+	needDelayArgs := in.Delay != nil && in.Delay.needNetemArgs()
+	needLossArgs := in.Loss != nil && len(in.Loss.Model) > 0
+	if !needDelayArgs && !needLossArgs {
+		return nil, nil
+	}
+
+	netem, err := toNetem(in)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	args := convertNetemToArgs(netem)
+	if needDelayArgs {
+		extra, err := in.Delay.netemArgs()
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		args = append(args, extra...)
+	}
+
+	if needLossArgs {
+		args = append(args, "loss", in.Loss.Model)
+		args = append(args, in.Loss.Probabilities...)
+	}
+
+	return args, nil
+}
+
+// convertNetemToArgs converts the netem to arguments like the chaos daemon does.
+func convertNetemToArgs(netem *pb.Netem) []string {
+	var args []string
+	if netem.Time > 0 {
+		args = append(args, "delay", strconv.FormatUint(uint64(netem.Time), 10))
+		if netem.Jitter > 0 {
+			args = append(args, strconv.FormatUint(uint64(netem.Jitter), 10))
+			if netem.DelayCorr > 0 {
+				args = append(args, formatNetemFloat(netem.DelayCorr))
+			}
+		}
+
+		if netem.Reorder > 0 {
+			args = append(args, "reorder", formatNetemFloat(netem.Reorder))
+			if netem.ReorderCorr > 0 {
+				args = append(args, formatNetemFloat(netem.ReorderCorr))
+			}
+
+			if netem.Gap > 0 {
+				args = append(args, "gap", strconv.FormatUint(uint64(netem.Gap), 10))
+			}
+		}
+	}
+
+	if netem.Limit > 0 {
+		args = append(args, "limit", strconv.FormatUint(uint64(netem.Limit), 10))
+	}
+
+	for _, em := range []struct {
+		name        string
+		percent     float32
+		correlation float32
+	}{
+		{"loss", netem.Loss, netem.LossCorr},
+		{"duplicate", netem.Duplicate, netem.DuplicateCorr},
+		{"corrupt", netem.Corrupt, netem.CorruptCorr},
+	} {
+		if em.percent > 0 {
+			args = append(args, em.name, formatNetemFloat(em.percent))
+			if em.correlation > 0 {
+				args = append(args, formatNetemFloat(em.correlation))
+			}
+		}
+	}
+
+	return args
+}
+
+func formatNetemFloat(f float32) string {
+	return strconv.FormatFloat(float64(f), 'f', 6, 32)
+}
+
 // mergeNetem merges two Netem protos into a new one.
 // REMEMBER to assign the return value, i.e. merged = utils.MergeNetm(merged, em)
 // For each field it takes the bigger value of the two.
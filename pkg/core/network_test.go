@@ -0,0 +1,1092 @@
+// Copyright 2021 Chaos Mesh Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+import (
+	"encoding/json"
+	"testing"
+
+	. "github.com/onsi/gomega"
+
+	"github.com/chaos-mesh/chaos-mesh/pkg/chaosdaemon/pb"
+)
+
+func TestNetworkCommand(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	testCases := []struct {
+		cmd    *NetworkCommand
+		errMsg string
+	}{
+		{
+			&NetworkCommand{
+				CommonAttackConfig: CommonAttackConfig{Action: NetworkBandwidthAction},
+				Device:             "eth0",
+			},
+			"rate, limit and buffer are required",
+		},
+		{
+			&NetworkCommand{
+				CommonAttackConfig: CommonAttackConfig{Action: NetworkBandwidthAction},
+				Rate:               "1abc",
+				Limit:              1,
+				Buffer:             1,
+				Device:             "eth0",
+			},
+			"rate 1abc not valid",
+		},
+		{
+			&NetworkCommand{
+				CommonAttackConfig: CommonAttackConfig{Action: NetworkBandwidthAction},
+				Rate:               "1mbps",
+				Limit:              1,
+				Buffer:             1,
+				Peakrate:           1,
+				Device:             "eth0",
+			},
+			"peakrate and minburst must be set together",
+		},
+		{
+			&NetworkCommand{
+				CommonAttackConfig: CommonAttackConfig{Action: NetworkBandwidthAction},
+				Rate:               "1mbps",
+				Limit:              1,
+				Buffer:             1,
+			},
+			"device is required",
+		},
+		{
+			&NetworkCommand{
+				CommonAttackConfig: CommonAttackConfig{Action: NetworkDelayAction},
+				Latency:            "10ms",
+				Device:             "eth0,all-non-loopback",
+			},
+			"device all-non-loopback can't be used with other devices",
+		},
+		{
+			&NetworkCommand{
+				CommonAttackConfig: CommonAttackConfig{Action: NetworkDelayAction},
+				Latency:            "10ms",
+				Device:             "eth0, eth0",
+			},
+			"device eth0 is duplicated",
+		},
+		{
+			&NetworkCommand{
+				CommonAttackConfig: CommonAttackConfig{Action: NetworkDelayAction},
+				Latency:            "10ms",
+				Device:             "eth0,bond0",
+			},
+			"",
+		},
+		{
+			&NetworkCommand{
+				CommonAttackConfig: CommonAttackConfig{Action: NetworkFlapAction},
+				Device:             "eth0,eth1",
+			},
+			"flap attack only supports one device",
+		},
+		{
+			&NetworkCommand{
+				CommonAttackConfig: CommonAttackConfig{Action: NetworkBandwidthAction},
+				Rate:               "1mbps",
+				Limit:              1,
+				Buffer:             1,
+				Device:             "eth0",
+			},
+			"",
+		},
+		{
+			&NetworkCommand{
+				CommonAttackConfig: CommonAttackConfig{Action: NetworkReorderAction},
+				Percent:            "10",
+				Device:             "eth0",
+			},
+			"latency is required",
+		},
+		{
+			&NetworkCommand{
+				CommonAttackConfig: CommonAttackConfig{Action: NetworkReorderAction},
+				Latency:            "10ms",
+				Percent:            "10",
+				Gap:                -1,
+				Device:             "eth0",
+			},
+			"gap -1 not valid",
+		},
+		{
+			&NetworkCommand{
+				CommonAttackConfig: CommonAttackConfig{Action: NetworkReorderAction},
+				Latency:            "10ms",
+				Percent:            "10",
+				Correlation:        "50",
+				Gap:                5,
+				Device:             "eth0",
+			},
+			"",
+		},
+		{
+			&NetworkCommand{
+				CommonAttackConfig: CommonAttackConfig{Action: NetworkLossAction},
+				Percent:            "10",
+				Device:             "eth0",
+				Direction:          "up",
+			},
+			"direction up not valid",
+		},
+		{
+			&NetworkCommand{
+				CommonAttackConfig: CommonAttackConfig{Action: NetworkLossAction},
+				Percent:            "10",
+				Device:             "eth0",
+				IPProtocol:         "tcp",
+				Direction:          NetworkDirectionIngress,
+			},
+			"protocol and ports are not supported when direction is ingress",
+		},
+		{
+			&NetworkCommand{
+				CommonAttackConfig: CommonAttackConfig{Action: NetworkLossAction},
+				Percent:            "10",
+				Device:             "eth0",
+				IPAddress:          "172.16.4.4",
+				Direction:          NetworkDirectionBoth,
+			},
+			"",
+		},
+		{
+			&NetworkCommand{
+				CommonAttackConfig: CommonAttackConfig{Action: NetworkNetemAction},
+				Device:             "eth0",
+			},
+			"at least one of latency, loss, corrupt, duplicate and reorder is required",
+		},
+		{
+			&NetworkCommand{
+				CommonAttackConfig: CommonAttackConfig{Action: NetworkNetemAction},
+				Reorder:            "10",
+				Device:             "eth0",
+			},
+			"latency is required when reorder is set",
+		},
+		{
+			&NetworkCommand{
+				CommonAttackConfig: CommonAttackConfig{Action: NetworkNetemAction},
+				Loss:               "101",
+				Device:             "eth0",
+			},
+			"loss 101 not valid",
+		},
+		{
+			&NetworkCommand{
+				CommonAttackConfig: CommonAttackConfig{Action: NetworkNetemAction},
+				Latency:            "100ms",
+				Loss:               "5",
+				Reorder:            "10",
+				Device:             "eth0",
+			},
+			"",
+		},
+		{
+			&NetworkCommand{
+				CommonAttackConfig: CommonAttackConfig{Action: NetworkLossAction},
+				Percent:            "10",
+				Device:             "eth0",
+				ContainerID:        "2f7e3a6b9c1d",
+			},
+			"container id 2f7e3a6b9c1d not valid",
+		},
+		{
+			&NetworkCommand{
+				CommonAttackConfig: CommonAttackConfig{Action: NetworkDNSAction},
+				DNSServer:          "123.123.123.123",
+				ContainerID:        "docker://2f7e3a6b9c1d",
+			},
+			"container id is not supported by network dns attack",
+		},
+		{
+			&NetworkCommand{
+				CommonAttackConfig: CommonAttackConfig{Action: NetworkLossAction},
+				Percent:            "10",
+				Device:             "eth0",
+				ContainerID:        "containerd://2f7e3a6b9c1d",
+			},
+			"",
+		},
+		{
+			&NetworkCommand{
+				CommonAttackConfig: CommonAttackConfig{Action: NetworkLossAction},
+				Percent:            "10",
+				Device:             "eth0",
+				Pid:                1024,
+				Cgroup:             "/system.slice/nginx.service",
+			},
+			"pid and cgroup can't be set at the same time",
+		},
+		{
+			&NetworkCommand{
+				CommonAttackConfig: CommonAttackConfig{Action: NetworkLossAction},
+				Percent:            "10",
+				Device:             "eth0",
+				Cgroup:             "system.slice/nginx.service",
+			},
+			"cgroup system.slice/nginx.service not valid",
+		},
+		{
+			&NetworkCommand{
+				CommonAttackConfig: CommonAttackConfig{Action: NetworkLossAction},
+				Percent:            "10",
+				Device:             "eth0",
+				Cgroup:             "/",
+			},
+			"cgroup / not valid, the root cgroup can't be selected",
+		},
+		{
+			&NetworkCommand{
+				CommonAttackConfig: CommonAttackConfig{Action: NetworkPartitionAction},
+				IPAddress:          "172.16.4.4",
+				Pid:                1024,
+			},
+			"pid and cgroup are not supported by network partition attack",
+		},
+		{
+			&NetworkCommand{
+				CommonAttackConfig: CommonAttackConfig{Action: NetworkLossAction},
+				Percent:            "10",
+				Device:             "eth0",
+				Direction:          NetworkDirectionBoth,
+				Pid:                1024,
+			},
+			"pid and cgroup are not supported when direction is both",
+		},
+		{
+			&NetworkCommand{
+				CommonAttackConfig: CommonAttackConfig{Action: NetworkLossAction},
+				Percent:            "10",
+				Device:             "eth0",
+				Direction:          NetworkDirectionEgress,
+				Cgroup:             "/system.slice/nginx.service",
+				IPProtocol:         "tcp",
+				EgressPort:         "80",
+			},
+			"",
+		},
+		{
+			&NetworkCommand{
+				CommonAttackConfig: CommonAttackConfig{Action: NetworkDNSAction},
+				DNSServer:          "127.0.0.1",
+				DNSFault:           "refused",
+			},
+			"DNS fault refused not supported",
+		},
+		{
+			&NetworkCommand{
+				CommonAttackConfig: CommonAttackConfig{Action: NetworkDNSAction},
+				DNSServer:          "127.0.0.1",
+				DNSFault:           "wrong",
+				DNSPatterns:        "*.example.com",
+			},
+			"DNS answer  not valid",
+		},
+		{
+			&NetworkCommand{
+				CommonAttackConfig: CommonAttackConfig{Action: NetworkDNSAction},
+				DNSServer:          "127.0.0.1",
+				DNSPatterns:        "*.example.com",
+			},
+			"DNS fault is required",
+		},
+		{
+			&NetworkCommand{
+				CommonAttackConfig: CommonAttackConfig{Action: NetworkDNSAction},
+				DNSServer:          "127.0.0.1",
+				DNSFault:           "slow",
+				DNSDelay:           "1s",
+				DNSUpstream:        "127.0.0.1",
+			},
+			"DNS upstream can't be the address of the fake DNS server",
+		},
+		{
+			&NetworkCommand{
+				CommonAttackConfig: CommonAttackConfig{Action: NetworkDNSAction},
+				DNSServer:          "127.0.0.1",
+				DNSFault:           "wrong",
+				DNSPatterns:        "*.example.com",
+				DNSAnswer:          "10.0.0.1",
+				DNSUpstream:        "8.8.8.8",
+			},
+			"",
+		},
+		{
+			&NetworkCommand{
+				CommonAttackConfig: CommonAttackConfig{Action: NetworkDNSAction},
+				DNSServer:          "123.123.123.123",
+				DNSHost:            "chaos-mesh.org,www.example.com",
+				DNSIp:              "10.0.0.1",
+			},
+			"DNS host chaos-mesh.org,www.example.com must match a DNS ip 10.0.0.1",
+		},
+		{
+			&NetworkCommand{
+				CommonAttackConfig: CommonAttackConfig{Action: NetworkDNSAction},
+				DNSServer:          "123.123.123.123",
+				DNSHost:            "chaos-mesh.org",
+				DNSIp:              "10.0.0.0/8",
+			},
+			"ip addresse 10.0.0.0/8 not valid",
+		},
+		{
+			&NetworkCommand{
+				CommonAttackConfig: CommonAttackConfig{Action: NetworkDNSAction},
+				DNSServer:          "123.123.123.123",
+				DNSHost:            "chaos-mesh.org,www.example.com",
+				DNSIp:              "10.0.0.1,2001:db8::1",
+			},
+			"",
+		},
+		{
+			&NetworkCommand{
+				CommonAttackConfig: CommonAttackConfig{Action: NetworkPortOccupied},
+				Port:               "8080:8070",
+				IPProtocol:         "tcp",
+				PortOccupyMode:     "accept",
+			},
+			"port 8080:8070 not valid",
+		},
+		{
+			&NetworkCommand{
+				CommonAttackConfig: CommonAttackConfig{Action: NetworkPortOccupied},
+				Port:               "8080",
+				IPProtocol:         "icmp",
+				PortOccupyMode:     "accept",
+			},
+			"protocol icmp not supported by port occupied attack",
+		},
+		{
+			&NetworkCommand{
+				CommonAttackConfig: CommonAttackConfig{Action: NetworkPortOccupied},
+				Port:               "8080",
+				IPProtocol:         "udp",
+				PortOccupyMode:     "connect",
+			},
+			"port occupy mode connect not supported",
+		},
+		{
+			&NetworkCommand{
+				CommonAttackConfig: CommonAttackConfig{Action: NetworkPortOccupied},
+				Port:               "8080,9000:9010",
+				IPProtocol:         "all",
+				PortOccupyMode:     "bind",
+			},
+			"",
+		},
+		{
+			&NetworkCommand{
+				CommonAttackConfig: CommonAttackConfig{Action: NetworkFlapAction},
+			},
+			"device is required",
+		},
+		{
+			&NetworkCommand{
+				CommonAttackConfig: CommonAttackConfig{Action: NetworkFlapAction},
+				Device:             "eth0",
+				FlapDownTime:       "5s",
+			},
+			"up time is required",
+		},
+		{
+			&NetworkCommand{
+				CommonAttackConfig: CommonAttackConfig{Action: NetworkFlapAction},
+				Device:             "eth0",
+				FlapDownTime:       "5s",
+				FlapUpTime:         "-1s",
+			},
+			"up time -1s not valid",
+		},
+		{
+			&NetworkCommand{
+				CommonAttackConfig: CommonAttackConfig{Action: NetworkFlapAction},
+				Device:             "eth0",
+				FlapDownTime:       "5s",
+				FlapUpTime:         "10s",
+			},
+			"",
+		},
+		{
+			&NetworkCommand{
+				CommonAttackConfig: CommonAttackConfig{Action: NetworkFlapAction},
+				Device:             "eth0",
+			},
+			"",
+		},
+		{
+			&NetworkCommand{
+				CommonAttackConfig: CommonAttackConfig{Action: NetworkPartitionAction},
+				Direction:          NetworkDirectionBoth,
+			},
+			"ip address or hostname is required",
+		},
+		{
+			&NetworkCommand{
+				CommonAttackConfig: CommonAttackConfig{Action: NetworkPartitionAction},
+				IPAddress:          "172.16.4.4",
+				Direction:          "up",
+			},
+			"direction up not valid",
+		},
+		{
+			&NetworkCommand{
+				CommonAttackConfig: CommonAttackConfig{Action: NetworkPartitionAction},
+				IPAddress:          "172.16.4.4",
+				Direction:          NetworkDirectionIngress,
+				EgressPort:         "80",
+			},
+			"ip protocol is required",
+		},
+		{
+			&NetworkCommand{
+				CommonAttackConfig: CommonAttackConfig{Action: NetworkPartitionAction},
+				IPAddress:          "172.16.4.4",
+				Direction:          NetworkDirectionBoth,
+			},
+			"",
+		},
+		{
+			&NetworkCommand{
+				CommonAttackConfig: CommonAttackConfig{Action: NetworkRejectAction},
+				Direction:          NetworkDirectionEgress,
+				RejectWith:         RejectWithPortUnreachable,
+			},
+			"ip address or hostname is required",
+		},
+		{
+			&NetworkCommand{
+				CommonAttackConfig: CommonAttackConfig{Action: NetworkRejectAction},
+				IPAddress:          "172.16.4.4",
+				IPProtocol:         "udp",
+				Direction:          NetworkDirectionEgress,
+				RejectWith:         RejectWithTCPReset,
+			},
+			"reject with tcp-reset can only be used with protocol tcp",
+		},
+		{
+			&NetworkCommand{
+				CommonAttackConfig: CommonAttackConfig{Action: NetworkRejectAction},
+				IPAddress:          "172.16.4.4",
+				Direction:          NetworkDirectionEgress,
+				RejectWith:         "icmp-net-unreachable",
+			},
+			"reject with icmp-net-unreachable not supported",
+		},
+		{
+			&NetworkCommand{
+				CommonAttackConfig: CommonAttackConfig{Action: NetworkRejectAction},
+				IPAddress:          "172.16.4.4",
+				Direction:          NetworkDirectionEgress,
+				RejectWith:         RejectWithHostUnreachable,
+				Percent:            "120",
+			},
+			"percent 120 not valid",
+		},
+		{
+			&NetworkCommand{
+				CommonAttackConfig: CommonAttackConfig{Action: NetworkRejectAction},
+				IPAddress:          "172.16.4.4",
+				IPProtocol:         "tcp",
+				EgressPort:         "80",
+				Direction:          NetworkDirectionBoth,
+				RejectWith:         RejectWithTCPReset,
+				Percent:            "50",
+			},
+			"",
+		},
+		{
+			&NetworkCommand{
+				CommonAttackConfig: CommonAttackConfig{Action: NetworkPacketAction},
+				IPAddress:          "172.16.4.4",
+				Direction:          NetworkDirectionEgress,
+				PacketFault:        PacketFaultDrop,
+			},
+			"tcp flags or connection state is required",
+		},
+		{
+			&NetworkCommand{
+				CommonAttackConfig: CommonAttackConfig{Action: NetworkPacketAction},
+				IPAddress:          "172.16.4.4",
+				IPProtocol:         "tcp",
+				TCPFlags:           "syn,psh",
+				Direction:          NetworkDirectionEgress,
+				PacketFault:        PacketFaultDrop,
+			},
+			"tcp flags psh not supported",
+		},
+		{
+			&NetworkCommand{
+				CommonAttackConfig: CommonAttackConfig{Action: NetworkPacketAction},
+				IPAddress:          "172.16.4.4",
+				IPProtocol:         "udp",
+				TCPFlags:           "syn",
+				Direction:          NetworkDirectionEgress,
+				PacketFault:        PacketFaultDrop,
+			},
+			"tcp flags can only be used with protocol tcp",
+		},
+		{
+			&NetworkCommand{
+				CommonAttackConfig: CommonAttackConfig{Action: NetworkPacketAction},
+				IPAddress:          "172.16.4.4",
+				ConnState:          "NEW,CLOSED",
+				Direction:          NetworkDirectionEgress,
+				PacketFault:        PacketFaultDrop,
+			},
+			"connection state CLOSED not supported",
+		},
+		{
+			&NetworkCommand{
+				CommonAttackConfig: CommonAttackConfig{Action: NetworkPacketAction},
+				IPProtocol:         "tcp",
+				TCPFlags:           "syn",
+				Direction:          NetworkDirectionEgress,
+				PacketFault:        PacketFaultDrop,
+			},
+			"ip address or hostname is required when action is packet",
+		},
+		{
+			&NetworkCommand{
+				CommonAttackConfig: CommonAttackConfig{Action: NetworkPacketAction},
+				IPAddress:          "172.16.4.4",
+				IPProtocol:         "tcp",
+				TCPFlags:           "fin,rst",
+				Direction:          NetworkDirectionEgress,
+				PacketFault:        "reorder",
+			},
+			"packet fault reorder not supported",
+		},
+		{
+			&NetworkCommand{
+				CommonAttackConfig: CommonAttackConfig{Action: NetworkPacketAction},
+				IPAddress:          "172.16.4.4",
+				IPProtocol:         "tcp",
+				TCPFlags:           "syn",
+				Direction:          NetworkDirectionIngress,
+				PacketFault:        PacketFaultDelay,
+				Latency:            "100ms",
+				Device:             "eth0",
+			},
+			"packet fault delay is not supported when direction is ingress",
+		},
+		{
+			&NetworkCommand{
+				CommonAttackConfig: CommonAttackConfig{Action: NetworkPacketAction},
+				IPAddress:          "172.16.4.4",
+				IPProtocol:         "tcp",
+				TCPFlags:           "syn",
+				EgressPort:         "5432",
+				ConnState:          "new",
+				Direction:          NetworkDirectionBoth,
+				PacketFault:        PacketFaultDrop,
+			},
+			"",
+		},
+		{
+			&NetworkCommand{
+				CommonAttackConfig: CommonAttackConfig{Action: NetworkPacketAction},
+				IPAddress:          "172.16.4.4",
+				IPProtocol:         "tcp",
+				TCPFlags:           "fin,rst",
+				Direction:          NetworkDirectionEgress,
+				PacketFault:        PacketFaultDelay,
+				Latency:            "100ms",
+				Device:             "eth0",
+			},
+			"",
+		},
+		{
+			&NetworkCommand{
+				CommonAttackConfig: CommonAttackConfig{Action: NetworkDelayAction},
+				Latency:            "10ms",
+				Jitter:             "0ms",
+				Correlation:        "0",
+				Distribution:       DistributionNormal,
+				Device:             "eth0",
+			},
+			"distribution normal requires jitter",
+		},
+		{
+			&NetworkCommand{
+				CommonAttackConfig: CommonAttackConfig{Action: NetworkDelayAction},
+				Latency:            "10ms",
+				Jitter:             "5ms",
+				Correlation:        "0",
+				Distribution:       "gaussian",
+				Device:             "eth0",
+			},
+			"distribution gaussian not supported",
+		},
+		{
+			&NetworkCommand{
+				CommonAttackConfig: CommonAttackConfig{Action: NetworkDelayAction},
+				Latency:            "10ms",
+				Correlation:        "0",
+				DelayRate:          "1mbit",
+				Device:             "eth0",
+			},
+			"rate 1mbit not valid",
+		},
+		{
+			&NetworkCommand{
+				CommonAttackConfig: CommonAttackConfig{Action: NetworkDelayAction},
+				Latency:            "10ms",
+				Correlation:        "0",
+				PacketOverhead:     -20,
+				Device:             "eth0",
+			},
+			"packet overhead requires rate",
+		},
+		{
+			&NetworkCommand{
+				CommonAttackConfig: CommonAttackConfig{Action: NetworkDelayAction},
+				Latency:            "10ms",
+				Correlation:        "0",
+				SlotPackets:        10,
+				Device:             "eth0",
+			},
+			"slot is required",
+		},
+		{
+			&NetworkCommand{
+				CommonAttackConfig: CommonAttackConfig{Action: NetworkDelayAction},
+				Latency:            "10ms",
+				Correlation:        "0",
+				Slot:               "10ms",
+				SlotMax:            "5ms",
+				Device:             "eth0",
+			},
+			"slot max 5ms not valid",
+		},
+		{
+			&NetworkCommand{
+				CommonAttackConfig: CommonAttackConfig{Action: NetworkDelayAction},
+				Latency:            "50ms",
+				Jitter:             "20ms",
+				Correlation:        "0",
+				Distribution:       DistributionParetoNormal,
+				DelayRate:          "1mbps",
+				PacketOverhead:     -20,
+				Slot:               "800us",
+				SlotMax:            "8500us",
+				SlotPackets:        42,
+				Device:             "eth0",
+			},
+			"",
+		},
+		{
+			&NetworkCommand{
+				CommonAttackConfig: CommonAttackConfig{Action: NetworkLossAction},
+				Percent:            "1",
+				LossProbabilities:  "1,30",
+				Device:             "eth0",
+			},
+			"loss model is required",
+		},
+		{
+			&NetworkCommand{
+				CommonAttackConfig: CommonAttackConfig{Action: NetworkLossAction},
+				LossModel:          "bernoulli",
+				LossProbabilities:  "1",
+				Device:             "eth0",
+			},
+			"loss model bernoulli not supported",
+		},
+		{
+			&NetworkCommand{
+				CommonAttackConfig: CommonAttackConfig{Action: NetworkLossAction},
+				LossModel:          LossModelGilbertElliott,
+				LossProbabilities:  "1,30,0,100,5",
+				Device:             "eth0",
+			},
+			"loss model gemodel requires 1 to 4 probabilities",
+		},
+		{
+			&NetworkCommand{
+				CommonAttackConfig: CommonAttackConfig{Action: NetworkLossAction},
+				LossModel:          LossModelGilbertElliott,
+				LossProbabilities:  "1,130",
+				Device:             "eth0",
+			},
+			"probability 130 not valid",
+		},
+		{
+			&NetworkCommand{
+				CommonAttackConfig: CommonAttackConfig{Action: NetworkLossAction},
+				LossModel:          LossModelState,
+				LossProbabilities:  "60,50,60,10,50",
+				Device:             "eth0",
+			},
+			"p13 + p14 and p31 + p32 can't be more than 100",
+		},
+		{
+			&NetworkCommand{
+				CommonAttackConfig: CommonAttackConfig{Action: NetworkLossAction},
+				LossModel:          LossModelState,
+				LossProbabilities:  "5, 80, 10, 5, 1",
+				Device:             "eth0",
+			},
+			"",
+		},
+	}
+
+	for _, testCase := range testCases {
+		err := testCase.cmd.Validate()
+		if len(testCase.errMsg) == 0 {
+			g.Expect(err).ShouldNot(HaveOccurred())
+		} else {
+			g.Expect(err.Error()).Should(ContainSubstring(testCase.errMsg))
+		}
+	}
+}
+
+func TestNetworkCommand_ToTC(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	n := &NetworkCommand{
+		CommonAttackConfig: CommonAttackConfig{Action: NetworkBandwidthAction},
+		Rate:               "1kbps",
+		Limit:              10,
+		Buffer:             20,
+		Peakrate:           30,
+		Minburst:           40,
+	}
+
+	tc, err := n.ToTC("chaos-test")
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(tc.Type).Should(Equal(pb.Tc_BANDWIDTH))
+	g.Expect(tc.Ipset).Should(Equal("chaos-test"))
+	g.Expect(tc.Tbf).Should(Equal(&pb.Tbf{
+		Rate:     1024,
+		Limit:    10,
+		Buffer:   20,
+		PeakRate: 30,
+		MinBurst: 40,
+	}))
+
+	n = &NetworkCommand{
+		CommonAttackConfig: CommonAttackConfig{Action: NetworkReorderAction},
+		Latency:            "10ms",
+		Percent:            "25",
+		Correlation:        "50",
+		Gap:                5,
+	}
+	n.CompleteDefaults()
+
+	tc, err = n.ToTC("chaos-test")
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(tc.Type).Should(Equal(pb.Tc_NETEM))
+	g.Expect(tc.Netem.Time).Should(Equal(uint32(10000)))
+	g.Expect(tc.Netem.Reorder).Should(Equal(float32(25)))
+	g.Expect(tc.Netem.ReorderCorr).Should(Equal(float32(50)))
+	g.Expect(tc.Netem.Gap).Should(Equal(uint32(5)))
+
+	n = &NetworkCommand{
+		CommonAttackConfig: CommonAttackConfig{Action: NetworkNetemAction},
+		Latency:            "100ms",
+		Loss:               "5",
+		Corrupt:            "1",
+		Duplicate:          "2",
+		Reorder:            "10",
+		Gap:                3,
+	}
+	n.CompleteDefaults()
+
+	tc, err = n.ToTC("chaos-test")
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(tc.Type).Should(Equal(pb.Tc_NETEM))
+	g.Expect(tc.Netem).Should(Equal(&pb.Netem{
+		Time:      100000,
+		Loss:      5,
+		Corrupt:   1,
+		Duplicate: 2,
+		Reorder:   10,
+		Gap:       3,
+	}))
+
+	// the netem attack is recorded as a single tc rule
+	tcp, err := n.ToTcParameter("eth0")
+	g.Expect(err).ShouldNot(HaveOccurred())
+	tcString, err := json.Marshal(tcp)
+	g.Expect(err).ShouldNot(HaveOccurred())
+	rule := &TCRule{Device: "eth0", Type: pb.Tc_NETEM.String(), TC: string(tcString), IPSet: "chaos-test"}
+	ruleTC, err := rule.ToTC()
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(ruleTC.Netem).Should(Equal(tc.Netem))
+}
+
+func TestNetworkCommand_ToChains(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	n := &NetworkCommand{
+		CommonAttackConfig: CommonAttackConfig{Action: NetworkPartitionAction},
+		IPAddress:          "172.16.4.4",
+		IPProtocol:         "tcp",
+		EgressPort:         "80,8080",
+		Direction:          NetworkDirectionBoth,
+	}
+
+	chains, err := n.ToChains("test", "chaos-test")
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(chains).Should(HaveLen(2))
+	g.Expect(chains[0].Name).Should(Equal("INPUT/test"))
+	g.Expect(chains[0].Direction).Should(Equal(pb.Chain_INPUT))
+	g.Expect(chains[1].Name).Should(Equal("OUTPUT/test"))
+	g.Expect(chains[1].Direction).Should(Equal(pb.Chain_OUTPUT))
+	for _, chain := range chains {
+		g.Expect(chain.Ipsets).Should(Equal([]string{"chaos-test"}))
+		g.Expect(chain.Target).Should(Equal("DROP"))
+		g.Expect(chain.Protocol).Should(Equal("--protocol tcp"))
+		g.Expect(chain.DestinationPorts).Should(Equal("-m multiport --destination-ports 80,8080"))
+	}
+
+	n.Action = NetworkRejectAction
+	n.Direction = NetworkDirectionEgress
+	n.Percent = "25"
+	n.CompleteDefaults()
+	chains, err = n.ToChains("test", "chaos-test")
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(chains).Should(HaveLen(1))
+	g.Expect(chains[0].Name).Should(Equal("OUTPUT/test"))
+	g.Expect(chains[0].Target).Should(Equal("REJECT --reject-with tcp-reset"))
+	g.Expect(chains[0].Protocol).Should(Equal("-m statistic --mode random --probability 0.25 --protocol tcp"))
+
+	n.IPProtocol = ""
+	n.EgressPort = ""
+	n.Percent = "100"
+	n.RejectWith = RejectWithHostUnreachable
+	chains, err = n.ToChains("test", "chaos-test")
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(chains[0].Target).Should(Equal("REJECT --reject-with icmp-host-unreachable"))
+	g.Expect(chains[0].Protocol).Should(BeEmpty())
+
+	n.Action = NetworkDelayAction
+	chains, err = n.ToChains("test", "chaos-test")
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(chains).Should(BeEmpty())
+
+	n = &NetworkCommand{
+		CommonAttackConfig: CommonAttackConfig{Action: NetworkPacketAction},
+		IPAddress:          "172.16.4.4",
+		TCPFlags:           "fin,rst",
+		ConnState:          "established",
+		EgressPort:         "5432",
+	}
+	n.CompleteDefaults()
+	chains, err = n.ToChains("test", "chaos-test")
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(chains).Should(HaveLen(2))
+	g.Expect(chains[0].Name).Should(Equal("OUTPUT/test/fin"))
+	g.Expect(chains[0].Target).Should(Equal("DROP"))
+	g.Expect(chains[0].Protocol).Should(Equal("-m conntrack --ctstate ESTABLISHED --protocol tcp --tcp-flags FIN FIN"))
+	g.Expect(chains[0].DestinationPorts).Should(Equal("--destination-port 5432"))
+	g.Expect(chains[1].Name).Should(Equal("OUTPUT/test/rst"))
+	g.Expect(chains[1].Protocol).Should(Equal("-m conntrack --ctstate ESTABLISHED --protocol tcp --tcp-flags RST RST"))
+
+	n.PacketFault = PacketFaultDelay
+	chains, err = n.ToChains("test", "chaos-test")
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(chains).Should(BeEmpty())
+}
+
+func TestTCRule_ToTC(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	rule := &TCRule{
+		Device:   "eth0",
+		Type:     pb.Tc_NETEM.String(),
+		TC:       `{"loss":{"loss":"10","correlation":"0"}}`,
+		IPSet:    "chaos-test",
+		Protocal: "tcp",
+	}
+
+	tc, err := rule.ToTC()
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(tc.Ipset).Should(Equal("chaos-test"))
+	g.Expect(tc.Protocol).Should(Equal("tcp"))
+
+	// the traffic redirected to the ifb device has been filtered by the ipset
+	rule.Device = "ifb-test"
+	rule.IngressDevice = "eth0"
+	tc, err = rule.ToTC()
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(tc.Ipset).Should(BeEmpty())
+	g.Expect(tc.Protocol).Should(BeEmpty())
+	g.Expect(tc.Netem.Loss).Should(Equal(float32(10)))
+
+	// so is the traffic of the cgroup
+	rule.IngressDevice = ""
+	rule.EgressDevice = "eth0"
+	rule.Cgroup = "/system.slice/nginx.service"
+	tc, err = rule.ToTC()
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(tc.Ipset).Should(BeEmpty())
+	g.Expect(tc.Protocol).Should(BeEmpty())
+}
+
+func TestTCRule_ToNetemArgs(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	n := &NetworkCommand{
+		CommonAttackConfig: CommonAttackConfig{Action: NetworkDelayAction},
+		Latency:            "50ms",
+		Jitter:             "20ms",
+		Correlation:        "25",
+		Distribution:       DistributionParetoNormal,
+		DelayRate:          "1kbps",
+		PacketOverhead:     -20,
+		Slot:               "800us",
+		SlotMax:            "8500us",
+		SlotPackets:        42,
+	}
+	tc, err := n.ToTcParameter("eth0")
+	g.Expect(err).ShouldNot(HaveOccurred())
+
+	data, err := json.Marshal(tc)
+	g.Expect(err).ShouldNot(HaveOccurred())
+
+	// the parameters are recorded so the tc rules set again keep them
+	rule := &TCRule{Device: "eth0", Type: pb.Tc_NETEM.String(), TC: string(data)}
+	args, err := rule.ToNetemArgs()
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(args).Should(Equal([]string{
+		"delay", "50000", "20000", "25.000000",
+		"distribution", "paretonormal",
+		"rate", "1024bps", "-20",
+		"slot", "800us", "8500us", "packets", "42",
+	}))
+
+	// the netem set by the chaos daemon is enough
+	rule.TC = `{"delay":{"latency":"10ms","jitter":"5ms","correlation":"0","distribution":"uniform"}}`
+	args, err = rule.ToNetemArgs()
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(args).Should(BeNil())
+
+	n = &NetworkCommand{
+		CommonAttackConfig: CommonAttackConfig{Action: NetworkLossAction},
+		Percent:            "1",
+		Correlation:        "0",
+		LossModel:          LossModelGilbertElliott,
+		LossProbabilities:  "1,30",
+	}
+	tc, err = n.ToTcParameter("eth0")
+	g.Expect(err).ShouldNot(HaveOccurred())
+
+	data, err = json.Marshal(tc)
+	g.Expect(err).ShouldNot(HaveOccurred())
+
+	// the random loss set by the chaos daemon is replaced by the loss model
+	rule.TC = string(data)
+	args, err = rule.ToNetemArgs()
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(args).Should(Equal([]string{"limit", "1000", "loss", "gemodel", "1", "30"}))
+
+	netem, err := n.ToLossNetem()
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(netem.Loss).Should(BeZero())
+
+	rule.Type = pb.Tc_BANDWIDTH.String()
+	rule.TC = `{"bandwidth":{"rate":"1mbps","limit":1,"buffer":1}}`
+	args, err = rule.ToNetemArgs()
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(args).Should(BeNil())
+}
+
+func TestNetworkCommand_ToIPSets(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	n := &NetworkCommand{
+		CommonAttackConfig: CommonAttackConfig{Action: NetworkPartitionAction},
+		IPAddress:          "172.16.4.4,2001:db8::1,10.0.0.0/8",
+	}
+
+	ipv4, ipv6, err := n.ToIPSets("chaos-test")
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(ipv4).Should(Equal(&pb.IPSet{Name: "chaos-test", Cidrs: []string{"172.16.4.4/32", "10.0.0.0/8"}}))
+	g.Expect(ipv6).Should(Equal(&pb.IPSet{Name: "chaos-test-6", Cidrs: []string{"2001:db8::1/128"}}))
+
+	n.IPAddress = "172.16.4.4"
+	_, ipv6, err = n.ToIPSets("chaos-test")
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(ipv6).Should(BeNil())
+}
+
+func TestIptablesRuleList_SplitByFamily(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	rules := IptablesRuleList{
+		{Name: "OUTPUT/a"},
+		{Name: "OUTPUT/b", Family: FamilyIPv4},
+		{Name: "OUTPUT/b", Family: FamilyIPv6},
+	}
+
+	ipv4, ipv6 := rules.SplitByFamily()
+	g.Expect(ipv4).Should(Equal(IptablesRuleList{rules[0], rules[1]}))
+	g.Expect(ipv6).Should(Equal(IptablesRuleList{rules[2]}))
+}
+
+func TestIptablesRule_ToChain(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	rule := &IptablesRule{Name: "OUTPUT/a", Direction: "OUTPUT", IPSets: "chaos-a"}
+	g.Expect(rule.ToChain().Target).Should(Equal("DROP"))
+
+	rule.Target = "REJECT --reject-with icmp-port-unreachable"
+	g.Expect(rule.ToChain().Target).Should(Equal("REJECT --reject-with icmp-port-unreachable"))
+
+	rule.Family = FamilyIPv6
+	g.Expect(rule.ToChain().Target).Should(Equal("REJECT --reject-with icmp6-port-unreachable"))
+
+	rule.Target = "REJECT --reject-with icmp-host-unreachable"
+	g.Expect(rule.ToChain().Target).Should(Equal("REJECT --reject-with icmp6-addr-unreachable"))
+
+	rule.Target = "REJECT --reject-with tcp-reset"
+	g.Expect(rule.ToChain().Target).Should(Equal("REJECT --reject-with tcp-reset"))
+
+	rule.Protocol = "-m statistic --mode random --probability 0.5 --protocol icmp"
+	g.Expect(rule.ToChain().Protocol).Should(Equal("-m statistic --mode random --probability 0.5 --protocol ipv6-icmp"))
+
+	rule.Family = FamilyIPv4
+	g.Expect(rule.ToChain().Protocol).Should(Equal("-m statistic --mode random --probability 0.5 --protocol icmp"))
+}
+
+func TestNetworkCommand_MapEtcHosts(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	n := &NetworkCommand{
+		CommonAttackConfig: CommonAttackConfig{Action: NetworkDNSAction},
+		DNSHost:            "chaos-mesh.org,www.example.com",
+		DNSIp:              "10.0.0.1,2001:db8::1",
+	}
+
+	content := "# The hosts\n" +
+		"127.0.0.1\tlocalhost\n" +
+		"::1 localhost ip6-localhost\n" +
+		"172.16.4.4 chaos-mesh.org docs.chaos-mesh.org # the site\n" +
+		"fe80::1 WWW.example.com\n"
+	g.Expect(n.MapEtcHosts(content)).Should(Equal("# The hosts\n" +
+		"127.0.0.1\tlocalhost\n" +
+		"::1 localhost ip6-localhost\n" +
+		"172.16.4.4\tdocs.chaos-mesh.org # the site\n" +
+		"10.0.0.1\tchaos-mesh.org\n" +
+		"2001:db8::1\twww.example.com\n"))
+
+	g.Expect(n.MapEtcHosts("")).Should(Equal("10.0.0.1\tchaos-mesh.org\n2001:db8::1\twww.example.com\n"))
+}
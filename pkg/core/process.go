@@ -15,15 +15,30 @@ package core
 
 import (
 	"encoding/json"
+	"net"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/pingcap/errors"
 )
 
 const (
-	ProcessKillAction = "kill"
-	ProcessStopAction = "stop"
+	ProcessKillAction    = "kill"
+	ProcessStopAction    = "stop"
+	ProcessRestartAction = "restart"
+	ProcessFreezeAction  = "freeze"
 )
 
+// DefaultRestartTimeout is the default time to wait for the processes to come back in restart attacks.
+const DefaultRestartTimeout = "1m"
+
+// MaxAttackedProcesses is the max number of processes attacked by an attack unless AllowMany is true,
+// so a loose selector can't attack most of the host by mistake.
+const MaxAttackedProcesses = 10
+
 var _ AttackConfig = &ProcessCommand{}
 
 type ProcessCommand struct {
@@ -31,29 +46,155 @@ type ProcessCommand struct {
 
 	// Process defines the process name or the process ID.
 	Process string
-	Signal  int
+	Signal  Signal
 	PIDs    []int
-	// TODO: support these feature
-	// Newest       bool
-	// Oldest       bool
-	// Exact        bool
-	// KillChildren bool
-	// User         string
+	// KillChildren sends the signal to all the descendants of the selected processes too, the
+	// children are stopped before their parents, and killed after them. PIDs records them all.
+	KillChildren bool
+
+	// The processes matching all the selectors are attacked. The Process matches the whole name
+	// unless Substring is true. Cmdline is a regular expression matching the full command line,
+	// User is the name or uid of the owner, PPid is the pid of the parent, and Cgroup is the
+	// cgroup v2 path such as /system.slice/nginx.service, including its child cgroups.
+	Substring bool
+	Cmdline   string
+	User      string
+	PPid      int
+	Cgroup    string
+	// Newest and Oldest pick the Count processes created last or first from the matched
+	// processes, otherwise Count processes are picked at random. Count is 1 by default if
+	// Newest or Oldest is true, and all the matched processes are attacked if it is 0.
+	Newest bool
+	Oldest bool
+	Count  int
+	// AllowMany allows the attack on more than MaxAttackedProcesses processes.
+	AllowMany bool
+
+	// The restart attack kills the processes, then waits for new processes matching the same
+	// selectors to come back before the RestartTimeout. If ProbeTCP, an address such as
+	// 127.0.0.1:80, or ProbeHTTP, a url answering 2xx or 3xx when ready, is set, the processes
+	// come back only after the probe succeeds. The observed result is recorded in Restart.
+	RestartTimeout string
+	ProbeTCP       string
+	ProbeHTTP      string
+	Restart        *ProcessRestartResult
+
+	// The freeze attack freezes the cgroups of the processes instead of sending a signal, so all
+	// the processes and threads in the cgroups are frozen. FrozenCgroups records the files written
+	// to freeze them, which are cgroup.freeze of cgroup v2 or freezer.state of cgroup v1.
+	FrozenCgroups []string
+}
+
+// ProcessRestartResult is the result observed by the restart attack.
+type ProcessRestartResult struct {
+	KilledAt time.Time `json:"killed_at"`
+	// Recovered is false if the processes don't come back before the timeout.
+	Recovered bool `json:"recovered"`
+	// TimeToRecovery is the seconds from killing the processes to their new processes are ready.
+	TimeToRecovery float64 `json:"time_to_recovery"`
+	NewPIDs        []int   `json:"new_pids,omitempty"`
+	Message        string  `json:"message,omitempty"`
 }
 
 func (p *ProcessCommand) Validate() error {
 	if err := p.CommonAttackConfig.Validate(); err != nil {
 		return err
 	}
-	if len(p.Process) == 0 {
-		return errors.New("process not provided")
+	if len(p.Process) == 0 && len(p.Cmdline) == 0 && len(p.User) == 0 && p.PPid == 0 && len(p.Cgroup) == 0 {
+		return errors.New("process not provided, the process or at least one selector is required")
+	}
+
+	if len(p.Cmdline) > 0 {
+		if _, err := regexp.Compile(p.Cmdline); err != nil {
+			return errors.Errorf("cmdline %s not valid: %s", p.Cmdline, err)
+		}
+	}
+
+	if p.PPid < 0 {
+		return errors.Errorf("ppid %d not valid", p.PPid)
+	}
+
+	if len(p.Cgroup) > 0 && !strings.HasPrefix(p.Cgroup, "/") {
+		return errors.Errorf("cgroup %s not valid, it should be an absolute path", p.Cgroup)
+	}
+
+	if p.Newest && p.Oldest {
+		return errors.New("newest and oldest can't be set at the same time")
+	}
+
+	if p.Count < 0 {
+		return errors.Errorf("count %d not valid", p.Count)
+	}
+
+	// no signal is sent by the freeze attack
+	if p.Action == ProcessFreezeAction {
+		return nil
+	}
+
+	if err := p.Signal.Validate(); err != nil {
+		return err
 	}
 
-	// TODO: validate signal
+	if p.Action == ProcessRestartAction {
+		return p.validRestart()
+	}
 
 	return nil
 }
 
+func (p *ProcessCommand) validRestart() error {
+	if p.Signal.Recoverable() {
+		return errors.Errorf("signal %s can't be used to restart processes", p.Signal)
+	}
+
+	if _, err := strconv.Atoi(p.Process); err == nil {
+		return errors.Errorf("process %s not valid, the new process can't be matched by the process ID", p.Process)
+	}
+
+	if _, err := p.RestartTimeoutDuration(); err != nil {
+		return err
+	}
+
+	if len(p.ProbeTCP) > 0 {
+		if _, _, err := net.SplitHostPort(p.ProbeTCP); err != nil {
+			return errors.Errorf("tcp probe %s not valid, it should be an address such as 127.0.0.1:80", p.ProbeTCP)
+		}
+	}
+
+	if len(p.ProbeHTTP) > 0 {
+		u, err := url.Parse(p.ProbeHTTP)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || len(u.Host) == 0 {
+			return errors.Errorf("http probe %s not valid, it should be a http or https url", p.ProbeHTTP)
+		}
+	}
+
+	return nil
+}
+
+// RestartTimeoutDuration parses the RestartTimeout, which is DefaultRestartTimeout if not set.
+func (p *ProcessCommand) RestartTimeoutDuration() (time.Duration, error) {
+	timeout := p.RestartTimeout
+	if len(timeout) == 0 {
+		timeout = DefaultRestartTimeout
+	}
+
+	duration, err := time.ParseDuration(timeout)
+	if err != nil || duration <= 0 {
+		return 0, errors.Errorf("restart timeout %s not valid", p.RestartTimeout)
+	}
+
+	return duration, nil
+}
+
+// PickCount returns the count of processes to pick from the matched processes, 0 means all.
+func (p *ProcessCommand) PickCount() int {
+	if p.Count == 0 && (p.Newest || p.Oldest) {
+		return 1
+	}
+
+	return p.Count
+}
+
 func (p ProcessCommand) RecoverData() string {
 	data, _ := json.Marshal(p)
 
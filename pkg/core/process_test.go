@@ -0,0 +1,195 @@
+// Copyright 2021 Chaos Mesh Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestProcessCommand(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	testCases := []struct {
+		cmd    *ProcessCommand
+		errMsg string
+	}{
+		{
+			&ProcessCommand{
+				CommonAttackConfig: CommonAttackConfig{Action: ProcessKillAction},
+				Signal:             9,
+			},
+			"process not provided",
+		},
+		{
+			&ProcessCommand{
+				CommonAttackConfig: CommonAttackConfig{Action: ProcessKillAction},
+				Cmdline:            "java.*[",
+				Signal:             9,
+			},
+			"cmdline java.*[ not valid",
+		},
+		{
+			&ProcessCommand{
+				CommonAttackConfig: CommonAttackConfig{Action: ProcessKillAction},
+				Process:            "java",
+				PPid:               -1,
+				Signal:             9,
+			},
+			"ppid -1 not valid",
+		},
+		{
+			&ProcessCommand{
+				CommonAttackConfig: CommonAttackConfig{Action: ProcessKillAction},
+				Cgroup:             "system.slice",
+				Signal:             9,
+			},
+			"cgroup system.slice not valid",
+		},
+		{
+			&ProcessCommand{
+				CommonAttackConfig: CommonAttackConfig{Action: ProcessKillAction},
+				Process:            "java",
+				Newest:             true,
+				Oldest:             true,
+				Signal:             9,
+			},
+			"newest and oldest can't be set at the same time",
+		},
+		{
+			&ProcessCommand{
+				CommonAttackConfig: CommonAttackConfig{Action: ProcessKillAction},
+				Process:            "java",
+				Count:              -1,
+				Signal:             9,
+			},
+			"count -1 not valid",
+		},
+		{
+			&ProcessCommand{
+				CommonAttackConfig: CommonAttackConfig{Action: ProcessKillAction},
+				Process:            "java",
+			},
+			"signal 0 not valid",
+		},
+		{
+			&ProcessCommand{
+				CommonAttackConfig: CommonAttackConfig{Action: ProcessKillAction},
+				Process:            "java",
+				Signal:             65,
+			},
+			"signal 65 not valid",
+		},
+		{
+			&ProcessCommand{
+				CommonAttackConfig: CommonAttackConfig{Action: ProcessKillAction},
+				Process:            "java",
+				Signal:             9,
+			},
+			"",
+		},
+		{
+			&ProcessCommand{
+				CommonAttackConfig: CommonAttackConfig{Action: ProcessStopAction},
+				Cmdline:            `kafka\.Kafka`,
+				User:               "kafka",
+				PPid:               1,
+				Cgroup:             "/system.slice/kafka.service",
+				Oldest:             true,
+				Signal:             19,
+			},
+			"",
+		},
+		{
+			&ProcessCommand{
+				CommonAttackConfig: CommonAttackConfig{Action: ProcessRestartAction},
+				Process:            "nginx",
+				Signal:             19,
+			},
+			"signal SIGSTOP can't be used to restart processes",
+		},
+		{
+			&ProcessCommand{
+				CommonAttackConfig: CommonAttackConfig{Action: ProcessRestartAction},
+				Process:            "1234",
+				Signal:             9,
+			},
+			"process 1234 not valid",
+		},
+		{
+			&ProcessCommand{
+				CommonAttackConfig: CommonAttackConfig{Action: ProcessRestartAction},
+				Process:            "nginx",
+				Signal:             9,
+				RestartTimeout:     "-1s",
+			},
+			"restart timeout -1s not valid",
+		},
+		{
+			&ProcessCommand{
+				CommonAttackConfig: CommonAttackConfig{Action: ProcessRestartAction},
+				Process:            "nginx",
+				Signal:             9,
+				ProbeTCP:           "127.0.0.1",
+			},
+			"tcp probe 127.0.0.1 not valid",
+		},
+		{
+			&ProcessCommand{
+				CommonAttackConfig: CommonAttackConfig{Action: ProcessRestartAction},
+				Process:            "nginx",
+				Signal:             9,
+				ProbeHTTP:          "127.0.0.1:80",
+			},
+			"http probe 127.0.0.1:80 not valid",
+		},
+		{
+			&ProcessCommand{
+				CommonAttackConfig: CommonAttackConfig{Action: ProcessRestartAction},
+				Process:            "nginx",
+				Signal:             15,
+				RestartTimeout:     "30s",
+				ProbeTCP:           "127.0.0.1:80",
+				ProbeHTTP:          "http://127.0.0.1:80/healthz",
+			},
+			"",
+		},
+		{
+			&ProcessCommand{
+				CommonAttackConfig: CommonAttackConfig{Action: ProcessFreezeAction},
+				Cgroup:             "/system.slice/nginx.service",
+			},
+			"",
+		},
+	}
+
+	for _, testCase := range testCases {
+		err := testCase.cmd.Validate()
+		if len(testCase.errMsg) == 0 {
+			g.Expect(err).ShouldNot(HaveOccurred())
+		} else {
+			g.Expect(err.Error()).Should(ContainSubstring(testCase.errMsg))
+		}
+	}
+}
+
+func TestProcessCommand_PickCount(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	g.Expect((&ProcessCommand{}).PickCount()).Should(Equal(0))
+	g.Expect((&ProcessCommand{Count: 3}).PickCount()).Should(Equal(3))
+	g.Expect((&ProcessCommand{Newest: true}).PickCount()).Should(Equal(1))
+	g.Expect((&ProcessCommand{Oldest: true, Count: 2}).PickCount()).Should(Equal(2))
+}
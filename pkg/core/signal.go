@@ -0,0 +1,146 @@
+// Copyright 2021 Chaos Mesh Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/pingcap/errors"
+)
+
+// maxSignal is the largest signal number of Linux, the signals from SIGRTMIN to it are real-time signals.
+const maxSignal = 64
+
+// signalNames are the names of the standard signals. The ones missing on some platforms are not included,
+// they can be given by the number.
+var signalNames = map[string]syscall.Signal{
+	"SIGHUP":    syscall.SIGHUP,
+	"SIGINT":    syscall.SIGINT,
+	"SIGQUIT":   syscall.SIGQUIT,
+	"SIGILL":    syscall.SIGILL,
+	"SIGTRAP":   syscall.SIGTRAP,
+	"SIGABRT":   syscall.SIGABRT,
+	"SIGBUS":    syscall.SIGBUS,
+	"SIGFPE":    syscall.SIGFPE,
+	"SIGKILL":   syscall.SIGKILL,
+	"SIGUSR1":   syscall.SIGUSR1,
+	"SIGSEGV":   syscall.SIGSEGV,
+	"SIGUSR2":   syscall.SIGUSR2,
+	"SIGPIPE":   syscall.SIGPIPE,
+	"SIGALRM":   syscall.SIGALRM,
+	"SIGTERM":   syscall.SIGTERM,
+	"SIGCHLD":   syscall.SIGCHLD,
+	"SIGCONT":   syscall.SIGCONT,
+	"SIGSTOP":   syscall.SIGSTOP,
+	"SIGTSTP":   syscall.SIGTSTP,
+	"SIGTTIN":   syscall.SIGTTIN,
+	"SIGTTOU":   syscall.SIGTTOU,
+	"SIGURG":    syscall.SIGURG,
+	"SIGXCPU":   syscall.SIGXCPU,
+	"SIGXFSZ":   syscall.SIGXFSZ,
+	"SIGVTALRM": syscall.SIGVTALRM,
+	"SIGPROF":   syscall.SIGPROF,
+	"SIGWINCH":  syscall.SIGWINCH,
+	"SIGIO":     syscall.SIGIO,
+	"SIGSYS":    syscall.SIGSYS,
+}
+
+// stopSignals are the signals stopping the process, which are recovered by SIGCONT.
+var stopSignals = map[syscall.Signal]bool{
+	syscall.SIGSTOP: true,
+	syscall.SIGTSTP: true,
+	syscall.SIGTTIN: true,
+	syscall.SIGTTOU: true,
+}
+
+// Signal is the signal sent by process attacks, it can be given by the number or the name,
+// such as 1, SIGHUP or HUP.
+type Signal int
+
+// ParseSignal parses the number or the name of signal, the name is case insensitive.
+func ParseSignal(signal string) (Signal, error) {
+	if n, err := strconv.Atoi(signal); err == nil {
+		return Signal(n), nil
+	}
+
+	name := strings.ToUpper(signal)
+	if !strings.HasPrefix(name, "SIG") {
+		name = "SIG" + name
+	}
+
+	if s, ok := signalNames[name]; ok {
+		return Signal(s), nil
+	}
+
+	return 0, errors.Errorf("signal %s not supported", signal)
+}
+
+// Validate checks the signal number, 0 is not valid because nothing is sent.
+func (s Signal) Validate() error {
+	if s <= 0 || s > maxSignal {
+		return errors.Errorf("signal %d not valid", s)
+	}
+
+	return nil
+}
+
+// Recoverable returns true if the process attacked by the signal can be recovered.
+func (s Signal) Recoverable() bool {
+	return stopSignals[syscall.Signal(s)]
+}
+
+func (s Signal) String() string {
+	for name, signal := range signalNames {
+		if Signal(signal) == s {
+			return name
+		}
+	}
+
+	return strconv.Itoa(int(s))
+}
+
+// Set implements the pflag.Value interface.
+func (s *Signal) Set(value string) error {
+	signal, err := ParseSignal(value)
+	if err != nil {
+		return err
+	}
+
+	*s = signal
+	return nil
+}
+
+// Type implements the pflag.Value interface.
+func (s *Signal) Type() string {
+	return "signal"
+}
+
+// UnmarshalJSON parses the signal from the number or the name.
+func (s *Signal) UnmarshalJSON(data []byte) error {
+	var n int
+	if err := json.Unmarshal(data, &n); err == nil {
+		*s = Signal(n)
+		return nil
+	}
+
+	var name string
+	if err := json.Unmarshal(data, &name); err != nil {
+		return errors.Errorf("signal %s not valid, it should be a number or a name", string(data))
+	}
+
+	return s.Set(name)
+}
@@ -0,0 +1,74 @@
+// Copyright 2021 Chaos Mesh Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+import (
+	"encoding/json"
+	"syscall"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestParseSignal(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	testCases := []struct {
+		signal   string
+		expected Signal
+		errMsg   string
+	}{
+		{"9", Signal(syscall.SIGKILL), ""},
+		{"SIGHUP", Signal(syscall.SIGHUP), ""},
+		{"usr1", Signal(syscall.SIGUSR1), ""},
+		{"sigabrt", Signal(syscall.SIGABRT), ""},
+		{"40", Signal(40), ""},
+		{"SIGFOO", 0, "signal SIGFOO not supported"},
+	}
+
+	for _, testCase := range testCases {
+		signal, err := ParseSignal(testCase.signal)
+		if len(testCase.errMsg) == 0 {
+			g.Expect(err).ShouldNot(HaveOccurred())
+			g.Expect(signal).Should(Equal(testCase.expected))
+		} else {
+			g.Expect(err.Error()).Should(ContainSubstring(testCase.errMsg))
+		}
+	}
+}
+
+func TestSignal_Recoverable(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	g.Expect(Signal(syscall.SIGSTOP).Recoverable()).Should(BeTrue())
+	g.Expect(Signal(syscall.SIGTSTP).Recoverable()).Should(BeTrue())
+	g.Expect(Signal(syscall.SIGKILL).Recoverable()).Should(BeFalse())
+	g.Expect(Signal(syscall.SIGHUP).Recoverable()).Should(BeFalse())
+}
+
+func TestSignal_UnmarshalJSON(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	var cmd ProcessCommand
+	g.Expect(json.Unmarshal([]byte(`{"process": "nginx", "signal": "SIGHUP"}`), &cmd)).ShouldNot(HaveOccurred())
+	g.Expect(cmd.Signal).Should(Equal(Signal(syscall.SIGHUP)))
+
+	g.Expect(json.Unmarshal([]byte(`{"process": "nginx", "signal": 15}`), &cmd)).ShouldNot(HaveOccurred())
+	g.Expect(cmd.Signal).Should(Equal(Signal(syscall.SIGTERM)))
+
+	// the signal is stored as the number, so the old experiments can be recovered
+	g.Expect(cmd.RecoverData()).Should(ContainSubstring(`"Signal":15`))
+
+	g.Expect(json.Unmarshal([]byte(`{"signal": "SIGFOO"}`), &cmd)).Should(HaveOccurred())
+}
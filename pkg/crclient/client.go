@@ -15,22 +15,65 @@ package crclient
 
 import (
 	"context"
+	"sync"
 
 	"github.com/chaos-mesh/chaos-mesh/pkg/chaosdaemon/crclients"
+
+	"github.com/chaos-mesh/chaosd/pkg/container"
 )
 
 func NewNodeCRClient(pid int) crclients.ContainerRuntimeInfoClient {
 	return &NodeCRClient{
-		Pid: uint32(pid),
+		Pid:     uint32(pid),
+		clients: make(map[string]container.CRIClient),
 	}
 }
 
 type NodeCRClient struct {
 	Pid uint32
+
+	// clients are the clients of container runtimes, every client is created once and reused,
+	// because the pid of container is got for every request to the chaos daemon.
+	lock    sync.Mutex
+	clients map[string]container.CRIClient
+}
+
+// GetPidFromContainerID returns the pid of chaosd if the container id is empty, so the
+// rules are applied on the host. Otherwise it gets the pid of the container from the
+// container runtime given by the prefix of the container id, such as docker://.
+func (n *NodeCRClient) GetPidFromContainerID(ctx context.Context, containerID string) (uint32, error) {
+	if len(containerID) == 0 {
+		return n.Pid, nil
+	}
+
+	cli, err := n.client(containerID)
+	if err != nil {
+		return 0, err
+	}
+
+	return cli.GetPidFromContainerID(ctx, containerID)
 }
 
-func (n *NodeCRClient) GetPidFromContainerID(_ context.Context, _ string) (uint32, error) {
-	return n.Pid, nil
+func (n *NodeCRClient) client(containerID string) (container.CRIClient, error) {
+	runtime, err := container.ContainerRuntime(containerID)
+	if err != nil {
+		return nil, err
+	}
+
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	if cli, ok := n.clients[runtime]; ok {
+		return cli, nil
+	}
+
+	cli, err := container.NewCRIClientFromContainerID(containerID)
+	if err != nil {
+		return nil, err
+	}
+	n.clients[runtime] = cli
+
+	return cli, nil
 }
 
 func (n *NodeCRClient) ContainerKillByContainerID(_ context.Context, _ string) error {
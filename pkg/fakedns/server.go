@@ -0,0 +1,242 @@
+// Copyright 2021 Chaos Mesh Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fakedns
+
+import (
+	"math/rand"
+	"net"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"go.uber.org/zap"
+	"golang.org/x/net/dns/dnsmessage"
+
+	"github.com/chaos-mesh/chaosd/pkg/core"
+)
+
+// upstreamTimeout is the timeout of the queries sent to the upstream.
+const upstreamTimeout = 5 * time.Second
+
+type Config struct {
+	// Listen is the UDP address the server listens on, such as 127.0.0.1:53
+	Listen string
+	// Upstream is the address of the real DNS server, such as 8.8.8.8:53
+	Upstream string
+	// Patterns are the domain patterns such as *.example.com, the queries of all
+	// domains are matched if it's empty.
+	Patterns []string
+	// Fault is one of the DNS faults of core, such as core.DNSFaultNXDomain
+	Fault string
+	// Answer is the address answered by the wrong fault
+	Answer net.IP
+	// Delay is the delay of the slow fault
+	Delay time.Duration
+}
+
+// Server is a DNS server which answers the queries matching the patterns with the fault,
+// and passes the other queries through to the upstream.
+type Server struct {
+	conf Config
+}
+
+func NewServer(conf Config) *Server {
+	return &Server{conf: conf}
+}
+
+// ListenAndServe listens on the UDP address and serves the queries until an error occurs.
+func (s *Server) ListenAndServe() error {
+	conn, err := net.ListenPacket("udp", s.conf.Listen)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer conn.Close()
+
+	buf := make([]byte, 65535)
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		req := make([]byte, n)
+		copy(req, buf[:n])
+		go func() {
+			resp, err := s.handle(req)
+			if err != nil {
+				log.Warn("failed to handle DNS query", zap.String("client", addr.String()), zap.Error(err))
+				return
+			}
+
+			if _, err := conn.WriteTo(resp, addr); err != nil {
+				log.Warn("failed to write DNS response", zap.String("client", addr.String()), zap.Error(err))
+			}
+		}()
+	}
+}
+
+func (s *Server) handle(req []byte) ([]byte, error) {
+	var p dnsmessage.Parser
+	header, err := p.Start(req)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	question, err := p.Question()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	if !s.match(question.Name.String()) {
+		return s.forward(req)
+	}
+
+	switch s.conf.Fault {
+	case core.DNSFaultNXDomain:
+		return reply(header, question, dnsmessage.RCodeNameError, false, nil)
+	case core.DNSFaultServFail:
+		return reply(header, question, dnsmessage.RCodeServerFailure, false, nil)
+	case core.DNSFaultTruncate:
+		return reply(header, question, dnsmessage.RCodeSuccess, true, nil)
+	case core.DNSFaultRandom:
+		return reply(header, question, dnsmessage.RCodeSuccess, false, randomIP(question.Type))
+	case core.DNSFaultWrong:
+		return reply(header, question, dnsmessage.RCodeSuccess, false, s.conf.Answer)
+	case core.DNSFaultSlow:
+		time.Sleep(s.conf.Delay)
+		return s.forward(req)
+	default:
+		return nil, errors.Errorf("DNS fault %s not supported", s.conf.Fault)
+	}
+}
+
+// match returns true if the domain matches any pattern.
+func (s *Server) match(domain string) bool {
+	if len(s.conf.Patterns) == 0 {
+		return true
+	}
+
+	domain = strings.ToLower(strings.TrimSuffix(domain, "."))
+	for _, pattern := range s.conf.Patterns {
+		pattern = strings.ToLower(strings.TrimSuffix(pattern, "."))
+		if matched, _ := path.Match(pattern, domain); matched {
+			return true
+		}
+	}
+
+	return false
+}
+
+// forward sends the query to the upstream and returns its response.
+func (s *Server) forward(req []byte) ([]byte, error) {
+	conn, err := net.DialTimeout("udp", s.conf.Upstream, upstreamTimeout)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	defer conn.Close()
+
+	if err := conn.SetDeadline(time.Now().Add(upstreamTimeout)); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	if _, err := conn.Write(req); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	buf := make([]byte, 65535)
+	n, err := conn.Read(buf)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return buf[:n], nil
+}
+
+// reply builds the response of the question, the ip is answered
+// if it's the address of the type asked by the question.
+func reply(header dnsmessage.Header, question dnsmessage.Question, rcode dnsmessage.RCode, truncated bool, ip net.IP) ([]byte, error) {
+	b := dnsmessage.NewBuilder(nil, dnsmessage.Header{
+		ID:                 header.ID,
+		Response:           true,
+		OpCode:             header.OpCode,
+		Truncated:          truncated,
+		RecursionDesired:   header.RecursionDesired,
+		RecursionAvailable: true,
+		RCode:              rcode,
+	})
+	b.EnableCompression()
+
+	if err := b.StartQuestions(); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	if err := b.Question(question); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	if err := b.StartAnswers(); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	resource := dnsmessage.ResourceHeader{
+		Name:  question.Name,
+		Type:  question.Type,
+		Class: question.Class,
+	}
+
+	if ipv4 := ip.To4(); ipv4 != nil && question.Type == dnsmessage.TypeA {
+		answer := dnsmessage.AResource{}
+		copy(answer.A[:], ipv4)
+		if err := b.AResource(resource, answer); err != nil {
+			return nil, errors.WithStack(err)
+		}
+	} else if ip.To4() == nil && len(ip) == net.IPv6len && question.Type == dnsmessage.TypeAAAA {
+		answer := dnsmessage.AAAAResource{}
+		copy(answer.AAAA[:], ip)
+		if err := b.AAAAResource(resource, answer); err != nil {
+			return nil, errors.WithStack(err)
+		}
+	}
+
+	resp, err := b.Finish()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return resp, nil
+}
+
+// randomIP returns a random address of the type, or nil if the type isn't A or AAAA.
+func randomIP(t dnsmessage.Type) net.IP {
+	var ip net.IP
+	switch t {
+	case dnsmessage.TypeA:
+		ip = make(net.IP, net.IPv4len)
+	case dnsmessage.TypeAAAA:
+		ip = make(net.IP, net.IPv6len)
+	default:
+		return nil
+	}
+
+	// #nosec
+	rand.Read(ip)
+	// avoid the address being taken as an IPv4-mapped IPv6 address
+	if t == dnsmessage.TypeAAAA {
+		ip[0] = 0x20
+	}
+
+	return ip
+}
@@ -0,0 +1,181 @@
+// Copyright 2021 Chaos Mesh Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fakedns
+
+import (
+	"net"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"golang.org/x/net/dns/dnsmessage"
+
+	"github.com/chaos-mesh/chaosd/pkg/core"
+)
+
+func newQuery(g *WithT, domain string, t dnsmessage.Type) []byte {
+	b := dnsmessage.NewBuilder(nil, dnsmessage.Header{ID: 1024, RecursionDesired: true})
+	g.Expect(b.StartQuestions()).ShouldNot(HaveOccurred())
+	g.Expect(b.Question(dnsmessage.Question{
+		Name:  dnsmessage.MustNewName(domain),
+		Type:  t,
+		Class: dnsmessage.ClassINET,
+	})).ShouldNot(HaveOccurred())
+
+	req, err := b.Finish()
+	g.Expect(err).ShouldNot(HaveOccurred())
+	return req
+}
+
+func TestServer_Handle(t *testing.T) {
+	g := NewGomegaWithT(t)
+	type TestCase struct {
+		name      string
+		conf      Config
+		domain    string
+		t         dnsmessage.Type
+		rcode     dnsmessage.RCode
+		truncated bool
+		answer    net.IP
+	}
+	tcs := []TestCase{
+		{
+			name:   "nxdomain",
+			conf:   Config{Fault: core.DNSFaultNXDomain, Patterns: []string{"*.example.com"}},
+			domain: "www.example.com.",
+			t:      dnsmessage.TypeA,
+			rcode:  dnsmessage.RCodeNameError,
+		},
+		{
+			name:   "servfail",
+			conf:   Config{Fault: core.DNSFaultServFail},
+			domain: "www.example.com.",
+			t:      dnsmessage.TypeA,
+			rcode:  dnsmessage.RCodeServerFailure,
+		},
+		{
+			name:      "truncate",
+			conf:      Config{Fault: core.DNSFaultTruncate, Patterns: []string{"www.EXAMPLE.com"}},
+			domain:    "www.example.com.",
+			t:         dnsmessage.TypeA,
+			rcode:     dnsmessage.RCodeSuccess,
+			truncated: true,
+		},
+		{
+			name:   "wrong ipv4",
+			conf:   Config{Fault: core.DNSFaultWrong, Answer: net.ParseIP("10.0.0.1")},
+			domain: "www.example.com.",
+			t:      dnsmessage.TypeA,
+			rcode:  dnsmessage.RCodeSuccess,
+			answer: net.ParseIP("10.0.0.1").To4(),
+		},
+		{
+			name:   "wrong ipv4 asked by AAAA",
+			conf:   Config{Fault: core.DNSFaultWrong, Answer: net.ParseIP("10.0.0.1")},
+			domain: "www.example.com.",
+			t:      dnsmessage.TypeAAAA,
+			rcode:  dnsmessage.RCodeSuccess,
+		},
+		{
+			name:   "wrong ipv6",
+			conf:   Config{Fault: core.DNSFaultWrong, Answer: net.ParseIP("2001:db8::1")},
+			domain: "www.example.com.",
+			t:      dnsmessage.TypeAAAA,
+			rcode:  dnsmessage.RCodeSuccess,
+			answer: net.ParseIP("2001:db8::1"),
+		},
+	}
+
+	for _, tc := range tcs {
+		resp, err := NewServer(tc.conf).handle(newQuery(g, tc.domain, tc.t))
+		g.Expect(err).ShouldNot(HaveOccurred(), tc.name)
+
+		var p dnsmessage.Parser
+		header, err := p.Start(resp)
+		g.Expect(err).ShouldNot(HaveOccurred(), tc.name)
+		g.Expect(header.ID).Should(Equal(uint16(1024)), tc.name)
+		g.Expect(header.RCode).Should(Equal(tc.rcode), tc.name)
+		g.Expect(header.Truncated).Should(Equal(tc.truncated), tc.name)
+		g.Expect(p.SkipAllQuestions()).ShouldNot(HaveOccurred(), tc.name)
+
+		answers, err := p.AllAnswers()
+		g.Expect(err).ShouldNot(HaveOccurred(), tc.name)
+		if tc.answer == nil {
+			g.Expect(answers).Should(BeEmpty(), tc.name)
+			continue
+		}
+
+		g.Expect(answers).Should(HaveLen(1), tc.name)
+		switch body := answers[0].Body.(type) {
+		case *dnsmessage.AResource:
+			g.Expect(net.IP(body.A[:])).Should(Equal(tc.answer), tc.name)
+		case *dnsmessage.AAAAResource:
+			g.Expect(net.IP(body.AAAA[:])).Should(Equal(tc.answer), tc.name)
+		}
+	}
+}
+
+func TestServer_Match(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	s := NewServer(Config{Patterns: []string{"*.example.com", "chaos-mesh.org."}})
+	g.Expect(s.match("www.example.com.")).Should(BeTrue())
+	g.Expect(s.match("a.b.Example.com.")).Should(BeTrue())
+	g.Expect(s.match("example.com.")).Should(BeFalse())
+	g.Expect(s.match("chaos-mesh.org.")).Should(BeTrue())
+	g.Expect(s.match("www.chaos-mesh.org.")).Should(BeFalse())
+
+	g.Expect(NewServer(Config{}).match("www.example.com.")).Should(BeTrue())
+}
+
+func TestServer_Forward(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	upstream, err := net.ListenPacket("udp", "127.0.0.1:0")
+	g.Expect(err).ShouldNot(HaveOccurred())
+	defer upstream.Close()
+
+	go func() {
+		buf := make([]byte, 512)
+		n, addr, err := upstream.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		resp, err := reply(dnsmessage.Header{ID: 1024}, dnsmessage.Question{
+			Name:  dnsmessage.MustNewName("www.chaos-mesh.org."),
+			Type:  dnsmessage.TypeA,
+			Class: dnsmessage.ClassINET,
+		}, dnsmessage.RCodeSuccess, false, net.ParseIP("10.0.0.2"))
+		if err == nil && n > 0 {
+			_, _ = upstream.WriteTo(resp, addr)
+		}
+	}()
+
+	s := NewServer(Config{
+		Fault:    core.DNSFaultNXDomain,
+		Patterns: []string{"*.example.com"},
+		Upstream: upstream.LocalAddr().String(),
+	})
+	resp, err := s.handle(newQuery(g, "www.chaos-mesh.org.", dnsmessage.TypeA))
+	g.Expect(err).ShouldNot(HaveOccurred())
+
+	var p dnsmessage.Parser
+	header, err := p.Start(resp)
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(header.RCode).Should(Equal(dnsmessage.RCodeSuccess))
+	g.Expect(p.SkipAllQuestions()).ShouldNot(HaveOccurred())
+
+	answer, err := p.AnswerHeader()
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(answer.Type).Should(Equal(dnsmessage.TypeA))
+}
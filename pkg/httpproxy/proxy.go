@@ -0,0 +1,247 @@
+// Copyright 2021 Chaos Mesh Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpproxy
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"path"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"go.uber.org/zap"
+
+	"github.com/chaos-mesh/chaosd/pkg/core"
+)
+
+// Rule selects the requests impacted by the fault, the empty fields match any request.
+type Rule struct {
+	Method string
+	// Path is a pattern of path.Match, such as /api/*
+	Path string
+	// Headers are matched if every header has the value
+	Headers map[string]string
+}
+
+// Match returns true if the request is selected by the rule.
+func (r *Rule) Match(req *http.Request) bool {
+	if len(r.Method) > 0 && !strings.EqualFold(r.Method, req.Method) {
+		return false
+	}
+
+	if len(r.Path) > 0 {
+		if matched, _ := path.Match(r.Path, req.URL.Path); !matched {
+			return false
+		}
+	}
+
+	for name, value := range r.Headers {
+		if req.Header.Get(name) != value {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Fault is injected into the requests selected by the rule. The requests are delayed
+// and aborted before they are forwarded, the responses are replaced and patched.
+type Fault struct {
+	Delay time.Duration
+	// Abort is the status code responded instead of forwarding the request
+	Abort int
+	// Body replaces the body of the response if it isn't nil
+	Body []byte
+	// Headers are set in the response
+	Headers map[string]string
+}
+
+type Config struct {
+	// Listen is the TCP address the redirected connections are accepted on
+	Listen string
+	// Target is the address which the requests are forwarded to, it's the original
+	// destination of the connection redirected by iptables if empty
+	Target string
+	// Mark is set on the connections to the target, so iptables can skip redirecting them
+	Mark  int
+	Rule  Rule
+	Fault Fault
+}
+
+// NewConfig converts the attack to the config of the proxy listening on the ProxyPort,
+// the connections to the targets are marked with the mark.
+func NewConfig(h *core.HTTPCommand, mark int) (*Config, error) {
+	conf := &Config{
+		Listen: fmt.Sprintf(":%d", h.ProxyPort),
+		Mark:   mark,
+		Rule: Rule{
+			Method:  h.Method,
+			Path:    h.Path,
+			Headers: h.Headers,
+		},
+	}
+
+	switch h.Action {
+	case core.HTTPAbortAction:
+		conf.Fault.Abort = h.Code
+	case core.HTTPDelayAction:
+		delay, err := time.ParseDuration(h.Delay)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		conf.Fault.Delay = delay
+	case core.HTTPReplaceAction:
+		conf.Fault.Body = []byte(h.Body)
+	case core.HTTPPatchAction:
+		conf.Fault.Headers = h.PatchHeaders
+	default:
+		return nil, errors.Errorf("http action %s not supported", h.Action)
+	}
+
+	return conf, nil
+}
+
+type contextKey int
+
+const (
+	targetKey contextKey = iota
+	matchedKey
+)
+
+// Proxy is the transparent HTTP proxy injecting the fault.
+type Proxy struct {
+	conf    Config
+	forward *httputil.ReverseProxy
+}
+
+func NewProxy(conf Config) *Proxy {
+	p := &Proxy{conf: conf}
+
+	dialer := &net.Dialer{Timeout: 30 * time.Second}
+	if conf.Mark > 0 {
+		dialer.Control = func(network, address string, c syscall.RawConn) error {
+			var err error
+			if controlErr := c.Control(func(fd uintptr) {
+				err = markSocket(fd, conf.Mark)
+			}); controlErr != nil {
+				return controlErr
+			}
+			return err
+		}
+	}
+
+	p.forward = &httputil.ReverseProxy{
+		Director: func(req *http.Request) {
+			req.URL.Scheme = "http"
+			req.URL.Host, _ = req.Context().Value(targetKey).(string)
+		},
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			MaxIdleConnsPerHost: 16,
+			IdleConnTimeout:     90 * time.Second,
+		},
+		ModifyResponse: p.modifyResponse,
+	}
+
+	return p
+}
+
+// ListenAndServe listens on the address and serves the redirected connections.
+func (p *Proxy) ListenAndServe() error {
+	listener, err := net.Listen("tcp", p.conf.Listen)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	return p.Serve(listener)
+}
+
+// Serve serves the redirected connections accepted by the listener.
+func (p *Proxy) Serve(listener net.Listener) error {
+	server := &http.Server{
+		Handler: http.HandlerFunc(p.handle),
+		ConnContext: func(ctx context.Context, conn net.Conn) context.Context {
+			target := p.conf.Target
+			if len(target) == 0 {
+				var err error
+				if target, err = originalDst(conn); err != nil {
+					log.Warn("failed to get the original destination", zap.Error(err))
+				}
+			}
+			return context.WithValue(ctx, targetKey, target)
+		},
+	}
+
+	return errors.WithStack(server.Serve(listener))
+}
+
+func (p *Proxy) handle(w http.ResponseWriter, req *http.Request) {
+	if target, _ := req.Context().Value(targetKey).(string); len(target) == 0 {
+		w.WriteHeader(http.StatusBadGateway)
+		return
+	}
+
+	if !p.conf.Rule.Match(req) {
+		p.forward.ServeHTTP(w, req)
+		return
+	}
+
+	if p.conf.Fault.Delay > 0 {
+		select {
+		case <-time.After(p.conf.Fault.Delay):
+		case <-req.Context().Done():
+			return
+		}
+	}
+
+	if p.conf.Fault.Abort > 0 {
+		w.WriteHeader(p.conf.Fault.Abort)
+		return
+	}
+
+	p.forward.ServeHTTP(w, req.WithContext(context.WithValue(req.Context(), matchedKey, true)))
+}
+
+func (p *Proxy) modifyResponse(resp *http.Response) error {
+	if matched, _ := resp.Request.Context().Value(matchedKey).(bool); !matched {
+		return nil
+	}
+
+	if p.conf.Fault.Body != nil {
+		if err := resp.Body.Close(); err != nil {
+			return errors.WithStack(err)
+		}
+
+		resp.Body = ioutil.NopCloser(bytes.NewReader(p.conf.Fault.Body))
+		resp.ContentLength = int64(len(p.conf.Fault.Body))
+		resp.Header.Set("Content-Length", strconv.Itoa(len(p.conf.Fault.Body)))
+		resp.Header.Del("Content-Encoding")
+		resp.TransferEncoding = nil
+	}
+
+	for name, value := range p.conf.Fault.Headers {
+		resp.Header.Set(name, value)
+	}
+
+	return nil
+}
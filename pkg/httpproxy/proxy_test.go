@@ -0,0 +1,142 @@
+// Copyright 2021 Chaos Mesh Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpproxy
+
+import (
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+
+	"github.com/chaos-mesh/chaosd/pkg/core"
+)
+
+func TestRule_Match(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	rule := Rule{
+		Method:  "get",
+		Path:    "/api/*",
+		Headers: map[string]string{"X-User": "chaos"},
+	}
+
+	for _, testCase := range []struct {
+		method  string
+		url     string
+		header  string
+		matched bool
+	}{
+		{http.MethodGet, "/api/users?id=1", "chaos", true},
+		{http.MethodPost, "/api/users", "chaos", false},
+		{http.MethodGet, "/api/users/1", "chaos", false},
+		{http.MethodGet, "/api/users", "mesh", false},
+		{http.MethodGet, "/api/users", "", false},
+	} {
+		req := httptest.NewRequest(testCase.method, testCase.url, nil)
+		if len(testCase.header) > 0 {
+			req.Header.Set("X-User", testCase.header)
+		}
+		g.Expect(rule.Match(req)).Should(Equal(testCase.matched), testCase.method+" "+testCase.url)
+	}
+
+	g.Expect((&Rule{}).Match(httptest.NewRequest(http.MethodPut, "/", nil))).Should(BeTrue())
+}
+
+func TestNewConfig(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	h := &core.HTTPCommand{
+		CommonAttackConfig: core.CommonAttackConfig{Action: core.HTTPDelayAction},
+		Port:               8080,
+		ProxyPort:          18080,
+		Path:               "/api/*",
+		Delay:              "100ms",
+	}
+
+	conf, err := NewConfig(h, 1)
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(conf.Listen).Should(Equal(":18080"))
+	g.Expect(conf.Mark).Should(Equal(1))
+	g.Expect(conf.Rule.Path).Should(Equal("/api/*"))
+	g.Expect(conf.Fault.Delay).Should(Equal(100 * time.Millisecond))
+
+	h.Action = core.HTTPReplaceAction
+	conf, err = NewConfig(h, 1)
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(conf.Fault.Body).Should(Equal([]byte{}))
+}
+
+func TestProxy(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("X-Backend", "true")
+		_, _ = w.Write([]byte("hello " + req.URL.Path))
+	}))
+	defer backend.Close()
+
+	for _, testCase := range []struct {
+		fault  Fault
+		code   int
+		body   string
+		header string
+	}{
+		{Fault{Abort: http.StatusServiceUnavailable}, http.StatusServiceUnavailable, "", ""},
+		{Fault{Delay: 100 * time.Millisecond}, http.StatusOK, "hello /faulty", "true"},
+		{Fault{Body: []byte("replaced")}, http.StatusOK, "replaced", "true"},
+		{Fault{Headers: map[string]string{"X-Backend": "patched"}}, http.StatusOK, "hello /faulty", "patched"},
+	} {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		g.Expect(err).ShouldNot(HaveOccurred())
+
+		proxy := NewProxy(Config{
+			Target: strings.TrimPrefix(backend.URL, "http://"),
+			Rule:   Rule{Path: "/faulty"},
+			Fault:  testCase.fault,
+		})
+		go func() {
+			_ = proxy.Serve(listener)
+		}()
+
+		start := time.Now()
+		resp, err := http.Get("http://" + listener.Addr().String() + "/faulty")
+		g.Expect(err).ShouldNot(HaveOccurred())
+		body, err := ioutil.ReadAll(resp.Body)
+		g.Expect(err).ShouldNot(HaveOccurred())
+		resp.Body.Close()
+
+		g.Expect(resp.StatusCode).Should(Equal(testCase.code))
+		g.Expect(string(body)).Should(Equal(testCase.body))
+		g.Expect(resp.Header.Get("X-Backend")).Should(Equal(testCase.header))
+		g.Expect(time.Since(start)).Should(BeNumerically(">=", testCase.fault.Delay))
+
+		// the requests not matching the rule are forwarded untouched
+		resp, err = http.Get("http://" + listener.Addr().String() + "/healthy")
+		g.Expect(err).ShouldNot(HaveOccurred())
+		body, err = ioutil.ReadAll(resp.Body)
+		g.Expect(err).ShouldNot(HaveOccurred())
+		resp.Body.Close()
+
+		g.Expect(resp.StatusCode).Should(Equal(http.StatusOK))
+		g.Expect(string(body)).Should(Equal("hello /healthy"))
+		g.Expect(resp.Header.Get("X-Backend")).Should(Equal("true"))
+
+		listener.Close()
+	}
+}
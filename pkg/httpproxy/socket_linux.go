@@ -0,0 +1,94 @@
+// Copyright 2021 Chaos Mesh Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpproxy
+
+import (
+	"net"
+	"strconv"
+	"syscall"
+	"unsafe"
+
+	"github.com/pingcap/errors"
+)
+
+// soOriginalDst is the socket option of netfilter to get the original destination
+// of the connection redirected by iptables, IP6T_SO_ORIGINAL_DST of ip6tables has
+// the same value.
+const soOriginalDst = 80
+
+func markSocket(fd uintptr, mark int) error {
+	return syscall.SetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_MARK, mark)
+}
+
+// originalDst returns the original destination of the connection redirected by iptables or
+// ip6tables. The IPv4 connections accepted by an IPv6 socket are redirected by iptables.
+func originalDst(conn net.Conn) (string, error) {
+	tcpConn, ok := conn.(*net.TCPConn)
+	if !ok {
+		return "", errors.Errorf("connection %s is not TCP", conn.RemoteAddr())
+	}
+
+	rawConn, err := tcpConn.SyscallConn()
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	if local, ok := conn.LocalAddr().(*net.TCPAddr); ok && local.IP.To4() == nil {
+		return originalIPv6Dst(rawConn)
+	}
+
+	var (
+		addr    *syscall.IPv6Mreq
+		sockErr error
+	)
+	// the sockaddr_in is got as the IPv6Mreq which is large enough to hold it
+	if err := rawConn.Control(func(fd uintptr) {
+		addr, sockErr = syscall.GetsockoptIPv6Mreq(int(fd), syscall.IPPROTO_IP, soOriginalDst)
+	}); err != nil {
+		return "", errors.WithStack(err)
+	}
+	if sockErr != nil {
+		return "", errors.WithStack(sockErr)
+	}
+
+	raw := addr.Multiaddr
+	port := int(raw[2])<<8 | int(raw[3])
+	ip := net.IPv4(raw[4], raw[5], raw[6], raw[7])
+
+	return net.JoinHostPort(ip.String(), strconv.Itoa(port)), nil
+}
+
+// originalIPv6Dst returns the original destination of the IPv6 connection redirected by ip6tables.
+func originalIPv6Dst(rawConn syscall.RawConn) (string, error) {
+	var (
+		info    *syscall.IPv6MTUInfo
+		sockErr error
+	)
+	// the sockaddr_in6 is got as the IPv6MTUInfo which starts with it
+	if err := rawConn.Control(func(fd uintptr) {
+		info, sockErr = syscall.GetsockoptIPv6MTUInfo(int(fd), syscall.IPPROTO_IPV6, soOriginalDst)
+	}); err != nil {
+		return "", errors.WithStack(err)
+	}
+	if sockErr != nil {
+		return "", errors.WithStack(sockErr)
+	}
+
+	// the port is in network byte order
+	raw := (*[2]byte)(unsafe.Pointer(&info.Addr.Port)) // #nosec
+	port := int(raw[0])<<8 | int(raw[1])
+	ip := net.IP(info.Addr.Addr[:])
+
+	return net.JoinHostPort(ip.String(), strconv.Itoa(port)), nil
+}
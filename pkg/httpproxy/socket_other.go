@@ -0,0 +1,30 @@
+// +build !linux
+
+// Copyright 2021 Chaos Mesh Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpproxy
+
+import (
+	"net"
+
+	"github.com/pingcap/errors"
+)
+
+func markSocket(fd uintptr, mark int) error {
+	return errors.New("socket mark is only supported on linux")
+}
+
+func originalDst(conn net.Conn) (string, error) {
+	return "", errors.New("original destination is only supported on linux")
+}
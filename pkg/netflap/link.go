@@ -0,0 +1,191 @@
+// Copyright 2021 Chaos Mesh Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package netflap
+
+import (
+	"net"
+	"syscall"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/vishvananda/netlink"
+
+	"github.com/chaos-mesh/chaosd/pkg/core"
+)
+
+// rtprotKernel is the protocol of the routes added by the kernel, which are added
+// again by the kernel when the addresses are restored.
+const rtprotKernel = 2
+
+// GetLinkState returns the state of the device. The IPv6 link-local addresses and
+// the routes added by the kernel are ignored, because they are added back automatically.
+func GetLinkState(device string) (*core.LinkState, error) {
+	link, err := netlink.LinkByName(device)
+	if err != nil {
+		return nil, errors.Annotatef(err, "get device %s", device)
+	}
+
+	state := &core.LinkState{
+		Up:        link.Attrs().Flags&net.FlagUp != 0,
+		MTU:       link.Attrs().MTU,
+		Addresses: make([]string, 0),
+		Routes:    make([]core.LinkRoute, 0),
+	}
+
+	addrs, err := netlink.AddrList(link, netlink.FAMILY_ALL)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	for _, addr := range addrs {
+		if addr.IP.To4() == nil && addr.IP.IsLinkLocalUnicast() {
+			continue
+		}
+		state.Addresses = append(state.Addresses, addr.IPNet.String())
+	}
+
+	routes, err := netlink.RouteList(link, netlink.FAMILY_ALL)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	for _, route := range routes {
+		if route.Protocol == rtprotKernel {
+			continue
+		}
+		state.Routes = append(state.Routes, fromNetlinkRoute(route))
+	}
+
+	return state, nil
+}
+
+// Down brings the device down.
+func Down(device string) error {
+	link, err := netlink.LinkByName(device)
+	if err != nil {
+		return errors.Annotatef(err, "get device %s", device)
+	}
+
+	return errors.WithStack(netlink.LinkSetDown(link))
+}
+
+// Restore restores the device to the state, the addresses and routes which
+// still exist are ignored.
+func Restore(s *core.LinkState, device string) error {
+	link, err := netlink.LinkByName(device)
+	if err != nil {
+		return errors.Annotatef(err, "get device %s", device)
+	}
+
+	if link.Attrs().MTU != s.MTU {
+		if err := netlink.LinkSetMTU(link, s.MTU); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	if err := netlink.LinkSetUp(link); err != nil {
+		return errors.WithStack(err)
+	}
+
+	for _, address := range s.Addresses {
+		addr, err := netlink.ParseAddr(address)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		if err := netlink.AddrAdd(link, addr); err != nil && err != syscall.EEXIST {
+			return errors.Annotatef(err, "add address %s", address)
+		}
+	}
+
+	// the gateways must be reachable by the routes without gateway
+	for _, gateway := range []bool{false, true} {
+		for _, r := range s.Routes {
+			if (len(r.Gw) > 0) != gateway {
+				continue
+			}
+
+			route, err := toNetlinkRoute(r, link)
+			if err != nil {
+				return errors.WithStack(err)
+			}
+
+			if err := netlink.RouteAdd(route); err != nil && err != syscall.EEXIST {
+				return errors.Annotatef(err, "add route %s", route)
+			}
+		}
+	}
+
+	if !s.Up {
+		return errors.WithStack(netlink.LinkSetDown(link))
+	}
+
+	return nil
+}
+
+// Flap brings the device down for the down time and restores it for the up time by turns,
+// it never returns unless an error occurs.
+func Flap(s *core.LinkState, device string, down, up time.Duration) error {
+	for {
+		if err := Down(device); err != nil {
+			return err
+		}
+		time.Sleep(down)
+
+		if err := Restore(s, device); err != nil {
+			return err
+		}
+		time.Sleep(up)
+	}
+}
+
+func fromNetlinkRoute(route netlink.Route) core.LinkRoute {
+	r := core.LinkRoute{
+		Scope:    uint8(route.Scope),
+		Protocol: route.Protocol,
+		Priority: route.Priority,
+		Table:    route.Table,
+	}
+	if route.Dst != nil {
+		r.Dst = route.Dst.String()
+	}
+	if route.Gw != nil {
+		r.Gw = route.Gw.String()
+	}
+	if route.Src != nil {
+		r.Src = route.Src.String()
+	}
+
+	return r
+}
+
+func toNetlinkRoute(r core.LinkRoute, link netlink.Link) (*netlink.Route, error) {
+	route := &netlink.Route{
+		LinkIndex: link.Attrs().Index,
+		Scope:     netlink.Scope(r.Scope),
+		Protocol:  r.Protocol,
+		Priority:  r.Priority,
+		Table:     r.Table,
+		Gw:        net.ParseIP(r.Gw),
+		Src:       net.ParseIP(r.Src),
+	}
+
+	if len(r.Dst) > 0 {
+		_, dst, err := net.ParseCIDR(r.Dst)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		route.Dst = dst
+	}
+
+	return route, nil
+}
@@ -0,0 +1,44 @@
+// Copyright 2021 Chaos Mesh Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package netflap
+
+import (
+	"net"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"github.com/vishvananda/netlink"
+
+	"github.com/chaos-mesh/chaosd/pkg/core"
+)
+
+func TestRoute(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	_, dst, _ := net.ParseCIDR("10.0.0.0/8")
+	link := &netlink.Dummy{LinkAttrs: netlink.LinkAttrs{Index: 3}}
+
+	for _, route := range []netlink.Route{
+		{LinkIndex: 3, Gw: net.ParseIP("192.168.0.1"), Protocol: 3, Priority: 100, Table: 254},
+		{LinkIndex: 3, Dst: dst, Src: net.ParseIP("10.0.0.2"), Scope: netlink.SCOPE_LINK, Table: 254},
+		{LinkIndex: 3, Gw: net.ParseIP("fe80::1"), Protocol: 9, Priority: 1024, Table: 254},
+	} {
+		r, err := toNetlinkRoute(fromNetlinkRoute(route), link)
+		g.Expect(err).ShouldNot(HaveOccurred())
+		g.Expect(r.Equal(route)).To(BeTrue(), route.String())
+	}
+
+	_, err := toNetlinkRoute(core.LinkRoute{Dst: "10.0.0.0"}, link)
+	g.Expect(err).Should(HaveOccurred())
+}
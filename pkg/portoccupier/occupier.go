@@ -0,0 +1,164 @@
+// Copyright 2021 Chaos Mesh Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package portoccupier
+
+import (
+	"io"
+	"io/ioutil"
+	"net"
+	"strconv"
+	"syscall"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"go.uber.org/zap"
+
+	"github.com/chaos-mesh/chaosd/pkg/core"
+)
+
+// The protocols of occupying ports.
+const (
+	ProtocolTCP = "tcp"
+	ProtocolUDP = "udp"
+)
+
+// Occupier holds the sockets occupying the ports.
+type Occupier struct {
+	closers []io.Closer
+}
+
+// Occupy occupies the ports of the protocols in the mode, the sockets are bound on
+// both IPv4 and IPv6 addresses. The occupied ports are released if any port fails.
+func Occupy(ports []uint16, protocols []string, mode string) (*Occupier, error) {
+	o := &Occupier{}
+	for _, protocol := range protocols {
+		for _, port := range ports {
+			if err := o.occupy(protocol, port, mode); err != nil {
+				o.Close()
+				return nil, errors.Annotatef(err, "occupy %s port %d", protocol, port)
+			}
+		}
+	}
+
+	return o, nil
+}
+
+func (o *Occupier) occupy(protocol string, port uint16, mode string) error {
+	address := net.JoinHostPort("", strconv.Itoa(int(port)))
+	switch {
+	case protocol == ProtocolTCP && mode == core.PortOccupyModeAccept:
+		listener, err := net.Listen("tcp", address)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		o.closers = append(o.closers, listener)
+		go accept(listener)
+	case protocol == ProtocolUDP && mode == core.PortOccupyModeAccept:
+		conn, err := net.ListenPacket("udp", address)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		o.closers = append(o.closers, conn)
+		go discard(conn)
+	case protocol == ProtocolTCP || protocol == ProtocolUDP:
+		sotype := syscall.SOCK_STREAM
+		if protocol == ProtocolUDP {
+			sotype = syscall.SOCK_DGRAM
+		}
+
+		fd, err := bind(sotype, port)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		o.closers = append(o.closers, fd)
+
+		if protocol == ProtocolTCP && mode == core.PortOccupyModeListen {
+			if err := syscall.Listen(int(fd), 1); err != nil {
+				return errors.WithStack(err)
+			}
+		}
+	default:
+		return errors.Errorf("protocol %s not supported", protocol)
+	}
+
+	return nil
+}
+
+// Close releases all the ports.
+func (o *Occupier) Close() {
+	for _, closer := range o.closers {
+		if err := closer.Close(); err != nil {
+			log.Warn("failed to release port", zap.Error(err))
+		}
+	}
+	o.closers = nil
+}
+
+type socketFd int
+
+func (fd socketFd) Close() error {
+	return syscall.Close(int(fd))
+}
+
+// bind binds a socket on the port of both IPv4 and IPv6 addresses,
+// or only on IPv4 addresses if IPv6 is disabled.
+func bind(sotype int, port uint16) (socketFd, error) {
+	fd, err := syscall.Socket(syscall.AF_INET6, sotype, 0)
+	if err != nil {
+		if fd, err = syscall.Socket(syscall.AF_INET, sotype, 0); err != nil {
+			return -1, errors.WithStack(err)
+		}
+
+		if err := syscall.Bind(fd, &syscall.SockaddrInet4{Port: int(port)}); err != nil {
+			syscall.Close(fd)
+			return -1, errors.WithStack(err)
+		}
+		return socketFd(fd), nil
+	}
+
+	if err := syscall.SetsockoptInt(fd, syscall.IPPROTO_IPV6, syscall.IPV6_V6ONLY, 0); err != nil {
+		syscall.Close(fd)
+		return -1, errors.WithStack(err)
+	}
+
+	if err := syscall.Bind(fd, &syscall.SockaddrInet6{Port: int(port)}); err != nil {
+		syscall.Close(fd)
+		return -1, errors.WithStack(err)
+	}
+
+	return socketFd(fd), nil
+}
+
+func accept(listener net.Listener) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+
+		go func() {
+			defer conn.Close()
+			_, _ = io.Copy(ioutil.Discard, conn)
+		}()
+	}
+}
+
+func discard(conn net.PacketConn) {
+	buf := make([]byte, 65535)
+	for {
+		if _, _, err := conn.ReadFrom(buf); err != nil {
+			return
+		}
+	}
+}
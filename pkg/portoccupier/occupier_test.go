@@ -0,0 +1,58 @@
+// Copyright 2021 Chaos Mesh Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package portoccupier
+
+import (
+	"net"
+	"strconv"
+	"testing"
+
+	. "github.com/onsi/gomega"
+
+	"github.com/chaos-mesh/chaosd/pkg/core"
+)
+
+func freePort(g *WithT) uint16 {
+	listener, err := net.Listen("tcp", ":0")
+	g.Expect(err).ShouldNot(HaveOccurred())
+	defer listener.Close()
+
+	return uint16(listener.Addr().(*net.TCPAddr).Port)
+}
+
+func TestOccupy(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	for _, mode := range []string{core.PortOccupyModeAccept, core.PortOccupyModeListen, core.PortOccupyModeBind} {
+		port := freePort(g)
+		address := ":" + strconv.Itoa(int(port))
+
+		o, err := Occupy([]uint16{port}, []string{ProtocolTCP, ProtocolUDP}, mode)
+		g.Expect(err).ShouldNot(HaveOccurred(), mode)
+
+		_, err = net.Listen("tcp", address)
+		g.Expect(err).Should(HaveOccurred(), mode)
+		_, err = net.ListenPacket("udp", address)
+		g.Expect(err).Should(HaveOccurred(), mode)
+
+		// the ports occupied before are released if any port fails
+		_, err = Occupy([]uint16{freePort(g), port}, []string{ProtocolTCP}, mode)
+		g.Expect(err).Should(HaveOccurred(), mode)
+
+		o.Close()
+		listener, err := net.Listen("tcp", address)
+		g.Expect(err).ShouldNot(HaveOccurred(), mode)
+		listener.Close()
+	}
+}
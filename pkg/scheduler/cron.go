@@ -37,8 +37,8 @@ type CronJob struct {
 	// immutable fields
 	scheduler   *Scheduler
 	experiment  *core.Experiment
-	attackFunc  func() error
-	recoverFunc func() error
+	attackFunc  func(run *core.ExperimentRun) error
+	recoverFunc func(run *core.ExperimentRun) error
 
 	// mutable fields protected by sync.Locker
 	waitForRecovery bool
@@ -52,7 +52,7 @@ func hasCronDurationExceeded(startedAt time.Time, duration time.Duration) bool {
 func (cj *CronJob) RecoverRun(expRun *core.ExperimentRun) {
 	defer cj.setWaitForRecovery(false)
 	log.Info("recovering attack on exp run", zap.String("expRunUID", expRun.UID))
-	if err := cj.recoverFunc(); err != nil {
+	if err := cj.recoverFunc(expRun); err != nil {
 		log.Warn("recovery failed", zap.Error(err))
 	} else {
 		if err := cj.scheduler.expRunStore.Update(context.Background(), expRun.UID, core.RunRecovered, ""); err != nil {
@@ -137,7 +137,7 @@ func (cj *CronJob) Run() {
 	}
 
 	log.Info("executing attack on new exp run", zap.String("expRunUID", newRun.UID))
-	if err = cj.attackFunc(); err != nil {
+	if err = cj.attackFunc(newRun); err != nil {
 		panic(perr.WithMessage(err, "attack failed"))
 	}
 }
@@ -156,7 +156,7 @@ func NewScheduler(expRunStore core.ExperimentRunStore, expStore core.ExperimentS
 }
 
 func (scheduler *Scheduler) Schedule(
-	exp *core.Experiment, spec string, attackFunc func() error, recoverFunc func() error) error {
+	exp *core.Experiment, spec string, attackFunc func(run *core.ExperimentRun) error, recoverFunc func(run *core.ExperimentRun) error) error {
 	cj := CronJob{
 		scheduler:   scheduler,
 		experiment:  exp,
@@ -15,6 +15,9 @@ package chaosd
 
 import (
 	"context"
+	"encoding/json"
+	"reflect"
+	"sync"
 
 	"github.com/google/uuid"
 	"github.com/pingcap/log"
@@ -86,11 +89,53 @@ func (s *Server) ExecuteAttack(attackType AttackType, options core.AttackConfig,
 
 	env := s.newEnvironment(uid)
 	if len(options.Cron()) > 0 {
+		// every run attacks with a copy of the options, and the attack with the state recorded by
+		// it, such as the pid of background process, is saved in the run to recover the run.
+		// The recovery waits for the attack.
+		var runLock sync.Mutex
 		if err = s.Cron.Schedule(
 			exp,
 			options.Cron(),
-			func() error { return attackType.Attack(options, env) },
-			func() error { return attackType.Recover(*exp, env) },
+			func(run *core.ExperimentRun) error {
+				runLock.Lock()
+				defer runLock.Unlock()
+
+				runOptions, err := newRunOptions(options)
+				if err != nil {
+					return perr.WithStack(err)
+				}
+
+				err = attackType.Attack(runOptions, env)
+				if updateErr := s.ExpRun.UpdateRecoverCommand(context.Background(), run.UID, runOptions.RecoverData()); updateErr != nil {
+					log.Error("failed to update experiment run", zap.String("run", run.UID), zap.Error(updateErr))
+					if err == nil {
+						err = perr.WithStack(updateErr)
+					}
+				}
+				return err
+			},
+			func(run *core.ExperimentRun) error {
+				runLock.Lock()
+				defer runLock.Unlock()
+
+				saved, err := s.ExpRun.FindByUID(context.Background(), run.UID)
+				if err != nil {
+					return perr.WithStack(err)
+				}
+				if saved == nil || len(saved.RecoverCommand) == 0 {
+					return perr.Errorf("the attack of run of experiment %s not found", exp.Uid)
+				}
+
+				// the request command parsed and cached by the experiment is not copied
+				return attackType.Recover(core.Experiment{
+					ID:             exp.ID,
+					Uid:            exp.Uid,
+					Kind:           exp.Kind,
+					Action:         exp.Action,
+					RecoverCommand: saved.RecoverCommand,
+					LaunchMode:     exp.LaunchMode,
+				}, env)
+			},
 		); err != nil {
 			err = perr.WithStack(err)
 			return
@@ -103,3 +148,13 @@ func (s *Server) ExecuteAttack(attackType AttackType, options core.AttackConfig,
 	}
 	return
 }
+
+// newRunOptions returns a copy of the options for a run of scheduled experiment.
+func newRunOptions(options core.AttackConfig) (core.AttackConfig, error) {
+	runOptions := reflect.New(reflect.TypeOf(options).Elem()).Interface().(core.AttackConfig)
+	if err := json.Unmarshal([]byte(options.RecoverData()), runOptions); err != nil {
+		return nil, perr.WithStack(err)
+	}
+
+	return runOptions, nil
+}
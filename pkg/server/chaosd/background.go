@@ -0,0 +1,175 @@
+// Copyright 2021 Chaos Mesh Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package chaosd
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/chaos-mesh/chaos-mesh/pkg/bpm"
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"github.com/shirou/gopsutil/process"
+	"go.uber.org/zap"
+)
+
+const (
+	// processReadyTimeout is the timeout of waiting for the background process to be ready.
+	processReadyTimeout = 5 * time.Second
+	// processReady is the line written by the background process when it's ready.
+	processReady = "ready"
+)
+
+// startChaosdProcess starts a hidden subcommand of chaosd itself in background, such as
+// `attack network port-occupier`, which keeps running until it is killed.
+func startChaosdProcess(args ...string) (*process.Process, error) {
+	cmd, err := chaosdCommand(args...)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return startProcess(cmd)
+}
+
+// startReadyChaosdProcess starts the hidden subcommand like startChaosdProcess, and waits until
+// the subcommand reports it's ready by NotifyReady, the info reported with it is returned. The
+// output of the subcommand is returned as the error if it exits before it's ready, and it's killed
+// if it's not ready in time.
+func startReadyChaosdProcess(args ...string) (*process.Process, string, error) {
+	cmd, err := chaosdCommand(args...)
+	if err != nil {
+		return nil, "", errors.WithStack(err)
+	}
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		return nil, "", errors.WithStack(err)
+	}
+	defer r.Close()
+
+	cmd.Cmd.Stdout = w
+	cmd.Cmd.Stderr = w
+	proc, err := startProcess(cmd)
+	// the reader gets EOF when the process exits only if the writer of chaosd is closed
+	w.Close()
+	if err != nil {
+		return nil, "", errors.WithStack(err)
+	}
+
+	var info string
+	ready := make(chan error, 1)
+	go func() {
+		var output []string
+		scanner := bufio.NewScanner(r)
+		for scanner.Scan() {
+			if fields := strings.SplitN(scanner.Text(), " ", 2); fields[0] == processReady {
+				if len(fields) == 2 {
+					info = fields[1]
+				}
+				ready <- nil
+				return
+			}
+			output = append(output, scanner.Text())
+		}
+
+		ready <- errors.Errorf("the process exited before it's ready, output: %s", strings.Join(output, "\n"))
+	}()
+
+	select {
+	case err = <-ready:
+	case <-time.After(processReadyTimeout):
+		err = errors.Errorf("the process isn't ready in %s", processReadyTimeout)
+	}
+
+	if err != nil {
+		if err := proc.Kill(); err != nil {
+			log.Error("the process kill failed", zap.Error(err))
+		}
+		return nil, "", err
+	}
+
+	return proc, info, nil
+}
+
+// NotifyReady is called by the hidden subcommand started by startReadyChaosdProcess when it's ready,
+// the info, such as the port bound by the subcommand, is returned by startReadyChaosdProcess. chaosd
+// closes the pipe of stdout and stderr after reading it, so SIGPIPE is ignored to keep the subcommand
+// running when it writes to them later.
+func NotifyReady(info string) {
+	signal.Ignore(syscall.SIGPIPE)
+	if len(info) == 0 {
+		fmt.Println(processReady)
+		return
+	}
+	fmt.Println(processReady + " " + info)
+}
+
+func chaosdCommand(args ...string) (*bpm.ManagedProcess, error) {
+	executable, err := os.Executable()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	cmd := bpm.DefaultProcessBuilder(executable, args...).Build()
+	cmd.Cmd.SysProcAttr = &syscall.SysProcAttr{}
+
+	return cmd, nil
+}
+
+func startProcess(cmd *bpm.ManagedProcess) (*process.Process, error) {
+	backgroundProcessManager := bpm.NewBackgroundProcessManager()
+	if err := backgroundProcessManager.StartProcess(cmd); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	proc, err := process.NewProcess(int32(cmd.Process.Pid))
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return proc, nil
+}
+
+// killChaosdProcess kills the process started by startChaosdProcess, which is identified
+// by the pid and create time, in case the pid is reused after the process exited.
+func killChaosdProcess(pid int32, createTime int64, subcommand string) error {
+	proc, err := process.NewProcess(pid)
+	if err != nil {
+		log.Warn("the process is not running", zap.String("subcommand", subcommand), zap.Int32("pid", pid), zap.Error(err))
+		return nil
+	}
+
+	procCreateTime, err := proc.CreateTime()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if procCreateTime != createTime {
+		log.Warn("the process is not the one started by chaosd, maybe it is killed by manual",
+			zap.String("subcommand", subcommand), zap.Int32("pid", pid))
+		return nil
+	}
+
+	if err := proc.Kill(); err != nil {
+		log.Error("the process kill failed", zap.String("subcommand", subcommand), zap.Error(err))
+		return errors.WithStack(err)
+	}
+
+	return nil
+}
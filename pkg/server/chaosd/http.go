@@ -0,0 +1,150 @@
+// Copyright 2021 Chaos Mesh Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package chaosd
+
+import (
+	"strconv"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"go.uber.org/zap"
+
+	"github.com/chaos-mesh/chaosd/pkg/core"
+)
+
+// HTTPProxyMark is the mark of the connections from the HTTP proxies to the services,
+// which are not redirected to the proxies again.
+const HTTPProxyMark = 0x20000
+
+type httpAttack struct{}
+
+var HTTPAttack AttackType = httpAttack{}
+
+// Attack starts chaosd itself in background as the proxy, then redirects the traffic
+// to the port of service to the proxy by the nat chains of iptables and ip6tables.
+func (httpAttack) Attack(options core.AttackConfig, env Environment) error {
+	attack := options.(*core.HTTPCommand)
+
+	// the proxy binds the port itself and reports it, the port chosen automatically is saved
+	// in the attack for recovering
+	proc, port, err := startReadyChaosdProcess("attack", "http", "proxy", "--config", attack.RecoverData())
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	attack.ProxyPid = proc.Pid
+	if attack.ProxyPidCreateTime, err = proc.CreateTime(); err != nil {
+		return errors.WithStack(err)
+	}
+
+	if attack.ProxyPort, err = strconv.Atoi(port); err != nil {
+		return errors.Errorf("the http proxy reports invalid port %s", port)
+	}
+
+	if err := env.Chaos.setHTTPRedirect(attack); err != nil {
+		if err := env.Chaos.recoverHTTPRedirect(attack); err != nil {
+			log.Error("failed to remove the http redirect", zap.Error(err))
+		}
+		if err := proc.Kill(); err != nil {
+			log.Error("the http proxy kill failed", zap.Error(err))
+		}
+		return errors.WithStack(err)
+	}
+
+	return nil
+}
+
+func (httpAttack) Recover(exp core.Experiment, env Environment) error {
+	config, err := exp.GetRequestCommand()
+	if err != nil {
+		return err
+	}
+	attack := config.(*core.HTTPCommand)
+
+	// the traffic is redirected to the service before the proxy is stopped
+	if err := env.Chaos.recoverHTTPRedirect(attack); err != nil {
+		return errors.WithStack(err)
+	}
+
+	return killChaosdProcess(attack.ProxyPid, attack.ProxyPidCreateTime, "http proxy")
+}
+
+// httpChain is the nat chain shared by the http attacks, which is jumped from PREROUTING for
+// the remote clients and OUTPUT for the local clients.
+const httpChain = "CHAOS-HTTP"
+
+var httpChainHooks = []string{"PREROUTING", "OUTPUT"}
+
+// httpRedirectRule returns the rule of httpChain redirecting the TCP traffic to the port of service
+// to the proxy, the traffic sent by the proxy itself is skipped by its mark.
+func httpRedirectRule(attack *core.HTTPCommand) []string {
+	return []string{
+		"--protocol", "tcp", "--destination-port", strconv.Itoa(attack.Port),
+		"-m", "mark", "!", "--mark", strconv.Itoa(HTTPProxyMark),
+		"-j", "REDIRECT", "--to-ports", strconv.Itoa(attack.ProxyPort),
+	}
+}
+
+// setHTTPRedirect appends the redirect rule of the attack to httpChain of iptables and ip6tables.
+// The IPv6 traffic isn't redirected if the nat table of ip6tables isn't supported.
+func (s *Server) setHTTPRedirect(attack *core.HTTPCommand) error {
+	for _, iptables := range []string{"iptables", "ip6tables"} {
+		if iptables == "ip6tables" {
+			if err := s.checkNetNSCommand("", iptables, "-w", "-t", "nat", "-S", "OUTPUT"); err != nil {
+				log.Warn("the IPv6 traffic isn't redirected, the nat table of ip6tables isn't supported", zap.Error(err))
+				continue
+			}
+		}
+
+		if err := s.ensureIptablesChain("", iptables, "nat", httpChain); err != nil {
+			return errors.WithStack(err)
+		}
+
+		if err := s.ensureIptablesRule("", iptables, "nat", httpChain, httpRedirectRule(attack)...); err != nil {
+			return errors.WithStack(err)
+		}
+
+		for _, hook := range httpChainHooks {
+			if err := s.ensureIptablesRule("", iptables, "nat", hook, "-j", httpChain); err != nil {
+				return errors.WithStack(err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// recoverHTTPRedirect deletes the redirect rule of the attack from httpChain of iptables and ip6tables,
+// and httpChain is deleted after the rules of all attacks are deleted.
+func (s *Server) recoverHTTPRedirect(attack *core.HTTPCommand) error {
+	for _, iptables := range []string{"iptables", "ip6tables"} {
+		if _, ok := s.iptablesChainRules("", iptables, "nat", httpChain); !ok {
+			continue
+		}
+
+		if err := s.deleteIptablesRule("", iptables, "nat", httpChain, httpRedirectRule(attack)...); err != nil {
+			return errors.WithStack(err)
+		}
+
+		if rules, _ := s.iptablesChainRules("", iptables, "nat", httpChain); len(rules) > 0 {
+			continue
+		}
+
+		if err := s.deleteIptablesChain("", iptables, "nat", httpChain, httpChainHooks); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	return nil
+}
@@ -14,18 +14,13 @@
 package chaosd
 
 import (
-	"bufio"
 	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"os"
-	"os/exec"
-	"regexp"
 	"strings"
-	"syscall"
 
-	"github.com/chaos-mesh/chaos-mesh/pkg/bpm"
 	"github.com/shirou/gopsutil/process"
 
 	"go.uber.org/zap"
@@ -37,22 +32,33 @@ import (
 	"github.com/chaos-mesh/chaos-mesh/pkg/chaosdaemon/pb"
 
 	"github.com/chaos-mesh/chaosd/pkg/core"
+	"github.com/chaos-mesh/chaosd/pkg/utils"
 )
 
 type networkAttack struct{}
 
 var NetworkAttack AttackType = networkAttack{}
 
+const (
+	etcHostsFile = "/etc/hosts"
+)
+
 func (networkAttack) Attack(options core.AttackConfig, env Environment) (err error) {
 	attack := options.(*core.NetworkCommand)
-	var (
-		ipsetName string
-	)
+
+	env.Chaos.networkLock.Lock()
+	defer env.Chaos.networkLock.Unlock()
 
 	switch attack.Action {
 	case core.NetworkDNSAction:
 		if attack.NeedApplyEtcHosts() {
-			if err = env.Chaos.applyEtcHosts(attack, env.AttackUid, env); err != nil {
+			if err = env.Chaos.applyEtcHosts(attack); err != nil {
+				return errors.WithStack(err)
+			}
+		}
+
+		if attack.NeedApplyFakeDNSServer() {
+			if err = env.Chaos.startFakeDNSServer(attack); err != nil {
 				return errors.WithStack(err)
 			}
 		}
@@ -66,22 +72,69 @@ func (networkAttack) Attack(options core.AttackConfig, env Environment) (err err
 	case core.NetworkPortOccupied:
 		return env.Chaos.applyPortOccupied(attack)
 
-	case core.NetworkDelayAction, core.NetworkLossAction, core.NetworkCorruptAction, core.NetworkDuplicateAction:
-		if attack.NeedApplyIPSet() {
-			ipsetName, err = env.Chaos.applyIPSet(attack, env.AttackUid)
-			if err != nil {
+	case core.NetworkFlapAction:
+		return env.Chaos.applyFlap(attack)
+
+	case core.NetworkDelayAction, core.NetworkLossAction, core.NetworkCorruptAction, core.NetworkDuplicateAction,
+		core.NetworkBandwidthAction, core.NetworkReorderAction, core.NetworkNetemAction:
+		return env.Chaos.applyTCAttack(attack, env.AttackUid)
+
+	case core.NetworkPartitionAction, core.NetworkRejectAction:
+		return env.Chaos.applyIptablesAttack(attack, env.AttackUid)
+
+	case core.NetworkPacketAction:
+		// the delayed packets are marked and redirected to ifb devices like the cgroup tc attacks
+		if attack.NeedApplyTC() {
+			return env.Chaos.applyTCAttack(attack, env.AttackUid)
+		}
+		return env.Chaos.applyIptablesAttack(attack, env.AttackUid)
+	}
+
+	return nil
+}
+
+// applyTCAttack applies the ipset, iptables chains and tc rules of the attack based on tc.
+func (s *Server) applyTCAttack(attack *core.NetworkCommand, uid string) (err error) {
+	devices, err := s.resolveDevices(attack)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if (attack.NeedApplyIngressTC() || attack.NeedApplyMarkTC()) && len(devices) > maxIfbDevices {
+		return errors.Errorf("%d devices are selected, but the traffic of at most %d devices can be redirected to ifb devices",
+			len(devices), maxIfbDevices)
+	}
+	// the resolved devices are saved in the recover data to recover every one of them
+	attack.Device = strings.Join(devices, ",")
+
+	var ipsetName string
+	if attack.NeedApplyIPSet() {
+		ipsetName, err = s.applyIPSet(attack, uid)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	if attack.NeedApplyIptables() {
+		if err = s.applyIptables(attack, ipsetName, uid); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	for i, device := range devices {
+		if attack.NeedApplyEgressTC() {
+			if err = s.applyTC(attack, device, ipsetName, uid); err != nil {
 				return errors.WithStack(err)
 			}
 		}
 
-		if attack.NeedApplyIptables() {
-			if err = env.Chaos.applyIptables(attack, env.AttackUid); err != nil {
+		if attack.NeedApplyIngressTC() {
+			if err = s.applyIngressTC(attack, device, ifbDeviceName(uid, i), ipsetName, uid); err != nil {
 				return errors.WithStack(err)
 			}
 		}
 
-		if attack.NeedApplyTC() {
-			if err = env.Chaos.applyTC(attack, ipsetName, env.AttackUid); err != nil {
+		if attack.NeedApplyMarkTC() {
+			if err = s.applyMarkTC(attack, device, ifbDeviceName(uid, i), ipsetName, uid); err != nil {
 				return errors.WithStack(err)
 			}
 		}
@@ -90,224 +143,329 @@ func (networkAttack) Attack(options core.AttackConfig, env Environment) (err err
 	return nil
 }
 
+// applyIptablesAttack applies the ipset and iptables chains of the attack based on iptables.
+func (s *Server) applyIptablesAttack(attack *core.NetworkCommand, uid string) error {
+	ipsetName, err := s.applyIPSet(attack, uid)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	return s.applyIptables(attack, ipsetName, uid)
+}
+
 func (s *Server) applyIPSet(attack *core.NetworkCommand, uid string) (string, error) {
-	ipset, err := attack.ToIPSet(fmt.Sprintf("chaos-%s", uid[:16]))
+	ipset, ipv6Set, err := attack.ToIPSets(fmt.Sprintf("chaos-%s", uid[:16]))
 	if err != nil {
 		return "", errors.WithStack(err)
 	}
 
 	if _, err := s.svr.FlushIPSets(context.Background(), &pb.IPSetsRequest{
-		Ipsets:  []*pb.IPSet{ipset},
-		EnterNS: false,
+		Ipsets:      []*pb.IPSet{ipset},
+		ContainerId: attack.ContainerID,
+		EnterNS:     attack.EnterNS(),
 	}); err != nil {
 		return "", errors.WithStack(err)
 	}
 
 	if err := s.ipsetRule.Set(context.Background(), &core.IPSetRule{
-		Name:       ipset.Name,
-		Cidrs:      strings.Join(ipset.Cidrs, ","),
-		Experiment: uid,
+		Name:        ipset.Name,
+		Cidrs:       strings.Join(ipset.Cidrs, ","),
+		Family:      core.FamilyIPv4,
+		Experiment:  uid,
+		ContainerID: attack.ContainerID,
 	}); err != nil {
 		return "", errors.WithStack(err)
 	}
 
+	if ipv6Set != nil {
+		if err := s.flushIPv6Set(attack.ContainerID, ipv6Set); err != nil {
+			return "", errors.WithStack(err)
+		}
+
+		if err := s.ipsetRule.Set(context.Background(), &core.IPSetRule{
+			Name:        ipv6Set.Name,
+			Cidrs:       strings.Join(ipv6Set.Cidrs, ","),
+			Family:      core.FamilyIPv6,
+			Experiment:  uid,
+			ContainerID: attack.ContainerID,
+		}); err != nil {
+			return "", errors.WithStack(err)
+		}
+	}
+
 	return ipset.Name, nil
 }
 
-func (s *Server) applyIptables(attack *core.NetworkCommand, uid string) error {
-	iptables, err := s.iptablesRule.List(context.Background())
+func (s *Server) applyIptables(attack *core.NetworkCommand, ipset string, uid string) error {
+	iptables, err := s.iptablesRule.FindByContainerID(context.Background(), attack.ContainerID)
 	if err != nil {
 		return errors.WithStack(err)
 	}
-	chains := core.IptablesRuleList(iptables).ToChains()
-	newChain, err := attack.ToChain()
+	ipv4Rules, _ := core.IptablesRuleList(iptables).SplitByFamily()
+	chains := ipv4Rules.ToChains()
+	newChains, err := attack.ToChains(uid[:16], ipset)
 	if err != nil {
 		return errors.WithStack(err)
 	}
 
-	if newChain != nil {
-		chains = append(chains, newChain)
-	}
+	chains = append(chains, newChains...)
 
 	if _, err := s.svr.SetIptablesChains(context.Background(), &pb.IptablesChainsRequest{
-		Chains:  chains,
-		EnterNS: false,
+		Chains:      chains,
+		ContainerId: attack.ContainerID,
+		EnterNS:     attack.EnterNS(),
 	}); err != nil {
 		return errors.WithStack(err)
 	}
 
-	// TODO: cwen0
-	//if err := s.iptablesRule.Set(context.Background(), &core.IptablesRule{
-	//	Name:       newChain.Name,
-	//	IPSets:     strings.Join(newChain.Ipsets, ","),
-	//	Direction:  pb.Chain_Direction_name[int32(newChain.Direction)],
-	//	Experiment: uid,
-	//}); err != nil {
-	//	return errors.WithStack(err)
-	//}
-
-	return nil
-}
+	for _, newChain := range newChains {
+		if err := s.iptablesRule.Set(context.Background(), &core.IptablesRule{
+			Name:             newChain.Name,
+			IPSets:           strings.Join(newChain.Ipsets, ","),
+			Direction:        pb.Chain_Direction_name[int32(newChain.Direction)],
+			Experiment:       uid,
+			Protocol:         newChain.Protocol,
+			SourcePorts:      newChain.SourcePorts,
+			DestinationPorts: newChain.DestinationPorts,
+			Target:           newChain.Target,
+			Family:           core.FamilyIPv4,
+			ContainerID:      attack.ContainerID,
+		}); err != nil {
+			return errors.WithStack(err)
+		}
+	}
 
-func (s *Server) applyTC(attack *core.NetworkCommand, ipset string, uid string) error {
-	tcRules, err := s.tcRule.FindByDevice(context.Background(), attack.Device)
+	ipv6Sets, err := s.ipv6SetNames(attack.ContainerID)
 	if err != nil {
 		return errors.WithStack(err)
 	}
 
-	tcs, err := core.TCRuleList(tcRules).ToTCs()
-	if err != nil {
-		return errors.WithStack(err)
+	// the IPv6 chains are set by resetTCs
+	if ipv6Set := core.IPv6SetName(ipset); ipv6Sets[ipv6Set] {
+		newChains, err := attack.ToChains(uid[:16], ipv6Set)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		for _, newChain := range newChains {
+			if err := s.iptablesRule.Set(context.Background(), &core.IptablesRule{
+				Name:             newChain.Name,
+				IPSets:           strings.Join(newChain.Ipsets, ","),
+				Direction:        pb.Chain_Direction_name[int32(newChain.Direction)],
+				Experiment:       uid,
+				Protocol:         newChain.Protocol,
+				SourcePorts:      newChain.SourcePorts,
+				DestinationPorts: newChain.DestinationPorts,
+				Target:           newChain.Target,
+				Family:           core.FamilyIPv6,
+				ContainerID:      attack.ContainerID,
+			}); err != nil {
+				return errors.WithStack(err)
+			}
+		}
 	}
 
-	newTC, err := attack.ToTC(ipset)
+	return s.resetTCs(attack.ContainerID)
+}
+
+// resetTCs sets the tc rules of all devices in the network namespace of the container again.
+// Setting iptables chains flushes CHAOS-OUTPUT, which drops the chains used by the filters
+// of tc rules, so it must be called after the iptables chains have been changed. The ip6tables
+// rules are set again at last.
+func (s *Server) resetTCs(containerID string) error {
+	rules, err := s.tcRule.ListGroupDevice(context.Background(), containerID)
 	if err != nil {
 		return errors.WithStack(err)
 	}
 
-	tcs = append(tcs, newTC)
-	if _, err := s.svr.SetTcs(context.Background(), &pb.TcsRequest{Tcs: tcs, Device: attack.Device, EnterNS: false}); err != nil {
-		return errors.WithStack(err)
-	}
+	for device, rs := range rules {
+		tcs, err := core.TCRuleList(rs).ToTCs()
+		if err != nil {
+			return errors.WithStack(err)
+		}
 
-	tc := &core.TcParameter{
-		Device: attack.Device,
-	}
-	switch attack.Action {
-	case core.NetworkDelayAction:
-		tc.Delay = &core.DelaySpec{
-			Latency:     attack.Latency,
-			Correlation: attack.Correlation,
-			Jitter:      attack.Jitter,
+		netemArgs, err := core.TCRuleList(rs).ToNetemArgs()
+		if err != nil {
+			return errors.WithStack(err)
 		}
-	case core.NetworkLossAction:
-		tc.Loss = &core.LossSpec{
-			Loss:        attack.Percent,
-			Correlation: attack.Correlation,
+
+		if err := s.setTcs(containerID, device, tcs, netemArgs); err != nil {
+			return errors.WithStack(err)
 		}
-	case core.NetworkCorruptAction:
-		tc.Corrupt = &core.CorruptSpec{
-			Corrupt:     attack.Percent,
-			Correlation: attack.Correlation,
+	}
+
+	return s.resetIp6tables(containerID)
+}
+
+// resolveDevices returns the devices of the attack, DeviceAllNonLoopback is resolved to all
+// the network interfaces except loopback and the ifb devices in the network namespace. On the
+// host, the veth and bridge interfaces are excluded too, which are the virtual links of the
+// containers, and a container only has the veth interfaces linked to the host.
+func (s *Server) resolveDevices(attack *core.NetworkCommand) ([]string, error) {
+	devices := attack.Devices()
+	if len(devices) != 1 || devices[0] != core.DeviceAllNonLoopback {
+		return devices, nil
+	}
+
+	links, err := s.listLinks(attack.ContainerID)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	virtual := make(map[string]bool)
+	if len(attack.ContainerID) == 0 {
+		for _, linkType := range []string{"veth", "bridge"} {
+			names, err := s.listLinks(attack.ContainerID, "type", linkType)
+			if err != nil {
+				return nil, errors.WithStack(err)
+			}
+
+			for _, name := range names {
+				virtual[name] = true
+			}
 		}
-	case core.NetworkDuplicateAction:
-		tc.Duplicate = &core.DuplicateSpec{
-			Duplicate:   attack.Percent,
-			Correlation: attack.Correlation,
+	}
+
+	devices = make([]string, 0, len(links))
+	for _, link := range links {
+		if !virtual[link] {
+			devices = append(devices, link)
 		}
-	default:
-		return errors.Errorf("network %s attack not supported", attack.Action)
 	}
 
-	tcString, err := json.Marshal(tc)
+	if len(devices) == 0 {
+		return nil, errors.New("no network interface found except loopback")
+	}
+
+	return devices, nil
+}
+
+// listLinks lists the network interfaces except loopback and the ifb devices created by chaosd,
+// the args of `ip link show` select the interfaces.
+func (s *Server) listLinks(containerID string, args ...string) ([]string, error) {
+	cmd, err := s.netNSCommand(containerID, "ip", append([]string{"-o", "link", "show"}, args...)...)
 	if err != nil {
-		return errors.WithStack(err)
+		return nil, errors.WithStack(err)
 	}
 
-	if err := s.tcRule.Set(context.Background(), &core.TCRule{
-		Type:       pb.Tc_Type_name[int32(newTC.Type)],
-		Device:     attack.Device,
-		TC:         string(tcString),
-		IPSet:      newTC.Ipset,
-		Protocal:   newTC.Protocol,
-		SourcePort: newTC.SourcePort,
-		EgressPort: newTC.EgressPort,
-		Experiment: uid,
-	}); err != nil {
-		return errors.WithStack(err)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return nil, errors.Errorf("list network interfaces failed: %s, output: %s", err, string(output))
 	}
 
-	return nil
+	return parseLinks(string(output)), nil
 }
 
-func (s *Server) applyEtcHosts(attack *core.NetworkCommand, uid string, env Environment) error {
-	recoverFlag := true
-	cmd := "mv /etc/hosts /etc/hosts.chaosd." + uid + " && touch /etc/hosts"
-	backupCmd := exec.Command("/bin/bash", "-c", cmd) // #nosec
+// parseLinks returns the network interfaces except loopback and the ifb devices created by
+// chaosd from the output of `ip -o link show`, which looks like:
+// 1: lo: <LOOPBACK,UP,LOWER_UP> mtu 65536 qdisc noqueue state UNKNOWN mode DEFAULT group default qlen 1000
+// 2: eth0@if12: <BROADCAST,MULTICAST,UP,LOWER_UP> mtu 1500 qdisc noqueue state UP mode DEFAULT group default
+func parseLinks(output string) []string {
+	var devices []string
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 3 {
+			continue
+		}
 
-	defer func() {
-		if recoverFlag {
-			if err := env.Chaos.recoverEtcHosts(attack, uid); err != nil {
-				log.Error("Error recover env: %s\n", zap.Error(err))
-			}
+		name := strings.SplitN(strings.TrimSuffix(fields[1], ":"), "@", 2)[0]
+		if len(name) == 0 || strings.HasPrefix(name, ifbDevicePrefix) || strings.Contains(fields[2], "LOOPBACK") {
+			continue
 		}
-	}()
 
-	stdout, err := backupCmd.CombinedOutput()
+		devices = append(devices, name)
+	}
+
+	return devices
+}
+
+func (s *Server) applyTC(attack *core.NetworkCommand, device string, ipset string, uid string) error {
+	tcRules, err := s.tcRule.FindByDevice(context.Background(), attack.ContainerID, device)
 	if err != nil {
-		log.Error(backupCmd.String()+string(stdout), zap.Error(err))
 		return errors.WithStack(err)
 	}
 
-	fileBytes, err := ioutil.ReadFile("/etc/hosts.chaosd." + uid) // #nosec
+	tcs, err := core.TCRuleList(tcRules).ToTCs()
 	if err != nil {
 		return errors.WithStack(err)
 	}
 
-	lines := strings.Split(string(fileBytes), "\n")
-
-	// Filter out the line of the hostname in /etc/hosts
-	// example:
-	// 10.86.33.102    qunarzz.com     q.qunarzz.com   common.qunarzz.com
-	// 127.0.0.1       localhost
-	needle := "^(\\d{1,3})(\\.\\d{1,3}){3}.*\\b" + attack.DNSHost + "\\b.*"
-	re, err := regexp.Compile(needle)
+	netemArgs, err := core.TCRuleList(tcRules).ToNetemArgs()
 	if err != nil {
 		return errors.WithStack(err)
 	}
 
-	// match IP address, eg: 127.0.0.1
-	reIp, err := regexp.Compile(`^(\d{1,3})(\.\d{1,3}){3}`)
+	newTC, err := attack.ToTC(ipset)
 	if err != nil {
 		return errors.WithStack(err)
 	}
 
-	fd, err := os.OpenFile("/etc/hosts", os.O_RDWR|os.O_APPEND, 0600)
+	tc, err := attack.ToTcParameter(device)
 	if err != nil {
 		return errors.WithStack(err)
 	}
-	defer func() {
-		if err := fd.Close(); err != nil {
-			log.Error("Error closing file: %s\n", zap.Error(err))
-		}
-	}()
 
-	w := bufio.NewWriter(fd)
+	newNetemArgs, err := tc.ToNetemArgs()
+	if err != nil {
+		return errors.WithStack(err)
+	}
 
-	newFlag := true
-	// if match one line, then replace it.
-	for _, line := range lines {
-		match := re.MatchString(line)
-		if match {
-			line = reIp.ReplaceAllString(line, attack.DNSIp)
-			newFlag = false
-		}
-		line = line + "\n"
-		_, err := w.WriteString(line)
-		if err != nil {
-			return errors.WithStack(err)
-		}
+	tcs = append(tcs, newTC)
+	netemArgs = append(netemArgs, newNetemArgs)
+	if err := s.setTcs(attack.ContainerID, device, tcs, netemArgs); err != nil {
+		return errors.WithStack(err)
 	}
-	// if not match any, then add a new line.
-	if newFlag {
-		_, err := w.WriteString(attack.DNSIp + "\t" + attack.DNSHost + "\n")
-		if err != nil {
-			return errors.WithStack(err)
-		}
+
+	if err := s.setTCRule(attack, newTC, &core.TCRule{Device: device}, uid); err != nil {
+		return errors.WithStack(err)
 	}
 
-	err = w.Flush()
+	return s.resetIp6tables(attack.ContainerID)
+}
+
+// setTCRule saves the tc rule of the attack, the rule has been filled with the
+// device and the fields about redirecting traffic to the device if there are.
+func (s *Server) setTCRule(attack *core.NetworkCommand, newTC *pb.Tc, rule *core.TCRule, uid string) error {
+	tc, err := attack.ToTcParameter(rule.Device)
 	if err != nil {
 		return errors.WithStack(err)
 	}
-	err = fd.Sync()
+
+	tcString, err := json.Marshal(tc)
 	if err != nil {
 		return errors.WithStack(err)
 	}
-	recoverFlag = false
+
+	rule.Type = pb.Tc_Type_name[int32(newTC.Type)]
+	rule.TC = string(tcString)
+	rule.IPSet = newTC.Ipset
+	rule.Protocal = newTC.Protocol
+	rule.SourcePort = newTC.SourcePort
+	rule.EgressPort = newTC.EgressPort
+	rule.Experiment = uid
+	rule.ContainerID = attack.ContainerID
+
+	if err := s.tcRule.Set(context.Background(), rule); err != nil {
+		return errors.WithStack(err)
+	}
+
 	return nil
 }
 
+// applyEtcHosts maps the hosts in /etc/hosts, the original content is recorded in
+// the attack, which is saved as the recover data of the experiment.
+func (s *Server) applyEtcHosts(attack *core.NetworkCommand) error {
+	content, err := ioutil.ReadFile(etcHostsFile)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	attack.EtcHostsBackup = string(content)
+	attack.EtcHostsBackedUp = true
+
+	return utils.ReplaceFile(etcHostsFile, []byte(attack.MapEtcHosts(string(content))))
+}
+
 func (networkAttack) Recover(exp core.Experiment, env Environment) error {
 	config, err := exp.GetRequestCommand()
 	if err != nil {
@@ -315,6 +473,9 @@ func (networkAttack) Recover(exp core.Experiment, env Environment) error {
 	}
 	attack := config.(*core.NetworkCommand)
 
+	env.Chaos.networkLock.Lock()
+	defer env.Chaos.networkLock.Unlock()
+
 	switch attack.Action {
 	case core.NetworkDNSAction:
 		if attack.NeedApplyEtcHosts() {
@@ -322,78 +483,167 @@ func (networkAttack) Recover(exp core.Experiment, env Environment) error {
 				return errors.WithStack(err)
 			}
 		}
-		return env.Chaos.recoverDNSServer(attack)
+		if err := env.Chaos.recoverDNSServer(attack); err != nil {
+			return errors.WithStack(err)
+		}
+
+		if attack.NeedApplyFakeDNSServer() {
+			return env.Chaos.stopFakeDNSServer(attack)
+		}
 	case core.NetworkPortOccupied:
 		return env.Chaos.recoverPortOccupied(attack, env.AttackUid)
-	case core.NetworkDelayAction, core.NetworkLossAction, core.NetworkCorruptAction, core.NetworkDuplicateAction:
-		if attack.NeedApplyIPSet() {
-			if err := env.Chaos.recoverIPSet(env.AttackUid); err != nil {
-				return errors.WithStack(err)
-			}
+	case core.NetworkFlapAction:
+		return env.Chaos.recoverFlap(attack)
+	case core.NetworkDelayAction, core.NetworkLossAction, core.NetworkCorruptAction, core.NetworkDuplicateAction,
+		core.NetworkBandwidthAction, core.NetworkReorderAction, core.NetworkNetemAction:
+		return env.Chaos.recoverTCAttack(attack, env.AttackUid)
+	case core.NetworkPartitionAction, core.NetworkRejectAction:
+		return env.Chaos.recoverIptablesAttack(attack, env.AttackUid)
+	case core.NetworkPacketAction:
+		if attack.NeedApplyTC() {
+			return env.Chaos.recoverTCAttack(attack, env.AttackUid)
 		}
+		return env.Chaos.recoverIptablesAttack(attack, env.AttackUid)
+	}
+	return nil
+}
 
-		if attack.NeedApplyIptables() {
-			if err := env.Chaos.recoverIptables(env.AttackUid); err != nil {
+// recoverTCAttack recovers the iptables chains and tc rules of every device of the attack
+// based on tc, then destroys the ipsets.
+func (s *Server) recoverTCAttack(attack *core.NetworkCommand, uid string) error {
+	if attack.NeedApplyIptables() {
+		if err := s.recoverIptables(uid, attack.ContainerID); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	// the rules are deleted by recoverTC, so the devices whose clsact qdisc is
+	// created by chaosd are found before
+	tcRules, err := s.tcRule.FindByExperiment(context.Background(), uid)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	clsactCreated := make(map[string]bool)
+	for _, rule := range tcRules {
+		if rule.ClsactCreated {
+			clsactCreated[redirectedDevice(rule)] = true
+		}
+	}
+
+	for i, device := range attack.Devices() {
+		if attack.NeedApplyTC() {
+			if err := s.recoverTC(uid, attack.ContainerID, device); err != nil {
 				return errors.WithStack(err)
 			}
 		}
 
-		if attack.NeedApplyTC() {
-			if err := env.Chaos.recoverTC(env.AttackUid, attack.Device); err != nil {
+		if attack.NeedApplyIngressTC() || attack.NeedApplyMarkTC() {
+			if err := s.recoverRedirectedTC(attack.ContainerID, device, ifbDeviceName(uid, i), clsactCreated[device]); err != nil {
 				return errors.WithStack(err)
 			}
 		}
 	}
+
+	// the ipsets can't be destroyed until the rules using them are recovered
+	if attack.NeedApplyIPSet() {
+		if err := s.recoverIPSet(uid, attack.ContainerID); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
 	return nil
 }
 
-func (s *Server) recoverIPSet(uid string) error {
+// recoverIptablesAttack recovers the iptables chains of the attack based on iptables,
+// then destroys the ipsets.
+func (s *Server) recoverIptablesAttack(attack *core.NetworkCommand, uid string) error {
+	if err := s.recoverIptables(uid, attack.ContainerID); err != nil {
+		return errors.WithStack(err)
+	}
+
+	return s.recoverIPSet(uid, attack.ContainerID)
+}
+
+func (s *Server) recoverIPSet(uid string, containerID string) error {
+	ipsets, err := s.ipsetRule.FindByExperiment(context.Background(), uid)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
 	if err := s.ipsetRule.DeleteByExperiment(context.Background(), uid); err != nil {
 		return errors.WithStack(err)
 	}
 
+	// the IPv6 ipsets are created by chaosd, so destroy them here
+	for _, ipset := range ipsets {
+		if ipset.Family != core.FamilyIPv6 {
+			continue
+		}
+
+		if err := s.runNetNSCommand(containerID, "ipset", "destroy", ipset.Name); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
 	return nil
 }
 
-func (s *Server) recoverIptables(uid string) error {
+func (s *Server) recoverIptables(uid string, containerID string) error {
 	if err := s.iptablesRule.DeleteByExperiment(context.Background(), uid); err != nil {
 		return errors.WithStack(err)
 	}
 
-	iptables, err := s.iptablesRule.List(context.Background())
+	return s.resetIptables(containerID)
+}
+
+// resetIptables sets the iptables chains in the network namespace of the container again,
+// then the tc rules and the ip6tables rules are set again since they depend on the chains.
+func (s *Server) resetIptables(containerID string) error {
+	iptables, err := s.iptablesRule.FindByContainerID(context.Background(), containerID)
 	if err != nil {
 		return errors.WithStack(err)
 	}
 
-	chains := core.IptablesRuleList(iptables).ToChains()
+	ipv4Rules, _ := core.IptablesRuleList(iptables).SplitByFamily()
+	chains := ipv4Rules.ToChains()
 
 	if _, err := s.svr.SetIptablesChains(context.Background(), &pb.IptablesChainsRequest{
-		Chains:  chains,
-		EnterNS: false,
+		Chains:      chains,
+		ContainerId: containerID,
+		EnterNS:     len(containerID) > 0,
 	}); err != nil {
 		return errors.WithStack(err)
 	}
 
-	return nil
+	return s.resetTCs(containerID)
 }
 
-func (s *Server) recoverTC(uid string, device string) error {
+func (s *Server) recoverTC(uid string, containerID string, device string) error {
 	if err := s.tcRule.DeleteByExperiment(context.Background(), uid); err != nil {
 		return errors.WithStack(err)
 	}
 
-	tcRules, err := s.tcRule.FindByDevice(context.Background(), device)
+	tcRules, err := s.tcRule.FindByDevice(context.Background(), containerID, device)
+	if err != nil {
+		return errors.WithStack(err)
+	}
 
 	tcs, err := core.TCRuleList(tcRules).ToTCs()
 	if err != nil {
 		return errors.WithStack(err)
 	}
 
-	if _, err := s.svr.SetTcs(context.Background(), &pb.TcsRequest{Tcs: tcs, Device: device, EnterNS: false}); err != nil {
+	netemArgs, err := core.TCRuleList(tcRules).ToNetemArgs()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if err := s.setTcs(containerID, device, tcs, netemArgs); err != nil {
 		return errors.WithStack(err)
 	}
 
-	return nil
+	return s.resetIp6tables(containerID)
 }
 
 func (s *Server) updateDNSServer(attack *core.NetworkCommand) error {
@@ -419,64 +669,35 @@ func (s *Server) recoverDNSServer(attack *core.NetworkCommand) error {
 	return nil
 }
 
+// applyPortOccupied starts chaosd itself in background to occupy the ports, and waits until
+// it reports the ports are occupied, or exits because some of them have been occupied. The
+// sockets only bound are not listed in /proc/net/tcp, so the ports are not checked by it.
+// The occupier process is identified by its pid and create time, which are recorded in the attack.
 func (s *Server) applyPortOccupied(attack *core.NetworkCommand) error {
-
-	if len(attack.Port) == 0 {
-		return nil
-	}
-
-	flag, err := checkPortIsListened(attack.Port)
+	proc, _, err := startReadyChaosdProcess("attack", "network", "port-occupier",
+		"--port", attack.Port, "--protocol", attack.IPProtocol, "--mode", attack.PortOccupyMode)
 	if err != nil {
-		if flag {
-			return errors.Errorf("port %s has been occupied", attack.Port)
-		}
 		return errors.WithStack(err)
 	}
 
-	if flag {
-		return errors.Errorf("port %s has been occupied", attack.Port)
-	}
-
-	args := fmt.Sprintf("-p=%s", attack.Port)
-	cmd := bpm.DefaultProcessBuilder("PortOccupyTool", args).Build()
-
-	cmd.Cmd.SysProcAttr = &syscall.SysProcAttr{}
-
-	backgroundProcessManager := bpm.NewBackgroundProcessManager()
-	err = backgroundProcessManager.StartProcess(cmd)
-	if err != nil {
+	attack.PortPid = proc.Pid
+	if attack.PortPidCreateTime, err = proc.CreateTime(); err != nil {
 		return errors.WithStack(err)
 	}
 
-	attack.PortPid = int32(cmd.Process.Pid)
-
 	return nil
 }
 
-func checkPortIsListened(port string) (bool, error) {
-	checkStatement := fmt.Sprintf("lsof -i:%s | awk '{print $2}' | grep -v PID", port)
-	cmd := exec.Command("sh", "-c", checkStatement)
-
-	stdout, err := cmd.CombinedOutput()
-	if err != nil {
-		if err.Error() == "exit status 1" && string(stdout) == "" {
-			return false, nil
-		}
-		log.Error(cmd.String()+string(stdout), zap.Error(err))
-		return true, errors.WithStack(err)
-	}
-
-	if string(stdout) == "" {
-		return false, nil
-	}
-	return true, nil
-}
-
 func (s *Server) recoverPortOccupied(attack *core.NetworkCommand, uid string) error {
+	if attack.PortPidCreateTime != 0 {
+		return killChaosdProcess(attack.PortPid, attack.PortPidCreateTime, "port-occupier")
+	}
 
+	// the former versions occupied the ports by PortOccupyTool
 	proc, err := process.NewProcess(attack.PortPid)
 	if err != nil {
-		return err
+		log.Warn("the port occupier is not running", zap.Int32("pid", attack.PortPid), zap.Error(err))
+		return nil
 	}
 
 	procName, err := proc.Name()
@@ -497,12 +718,27 @@ func (s *Server) recoverPortOccupied(attack *core.NetworkCommand, uid string) er
 }
 
 func (s *Server) recoverEtcHosts(attack *core.NetworkCommand, uid string) error {
-	cmd := "mv /etc/hosts.chaosd." + uid + " /etc/hosts"
-	recoverCmd := exec.Command("/bin/bash", "-c", cmd) // #nosec
-	stdout, err := recoverCmd.CombinedOutput()
-	if err != nil {
-		log.Error(recoverCmd.String()+string(stdout), zap.Error(err))
+	content := []byte(attack.EtcHostsBackup)
+
+	// the former versions backed up /etc/hosts to a file
+	backupFile := etcHostsFile + ".chaosd." + uid
+	if !attack.EtcHostsBackedUp {
+		backup, err := ioutil.ReadFile(backupFile) // #nosec
+		if os.IsNotExist(err) {
+			return errors.Errorf("the original content of %s isn't backed up, it can't be recovered", etcHostsFile)
+		} else if err != nil {
+			return errors.WithStack(err)
+		}
+		content = backup
+	}
+
+	if err := utils.ReplaceFile(etcHostsFile, content); err != nil {
 		return errors.WithStack(err)
 	}
+
+	if err := os.Remove(backupFile); err != nil && !os.IsNotExist(err) {
+		return errors.WithStack(err)
+	}
+
 	return nil
 }
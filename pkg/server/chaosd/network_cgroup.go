@@ -0,0 +1,145 @@
+// Copyright 2021 Chaos Mesh Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package chaosd
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/pingcap/errors"
+
+	"github.com/chaos-mesh/chaosd/pkg/core"
+)
+
+// markChain is the chain of mangle table which marks the packets sent by the cgroups of tc rules,
+// or the packets selected by the tcp flags and connection states of tc rules.
+const markChain = "CHAOS-MARK"
+
+// resetCgroupMarks sets the mark chains of iptables and ip6tables in the network namespace of
+// the container again. The packets sent by the cgroup, with the tcp flags and in the connection
+// states, and matching the ipset, protocol and ports of a tc rule are marked, so they can be
+// redirected to the ifb device of the rule.
+func (s *Server) resetCgroupMarks(containerID string) error {
+	tcRules, err := s.tcRule.List(context.Background())
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	ipv6Sets, err := s.ipv6SetNames(containerID)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	rules := make([]*core.TCRule, 0)
+	for _, rule := range tcRules {
+		if rule.Mark > 0 && rule.ContainerID == containerID {
+			rules = append(rules, rule)
+		}
+	}
+	sort.Slice(rules, func(i, j int) bool {
+		return rules[i].ID < rules[j].ID
+	})
+
+	for _, iptables := range []string{"iptables", "ip6tables"} {
+		markRules := make([][]string, 0, len(rules))
+		for _, rule := range rules {
+			ipset := rule.IPSet
+			if len(ipset) > 0 && iptables == "ip6tables" {
+				// the rule only targets IPv4 addresses
+				if ipset = core.IPv6SetName(ipset); !ipv6Sets[ipset] {
+					continue
+				}
+			}
+
+			markRules = append(markRules, markRule(rule, ipset)...)
+		}
+
+		if err := s.setMarkChain(containerID, iptables, markRules); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	return nil
+}
+
+// markRule returns the iptables rules marking the packets of the tc rule, there is a rule
+// for every tcp flags of the tc rule.
+func markRule(rule *core.TCRule, ipset string) [][]string {
+	flagsList := strings.Split(rule.TCPFlags, ",")
+	rules := make([][]string, 0, len(flagsList))
+	for _, flags := range flagsList {
+		rules = append(rules, markRuleWithFlags(rule, ipset, strings.TrimSpace(flags)))
+	}
+
+	return rules
+}
+
+func markRuleWithFlags(rule *core.TCRule, ipset string, flags string) []string {
+	args := []string{"-A", markChain}
+	if len(rule.Cgroup) > 0 {
+		args = append(args, "-m", "cgroup", "--path", rule.Cgroup)
+	}
+
+	if len(ipset) > 0 {
+		args = append(args, "-m", "set", "--match-set", ipset, "dst")
+	}
+
+	args = append(args, core.ConnStateMatch(rule.ConnState)...)
+
+	// the ports are matched like the chaos daemon does, which requires the protocol
+	if len(rule.Protocal) > 0 {
+		args = append(args, "--protocol", rule.Protocal)
+
+		if len(flags) > 0 {
+			args = append(args, core.TCPFlagsMatch(flags)...)
+		}
+
+		if len(rule.SourcePort) > 0 {
+			if strings.Contains(rule.SourcePort, ",") {
+				args = append(args, "-m", "multiport", "--source-ports", rule.SourcePort)
+			} else {
+				args = append(args, "--source-port", rule.SourcePort)
+			}
+		}
+
+		if len(rule.EgressPort) > 0 {
+			if strings.Contains(rule.EgressPort, ",") {
+				args = append(args, "-m", "multiport", "--destination-ports", rule.EgressPort)
+			} else {
+				args = append(args, "--destination-port", rule.EgressPort)
+			}
+		}
+	}
+
+	return append(args, "-j", "MARK", "--set-xmark", maskedMark(rule.Mark))
+}
+
+// setMarkChain deletes the mark chain of mangle table and creates it with the rules again,
+// the chain is left deleted if there is no rule.
+func (s *Server) setMarkChain(containerID string, iptables string, rules [][]string) error {
+	if err := s.deleteIptablesChain(containerID, iptables, "mangle", markChain, []string{"OUTPUT"}); err != nil {
+		return errors.WithStack(err)
+	}
+
+	if len(rules) == 0 {
+		return nil
+	}
+
+	if err := s.newIptablesChain(containerID, iptables, "mangle", markChain, rules); err != nil {
+		return errors.WithStack(err)
+	}
+
+	return s.runNetNSCommand(containerID, iptables, "-w", "-t", "mangle", "-A", "OUTPUT", "-j", markChain)
+}
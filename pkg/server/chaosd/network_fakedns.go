@@ -0,0 +1,101 @@
+// Copyright 2021 Chaos Mesh Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package chaosd
+
+import (
+	"io/ioutil"
+	"net"
+	"strings"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"go.uber.org/zap"
+
+	"github.com/chaos-mesh/chaosd/pkg/core"
+)
+
+const resolvConfFile = "/etc/resolv.conf"
+
+// startFakeDNSServer starts the fake DNS server in background, it must be called before
+// the DNS server in /etc/resolv.conf is updated, which is the upstream by default.
+func (s *Server) startFakeDNSServer(attack *core.NetworkCommand) error {
+	upstream := attack.DNSUpstream
+	if len(upstream) == 0 {
+		var err error
+		if upstream, err = resolvNameserver(); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	if upstream == attack.DNSServer {
+		return errors.Errorf("the upstream %s is the address of fake DNS server", upstream)
+	}
+
+	listen := net.JoinHostPort(attack.DNSServer, "53")
+	// the fake DNS server runs in background, so check the address before starting it
+	conn, err := net.ListenPacket("udp", listen)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if err := conn.Close(); err != nil {
+		return errors.WithStack(err)
+	}
+
+	args := []string{
+		"--listen", listen,
+		"--upstream", net.JoinHostPort(upstream, "53"),
+		"--fault", attack.DNSFault,
+		"--patterns", attack.DNSPatterns,
+		"--answer", attack.DNSAnswer,
+	}
+	if len(attack.DNSDelay) > 0 {
+		args = append(args, "--delay", attack.DNSDelay)
+	}
+
+	proc, err := startChaosdProcess(append([]string{"attack", "network", "dns-server"}, args...)...)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	attack.DNSServerPid = proc.Pid
+	if attack.DNSServerPidCreateTime, err = proc.CreateTime(); err != nil {
+		if err := proc.Kill(); err != nil {
+			log.Error("the fake DNS server kill failed", zap.Error(err))
+		}
+		return errors.WithStack(err)
+	}
+
+	return nil
+}
+
+// resolvNameserver returns the first nameserver in /etc/resolv.conf.
+func resolvNameserver() (string, error) {
+	content, err := ioutil.ReadFile(resolvConfFile)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	for _, line := range strings.Split(string(content), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) >= 2 && fields[0] == "nameserver" {
+			return fields[1], nil
+		}
+	}
+
+	return "", errors.Errorf("no nameserver found in %s", resolvConfFile)
+}
+
+func (s *Server) stopFakeDNSServer(attack *core.NetworkCommand) error {
+	return killChaosdProcess(attack.DNSServerPid, attack.DNSServerPidCreateTime, "fake DNS server")
+}
@@ -0,0 +1,67 @@
+// Copyright 2021 Chaos Mesh Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package chaosd
+
+import (
+	"github.com/pingcap/errors"
+
+	"github.com/chaos-mesh/chaosd/pkg/core"
+	"github.com/chaos-mesh/chaosd/pkg/netflap"
+)
+
+// applyFlap records the state of the device and brings it down, or starts chaosd itself
+// in background to bring it down and up by turns until the attack is recovered.
+func (s *Server) applyFlap(attack *core.NetworkCommand) error {
+	state, err := netflap.GetLinkState(attack.Device)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if !state.Up {
+		return errors.Errorf("device %s is already down", attack.Device)
+	}
+	attack.FlapLinkState = state
+
+	if !attack.NeedFlap() {
+		return netflap.Down(attack.Device)
+	}
+
+	proc, err := startChaosdProcess("attack", "network", "flapper",
+		"--device", attack.Device, "--down-time", attack.FlapDownTime, "--up-time", attack.FlapUpTime)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	attack.FlapPid = proc.Pid
+	if attack.FlapPidCreateTime, err = proc.CreateTime(); err != nil {
+		return errors.WithStack(err)
+	}
+
+	return nil
+}
+
+// recoverFlap stops the flapper and restores the original state of the device.
+func (s *Server) recoverFlap(attack *core.NetworkCommand) error {
+	if attack.FlapPid != 0 {
+		if err := killChaosdProcess(attack.FlapPid, attack.FlapPidCreateTime, "flapper"); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	if attack.FlapLinkState == nil {
+		return nil
+	}
+
+	return netflap.Restore(attack.FlapLinkState, attack.Device)
+}
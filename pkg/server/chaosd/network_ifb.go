@@ -0,0 +1,479 @@
+// Copyright 2021 Chaos Mesh Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package chaosd
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/chaos-mesh/chaos-mesh/pkg/bpm"
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"go.uber.org/zap"
+
+	"github.com/chaos-mesh/chaosd/pkg/core"
+	"github.com/chaos-mesh/chaosd/pkg/utils"
+)
+
+const ifbDevicePrefix = "ifb-"
+
+// maxIfbDevices is the max number of ifb devices of an experiment. The name of a network interface
+// can't be longer than 15 characters, so the index in the name of ifb device has at most 2 digits.
+const maxIfbDevices = 100
+
+const (
+	// redirectFilterPref is the first pref of the filters redirecting the traffic to the ifb devices,
+	// the prefs from it to maxRedirectFilterPref are owned by chaosd in the clsact qdisc.
+	redirectFilterPref    = 0xc000
+	maxRedirectFilterPref = 0xffff
+)
+
+const (
+	// packetMarkMask is the bits of the packet mark set by chaosd, the other bits are kept for
+	// the marks set by other tools, such as 0x4000 and 0x8000 set by kube-proxy.
+	packetMarkMask  = 0x0ff00000
+	packetMarkShift = 20
+)
+
+// ifbDeviceName returns the name of the ifb device created for the index-th device of the
+// experiment, such as ifb-1a2b3c4d-99, the index must be less than maxIfbDevices.
+func ifbDeviceName(uid string, index int) string {
+	if index == 0 {
+		return ifbDevicePrefix + uid[:8]
+	}
+
+	return fmt.Sprintf("%s%s-%d", ifbDevicePrefix, uid[:8], index)
+}
+
+// applyIngressTC creates the ifb device for the device, redirects the ingress traffic of
+// the device to it and applies the tc rule on the egress of the ifb device.
+func (s *Server) applyIngressTC(attack *core.NetworkCommand, device string, ifb string, ipset string, uid string) error {
+	return s.applyRedirectedTC(attack, ipset, uid, &core.TCRule{
+		Device:        ifb,
+		IngressDevice: device,
+	})
+}
+
+// applyMarkTC creates the ifb device for the device, the packets sent by the cgroup, or selected by
+// the packet attack, are marked by iptables and the egress traffic of the device with the mark is
+// redirected to it.
+func (s *Server) applyMarkTC(attack *core.NetworkCommand, device string, ifb string, ipset string, uid string) error {
+	cgroup := attack.Cgroup
+	if attack.Pid > 0 {
+		var err error
+		if cgroup, err = utils.GetCgroupV2Path(attack.Pid); err != nil {
+			return errors.WithStack(err)
+		}
+
+		// the process isn't in a cgroup v2 on a cgroup v1 or hybrid system,
+		// and marking the root cgroup would mark all the packets of the host
+		if cgroup == "/" {
+			return errors.Errorf("process %d is in the root cgroup v2, its packets can't be selected", attack.Pid)
+		}
+	}
+
+	mark, err := s.packetMark(attack.ContainerID, uid)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	return s.applyRedirectedTC(attack, ipset, uid, &core.TCRule{
+		Device:       ifb,
+		EgressDevice: device,
+		Cgroup:       cgroup,
+		Mark:         mark,
+		TCPFlags:     attack.TCPFlags,
+		ConnState:    attack.ConnState,
+	})
+}
+
+// packetMark returns the mark of the packets selected by the cgroup, tcp flags or connection states
+// of the experiment. All the devices of the experiment share a mark, and the experiments in the same
+// network namespace get different marks in the bits of packetMarkMask.
+func (s *Server) packetMark(containerID string, uid string) (uint32, error) {
+	tcRules, err := s.tcRule.List(context.Background())
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+
+	used := make(map[uint32]bool)
+	for _, rule := range tcRules {
+		if rule.Mark == 0 || rule.ContainerID != containerID {
+			continue
+		}
+
+		if rule.Experiment == uid {
+			return rule.Mark, nil
+		}
+		used[rule.Mark] = true
+	}
+
+	for i := uint32(1); i <= packetMarkMask>>packetMarkShift; i++ {
+		if mark := i << packetMarkShift; !used[mark] {
+			return mark, nil
+		}
+	}
+
+	return 0, errors.New("no packet mark is available, there are too many experiments selecting packets")
+}
+
+// applyRedirectedTC creates the ifb device of the rule and applies the tc rule on it, then
+// redirects the traffic of the ingress or egress device selected by the rule to the ifb device.
+func (s *Server) applyRedirectedTC(attack *core.NetworkCommand, ipset string, uid string, rule *core.TCRule) (err error) {
+	ifb, device := rule.Device, redirectedDevice(rule)
+
+	if err = s.runNetNSCommand(attack.ContainerID, "ip", "link", "add", "name", ifb, "type", "ifb"); err != nil {
+		return errors.WithStack(err)
+	}
+
+	defer func() {
+		if err != nil {
+			if err := s.runNetNSCommand(attack.ContainerID, "ip", "link", "delete", ifb); err != nil {
+				log.Error("failed to delete ifb device", zap.String("device", ifb), zap.Error(err))
+			}
+		}
+	}()
+
+	if err = s.runNetNSCommand(attack.ContainerID, "ip", "link", "set", "dev", ifb, "up"); err != nil {
+		return errors.WithStack(err)
+	}
+
+	newTC, err := attack.ToTC(ipset)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if err = s.setTCRule(attack, newTC, rule, uid); err != nil {
+		return errors.WithStack(err)
+	}
+
+	// the rule is saved before the kernel state is applied, because the marks and filters are
+	// rebuilt from the store, so it's deleted and they are rebuilt again if any step fails.
+	defer func() {
+		if err != nil {
+			s.deleteRedirectedTCRule(attack.ContainerID, device, rule)
+		}
+	}()
+
+	tcRules, err := s.tcRule.FindByDevice(context.Background(), attack.ContainerID, ifb)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	tcs, err := core.TCRuleList(tcRules).ToTCs()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	netemArgs, err := core.TCRuleList(tcRules).ToNetemArgs()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if err = s.setTcs(attack.ContainerID, ifb, tcs, netemArgs); err != nil {
+		return errors.WithStack(err)
+	}
+
+	if err = s.resetCgroupMarks(attack.ContainerID); err != nil {
+		return errors.WithStack(err)
+	}
+
+	return s.resetRedirect(attack.ContainerID, device, false)
+}
+
+// deleteRedirectedTCRule deletes the rule failed to apply, and rebuilds the marks and filters
+// without it. The errors are only logged because the rule has failed.
+func (s *Server) deleteRedirectedTCRule(containerID string, device string, rule *core.TCRule) {
+	// the ownership of the clsact qdisc may be recorded in the rule by resetRedirect
+	rules, err := s.tcRule.FindByDevice(context.Background(), containerID, rule.Device)
+	if err != nil {
+		log.Error("failed to find tc rules", zap.String("device", rule.Device), zap.Error(err))
+		return
+	}
+
+	clsactCreated := false
+	for _, r := range rules {
+		clsactCreated = clsactCreated || (r.ID == rule.ID && r.ClsactCreated)
+	}
+
+	if err := s.tcRule.Delete(context.Background(), rule); err != nil {
+		log.Error("failed to delete tc rule", zap.String("device", rule.Device), zap.Error(err))
+		return
+	}
+
+	if err := s.resetCgroupMarks(containerID); err != nil {
+		log.Error("failed to reset cgroup marks", zap.Error(err))
+	}
+
+	if err := s.resetRedirect(containerID, device, clsactCreated); err != nil {
+		log.Error("failed to reset redirect", zap.String("device", device), zap.Error(err))
+	}
+}
+
+// redirectedDevice returns the device whose traffic is redirected to the ifb device of the
+// rule, it's empty if the rule is set on the device directly.
+func redirectedDevice(rule *core.TCRule) string {
+	if len(rule.IngressDevice) > 0 {
+		return rule.IngressDevice
+	}
+	return rule.EgressDevice
+}
+
+// resetRedirect rebuilds the filters of chaosd in the clsact qdisc of the device. Every ingress tc
+// rule of the device gets an ingress filter which redirects the traffic matching its ipset to the ifb
+// device, and every cgroup tc rule gets an egress filter which redirects the packets with its mark.
+// The filters set by others are kept, and the clsact qdisc is only deleted if it's created by chaosd,
+// which is passed by clsactCreated if the rules recording it have been deleted, and it's empty.
+func (s *Server) resetRedirect(containerID string, device string, clsactCreated bool) error {
+	ingressRules, err := s.tcRule.FindByIngressDevice(context.Background(), containerID, device)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	egressRules, err := s.tcRule.FindByEgressDevice(context.Background(), containerID, device)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	rules := append(append([]*core.TCRule{}, ingressRules...), egressRules...)
+	recorded := false
+	for _, rule := range rules {
+		recorded = recorded || rule.ClsactCreated
+	}
+	clsactCreated = clsactCreated || recorded
+
+	if len(rules) == 0 {
+		return s.deleteRedirect(containerID, device, clsactCreated)
+	}
+
+	cmd, err := s.netNSCommand(containerID, "tc", "qdisc", "add", "dev", device, "clsact")
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	output, err := cmd.CombinedOutput()
+	if err == nil {
+		clsactCreated = true
+	} else if !clsactExists(string(output)) {
+		return errors.Errorf("add clsact qdisc failed: %s, output: %s", err, string(output))
+	}
+
+	// the rules of the device record that chaosd creates the clsact qdisc before any filter is
+	// added, so the qdisc can be deleted when the experiments are recovered after a failure.
+	if clsactCreated && !recorded {
+		rules[0].ClsactCreated = true
+		if err := s.tcRule.Set(context.Background(), rules[0]); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	if _, err := s.deleteRedirectFilters(containerID, device); err != nil {
+		return errors.WithStack(err)
+	}
+
+	ipv6Sets, err := s.ipv6SetNames(containerID)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	pref := redirectFilterPref
+	addFilter := func(direction string, protocol string, ifb string, match ...string) error {
+		if pref > maxRedirectFilterPref {
+			return errors.Errorf("too many filters redirecting the traffic of device %s", device)
+		}
+
+		args := []string{"filter", "add", "dev", device, direction, "protocol", protocol, "pref", strconv.Itoa(pref)}
+		args = append(args, match...)
+		args = append(args, "action", "mirred", "egress", "redirect", "dev", ifb)
+		pref++
+
+		return s.runNetNSCommand(containerID, "tc", args...)
+	}
+
+	for _, rule := range ingressRules {
+		if len(rule.IPSet) == 0 {
+			if err := addFilter("ingress", "all", rule.Device, "u32", "match", "u32", "0", "0"); err != nil {
+				return errors.WithStack(err)
+			}
+			continue
+		}
+
+		if err := addFilter("ingress", "ip", rule.Device, "basic", "match", fmt.Sprintf("ipset(%s src)", rule.IPSet)); err != nil {
+			return errors.WithStack(err)
+		}
+
+		if ipv6Set := core.IPv6SetName(rule.IPSet); ipv6Sets[ipv6Set] {
+			if err := addFilter("ingress", "ipv6", rule.Device, "basic", "match", fmt.Sprintf("ipset(%s src)", ipv6Set)); err != nil {
+				return errors.WithStack(err)
+			}
+		}
+	}
+
+	for _, rule := range egressRules {
+		if err := addFilter("egress", "all", rule.Device, "handle", maskedMark(rule.Mark), "fw"); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	return nil
+}
+
+// deleteRedirect deletes the filters of chaosd in the clsact qdisc of the device, and deletes
+// the qdisc if it's created by chaosd and no filter is left.
+func (s *Server) deleteRedirect(containerID string, device string, clsactCreated bool) error {
+	qdiscs, err := s.listQdiscs(containerID, device)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	exists := false
+	for _, q := range qdiscs {
+		exists = exists || q.kind == "clsact"
+	}
+	if !exists {
+		return nil
+	}
+
+	empty, err := s.deleteRedirectFilters(containerID, device)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if !clsactCreated || !empty {
+		return nil
+	}
+
+	return s.runNetNSCommand(containerID, "tc", "qdisc", "del", "dev", device, "clsact")
+}
+
+// deleteRedirectFilters deletes the filters with the prefs of chaosd in the clsact qdisc of the
+// device, it returns true if no filter is left.
+func (s *Server) deleteRedirectFilters(containerID string, device string) (bool, error) {
+	empty := true
+	for _, direction := range []string{"ingress", "egress"} {
+		cmd, err := s.netNSCommand(containerID, "tc", "filter", "show", "dev", device, direction)
+		if err != nil {
+			return false, errors.WithStack(err)
+		}
+
+		output, err := cmd.CombinedOutput()
+		if err != nil {
+			return false, errors.Errorf("list filters failed: %s, output: %s", err, string(output))
+		}
+
+		for _, pref := range parseFilterPrefs(string(output)) {
+			if pref < redirectFilterPref {
+				empty = false
+				continue
+			}
+
+			if err := s.runNetNSCommand(containerID, "tc", "filter", "del", "dev", device, direction,
+				"pref", strconv.Itoa(pref)); err != nil {
+				return false, errors.WithStack(err)
+			}
+		}
+	}
+
+	return empty, nil
+}
+
+// clsactExists returns true if the output of `tc qdisc add` means the clsact qdisc exists, the
+// kernel answers EEXIST with the message of the exclusivity flag.
+func clsactExists(output string) bool {
+	return strings.Contains(output, "Exclusivity flag on") || strings.Contains(output, "File exists")
+}
+
+// parseFilterPrefs returns the prefs in the output of `tc filter show`, which looks like:
+// filter protocol all pref 49152 u32 chain 0
+// filter protocol all pref 49152 u32 chain 0 fh 800: ht divisor 1
+func parseFilterPrefs(output string) []int {
+	var prefs []int
+	seen := make(map[int]bool)
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 || fields[0] != "filter" {
+			continue
+		}
+
+		for i := 1; i < len(fields)-1; i++ {
+			if fields[i] != "pref" {
+				continue
+			}
+
+			if pref, err := strconv.Atoi(fields[i+1]); err == nil && !seen[pref] {
+				seen[pref] = true
+				prefs = append(prefs, pref)
+			}
+			break
+		}
+	}
+
+	return prefs
+}
+
+// maskedMark returns the mark with packetMarkMask, which is accepted by iptables and tc.
+func maskedMark(mark uint32) string {
+	return fmt.Sprintf("%#x/%#x", mark, packetMarkMask)
+}
+
+// recoverRedirectedTC deletes the ifb device and the filter redirecting traffic of the device
+// to it. The tc rules of the experiment must have been deleted from the store, clsactCreated
+// is true if any of them records that the clsact qdisc of the device is created by chaosd.
+func (s *Server) recoverRedirectedTC(containerID string, device string, ifb string, clsactCreated bool) error {
+	if err := s.resetRedirect(containerID, device, clsactCreated); err != nil {
+		return errors.WithStack(err)
+	}
+
+	if err := s.resetCgroupMarks(containerID); err != nil {
+		return errors.WithStack(err)
+	}
+
+	if err := s.runNetNSCommand(containerID, "ip", "link", "delete", ifb); err != nil {
+		return errors.WithStack(err)
+	}
+
+	return nil
+}
+
+// netNSCommand builds the command which runs in the network namespace of the container,
+// or in the network namespace of chaosd if the container id is empty.
+func (s *Server) netNSCommand(containerID string, name string, args ...string) (*bpm.ManagedProcess, error) {
+	builder := bpm.DefaultProcessBuilder(name, args...)
+	if len(containerID) > 0 {
+		pid, err := s.crClient.GetPidFromContainerID(context.Background(), containerID)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		builder = builder.SetNS(pid, bpm.NetNS)
+	}
+
+	return builder.Build(), nil
+}
+
+func (s *Server) runNetNSCommand(containerID string, name string, args ...string) error {
+	cmd, err := s.netNSCommand(containerID, name, args...)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		log.Error(cmd.String()+string(output), zap.Error(err))
+		return errors.WithStack(err)
+	}
+
+	return nil
+}
@@ -0,0 +1,47 @@
+// Copyright 2021 Chaos Mesh Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package chaosd
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestParseFilterPrefs(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	// a filter set by another tool with pref 1, and two filters of chaosd
+	output := `filter protocol all pref 1 bpf chain 0
+filter protocol all pref 1 bpf chain 0 handle 0x1 cilium.o:[from-netdev] direct-action not_in_hw
+filter protocol ip pref 49152 basic chain 0
+filter protocol ip pref 49152 basic chain 0 handle 0x1
+  ipset(chaos-a src)
+	action order 1: mirred (Egress Redirect to device ifb-1a2b3c4d) stolen
+	index 1 ref 1 bind 1
+
+filter protocol all pref 49153 u32 chain 0
+filter protocol all pref 49153 u32 chain 0 fh 800: ht divisor 1
+`
+	g.Expect(parseFilterPrefs(output)).Should(Equal([]int{1, redirectFilterPref, redirectFilterPref + 1}))
+	g.Expect(parseFilterPrefs("")).Should(BeEmpty())
+}
+
+func TestClsactExists(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	g.Expect(clsactExists("Error: Exclusivity flag on, cannot modify.\n")).Should(BeTrue())
+	g.Expect(clsactExists("RTNETLINK answers: File exists\n")).Should(BeTrue())
+	g.Expect(clsactExists("Cannot find device \"eth9\"\n")).Should(BeFalse())
+}
@@ -0,0 +1,126 @@
+// Copyright 2021 Chaos Mesh Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package chaosd
+
+import (
+	"strings"
+
+	"github.com/pingcap/errors"
+)
+
+// The helpers manage the chains set by chaosd itself instead of the chaos daemon, such as the
+// ip6tables chains, the mark chain of mangle table and the redirect chain of nat table. The
+// iptables is iptables or ip6tables.
+
+// ensureIptablesChain creates the chain of the table if it doesn't exist.
+func (s *Server) ensureIptablesChain(containerID string, iptables string, table string, name string) error {
+	cmd, err := s.netNSCommand(containerID, iptables, "-w", "-t", table, "-N", name)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if output, err := cmd.CombinedOutput(); err != nil && !strings.Contains(string(output), "Chain already exists") {
+		return errors.Errorf("create %s chain %s failed: %s, output: %s", iptables, name, err, string(output))
+	}
+
+	return nil
+}
+
+// newIptablesChain creates the chain of the table or flushes it if it exists, then appends the rules.
+func (s *Server) newIptablesChain(containerID string, iptables string, table string, name string, rules [][]string) error {
+	if err := s.ensureIptablesChain(containerID, iptables, table, name); err != nil {
+		return errors.WithStack(err)
+	}
+
+	if err := s.runNetNSCommand(containerID, iptables, "-w", "-t", table, "-F", name); err != nil {
+		return errors.WithStack(err)
+	}
+
+	for _, rule := range rules {
+		if err := s.runNetNSCommand(containerID, iptables, append([]string{"-w", "-t", table}, rule...)...); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	return nil
+}
+
+// ensureIptablesRule appends the rule to the chain of the table if it isn't in the chain.
+func (s *Server) ensureIptablesRule(containerID string, iptables string, table string, chain string, rule ...string) error {
+	if s.hasIptablesRule(containerID, iptables, table, chain, rule...) {
+		return nil
+	}
+
+	return s.runNetNSCommand(containerID, iptables, append([]string{"-w", "-t", table, "-A", chain}, rule...)...)
+}
+
+// deleteIptablesRule deletes the rule from the chain of the table, it's ignored if the rule isn't in the chain.
+func (s *Server) deleteIptablesRule(containerID string, iptables string, table string, chain string, rule ...string) error {
+	if !s.hasIptablesRule(containerID, iptables, table, chain, rule...) {
+		return nil
+	}
+
+	return s.runNetNSCommand(containerID, iptables, append([]string{"-w", "-t", table, "-D", chain}, rule...)...)
+}
+
+func (s *Server) hasIptablesRule(containerID string, iptables string, table string, chain string, rule ...string) bool {
+	cmd, err := s.netNSCommand(containerID, iptables, append([]string{"-w", "-t", table, "-C", chain}, rule...)...)
+	if err != nil {
+		return false
+	}
+
+	return cmd.Run() == nil
+}
+
+// iptablesChainRules returns the rules of the chain of the table, it returns false if the chain doesn't exist.
+func (s *Server) iptablesChainRules(containerID string, iptables string, table string, name string) ([]string, bool) {
+	cmd, err := s.netNSCommand(containerID, iptables, "-w", "-t", table, "-S", name)
+	if err != nil {
+		return nil, false
+	}
+
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return nil, false
+	}
+
+	var rules []string
+	for _, line := range strings.Split(string(output), "\n") {
+		if strings.HasPrefix(line, "-A ") {
+			rules = append(rules, line)
+		}
+	}
+
+	return rules, true
+}
+
+// deleteIptablesChain deletes the jumps from the hooks to the chain of the table, then deletes
+// the chain. It's ignored if the chain doesn't exist.
+func (s *Server) deleteIptablesChain(containerID string, iptables string, table string, name string, hooks []string) error {
+	if _, ok := s.iptablesChainRules(containerID, iptables, table, name); !ok {
+		return nil
+	}
+
+	for _, hook := range hooks {
+		if err := s.deleteIptablesRule(containerID, iptables, table, hook, "-j", name); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	if err := s.runNetNSCommand(containerID, iptables, "-w", "-t", table, "-F", name); err != nil {
+		return errors.WithStack(err)
+	}
+
+	return s.runNetNSCommand(containerID, iptables, "-w", "-t", table, "-X", name)
+}
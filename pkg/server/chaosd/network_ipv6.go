@@ -0,0 +1,257 @@
+// Copyright 2021 Chaos Mesh Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package chaosd
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pingcap/errors"
+
+	"github.com/chaos-mesh/chaos-mesh/pkg/chaosdaemon/pb"
+
+	"github.com/chaos-mesh/chaosd/pkg/core"
+)
+
+// The chaos daemon only manages the ipsets of inet family and the rules of iptables,
+// so the IPv6 ipsets and the rules of ip6tables are managed by chaosd itself.
+
+// flushIPv6Set creates the ipset of inet6 family with the cidrs, the existing ipset
+// may be used by ip6tables rules, so a temp ipset is created and swapped with it.
+func (s *Server) flushIPv6Set(containerID string, set *pb.IPSet) error {
+	tmpName := set.Name + "old"
+	if err := s.runNetNSCommand(containerID, "ipset", "create", tmpName, "hash:net", "family", "inet6", "-exist"); err != nil {
+		return errors.WithStack(err)
+	}
+
+	if err := s.runNetNSCommand(containerID, "ipset", "flush", tmpName); err != nil {
+		return errors.WithStack(err)
+	}
+
+	for _, cidr := range set.Cidrs {
+		if err := s.runNetNSCommand(containerID, "ipset", "add", tmpName, cidr, "-exist"); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	if err := s.runNetNSCommand(containerID, "ipset", "create", set.Name, "hash:net", "family", "inet6", "-exist"); err != nil {
+		return errors.WithStack(err)
+	}
+
+	if err := s.runNetNSCommand(containerID, "ipset", "swap", tmpName, set.Name); err != nil {
+		return errors.WithStack(err)
+	}
+
+	return s.runNetNSCommand(containerID, "ipset", "destroy", tmpName)
+}
+
+// ipv6SetNames returns the names of IPv6 ipsets in the network namespace of the container.
+func (s *Server) ipv6SetNames(containerID string) (map[string]bool, error) {
+	rules, err := s.ipsetRule.List(context.Background())
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	names := make(map[string]bool)
+	for _, rule := range rules {
+		if rule.Family == core.FamilyIPv6 && rule.ContainerID == containerID {
+			names[rule.Name] = true
+		}
+	}
+
+	return names, nil
+}
+
+// resetIp6tables sets the ip6tables rules in the network namespace of the container again.
+// The rules include the chains of IPv6 iptables rules, and the chains classifying IPv6 packets
+// for the tc rules, which are copied from the TC-TABLES chains set by the chaos daemon.
+// It must be called after the iptables chains or the tc rules have been changed.
+func (s *Server) resetIp6tables(containerID string) error {
+	ipv6Sets, err := s.ipv6SetNames(containerID)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if len(ipv6Sets) == 0 {
+		// ip6tables is never used if the chain doesn't exist, keep the hosts without IPv6 untouched
+		cmd, err := s.netNSCommand(containerID, "ip6tables", "-w", "-S", "CHAOS-OUTPUT")
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		if cmd.Run() != nil {
+			return nil
+		}
+	}
+
+	for _, direction := range []string{"INPUT", "OUTPUT"} {
+		chain := "CHAOS-" + direction
+		if err := s.newIptablesChain(containerID, "ip6tables", "filter", chain, nil); err != nil {
+			return errors.WithStack(err)
+		}
+
+		if err := s.ensureIptablesRule(containerID, "ip6tables", "filter", direction, "-j", chain); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	iptables, err := s.iptablesRule.FindByContainerID(context.Background(), containerID)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	_, ipv6Rules := core.IptablesRuleList(iptables).SplitByFamily()
+	chains := make(map[string]bool)
+	for _, chain := range ipv6Rules.ToChains() {
+		if err := s.setIp6tablesChain(containerID, chain); err != nil {
+			return errors.WithStack(err)
+		}
+		chains[chain.Name] = true
+	}
+
+	tcChains, err := s.ipv6TCChains(containerID, ipv6Sets)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	names := make([]string, 0, len(tcChains))
+	for name := range tcChains {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if err := s.newIptablesChain(containerID, "ip6tables", "filter", name, tcChains[name]); err != nil {
+			return errors.WithStack(err)
+		}
+
+		if err := s.runNetNSCommand(containerID, "ip6tables", "-w", "-A", "CHAOS-OUTPUT", "-j", name); err != nil {
+			return errors.WithStack(err)
+		}
+		chains[name] = true
+	}
+
+	return s.deleteStaleIp6tablesChains(containerID, chains)
+}
+
+// ipv6TCChains copies the rules of TC-TABLES chains set by the chaos daemon, the ipset of
+// every rule is replaced by its IPv6 ipset. The rules without IPv6 ipset are skipped.
+func (s *Server) ipv6TCChains(containerID string, ipv6Sets map[string]bool) (map[string][][]string, error) {
+	cmd, err := s.netNSCommand(containerID, "iptables", "-w", "-S")
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return nil, errors.Errorf("list iptables rules failed: %s, output: %s", err, string(output))
+	}
+
+	chains := make(map[string][][]string)
+	for _, line := range strings.Split(string(output), "\n") {
+		args := strings.Fields(line)
+		// the rules look like:
+		// -A TC-TABLES-0 -m set --match-set chaos-xxx dst -j CLASSIFY --set-class 0003:0004
+		if len(args) < 2 || args[0] != "-A" || !strings.HasPrefix(args[1], "TC-TABLES-") {
+			continue
+		}
+
+		// icmp of IPv6 is another protocol, which is named ipv6-icmp
+		args = strings.Fields(core.IPv6Protocol(line))
+		for i, arg := range args {
+			if arg == "--match-set" && i+1 < len(args) {
+				args[i+1] = core.IPv6SetName(args[i+1])
+				if ipv6Sets[args[i+1]] {
+					chains[args[1]] = append(chains[args[1]], args)
+				}
+				break
+			}
+		}
+	}
+
+	return chains, nil
+}
+
+// setIp6tablesChain sets the chain like the chaos daemon sets iptables chains.
+func (s *Server) setIp6tablesChain(containerID string, chain *pb.Chain) error {
+	var matchPart string
+	switch chain.Direction {
+	case pb.Chain_INPUT:
+		matchPart = "src"
+	case pb.Chain_OUTPUT:
+		matchPart = "dst"
+	default:
+		return errors.Errorf("unknown chain direction %d", chain.Direction)
+	}
+
+	protocolAndPort := chain.Protocol
+	if len(protocolAndPort) > 0 {
+		if len(chain.SourcePorts) > 0 {
+			protocolAndPort += " " + chain.SourcePorts
+		}
+
+		if len(chain.DestinationPorts) > 0 {
+			protocolAndPort += " " + chain.DestinationPorts
+		}
+	}
+
+	rules := make([][]string, 0, len(chain.Ipsets))
+	for _, ipset := range chain.Ipsets {
+		rules = append(rules, strings.Fields(fmt.Sprintf("-A %s -m set --match-set %s %s -j %s %s",
+			chain.Name, ipset, matchPart, chain.Target, protocolAndPort)))
+	}
+
+	if err := s.newIptablesChain(containerID, "ip6tables", "filter", chain.Name, rules); err != nil {
+		return errors.WithStack(err)
+	}
+
+	return s.runNetNSCommand(containerID, "ip6tables", "-w", "-A", "CHAOS-"+chain.Direction.String(), "-j", chain.Name)
+}
+
+// deleteStaleIp6tablesChains deletes the chains set by chaosd but no longer used,
+// otherwise the IPv6 ipsets referenced by them can't be destroyed.
+func (s *Server) deleteStaleIp6tablesChains(containerID string, chains map[string]bool) error {
+	cmd, err := s.netNSCommand(containerID, "ip6tables", "-w", "-S")
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return errors.Errorf("list ip6tables rules failed: %s, output: %s", err, string(output))
+	}
+
+	for _, line := range strings.Split(string(output), "\n") {
+		args := strings.Fields(line)
+		if len(args) != 2 || args[0] != "-N" || chains[args[1]] {
+			continue
+		}
+
+		name := args[1]
+		if !strings.HasPrefix(name, "TC-TABLES-") && !strings.HasPrefix(name, "INPUT/") && !strings.HasPrefix(name, "OUTPUT/") {
+			continue
+		}
+
+		if err := s.runNetNSCommand(containerID, "ip6tables", "-w", "-F", name); err != nil {
+			return errors.WithStack(err)
+		}
+
+		if err := s.runNetNSCommand(containerID, "ip6tables", "-w", "-X", name); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,314 @@
+// Copyright 2021 Chaos Mesh Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package chaosd
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/pingcap/errors"
+
+	"github.com/chaos-mesh/chaos-mesh/pkg/chaosdaemon/pb"
+)
+
+// The chaos daemon doesn't support some parameters of netem, such as the distribution of
+// delay, so chaosd changes the netem qdiscs set by it with the full arguments of netem.
+// The qdiscs and TC-TABLES chains are found by the layout set by SetTcs of the chaos daemon
+// in pkg/chaosdaemon/tc_server.go of chaos-mesh v0.9.1-0.20210329064057-23471399d8f4, which
+// is the version in go.mod, so they should be checked again when chaos-mesh is upgraded.
+
+// setTcs sets the tc rules of the device by the chaos daemon, then changes the netem qdisc of
+// every tc rule whose netemArgs is not nil. The netemArgs are in the same order as the tcs.
+func (s *Server) setTcs(containerID string, device string, tcs []*pb.Tc, netemArgs [][]string) error {
+	if _, err := s.svr.SetTcs(context.Background(), &pb.TcsRequest{
+		Tcs:         tcs,
+		Device:      device,
+		ContainerId: containerID,
+		EnterNS:     len(containerID) > 0,
+	}); err != nil {
+		return errors.WithStack(err)
+	}
+
+	changed := false
+	for _, args := range netemArgs {
+		changed = changed || args != nil
+	}
+	if !changed {
+		return nil
+	}
+
+	handles, err := s.netemHandles(containerID, device, tcs)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	for i, args := range netemArgs {
+		if args == nil {
+			continue
+		}
+
+		handle := fmt.Sprintf("%x:", handles[i])
+		if err := s.runNetNSCommand(containerID, "tc",
+			append([]string{"qdisc", "change", "dev", device, "handle", handle, "netem"}, args...)...); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	return nil
+}
+
+// qdisc is a qdisc listed by `tc qdisc show`, the parent is 0 for the root qdisc.
+type qdisc struct {
+	kind   string
+	handle uint32
+	parent uint32
+}
+
+// netemHandles returns the major number of handle of the qdisc set for every tc. The chaos daemon
+// chains the qdiscs of tcs without filter from the root qdisc, and chains the qdiscs of tcs with the
+// same filter from a class of the prio qdisc, which is classified by a TC-TABLES chain of iptables.
+func (s *Server) netemHandles(containerID string, device string, tcs []*pb.Tc) ([]uint32, error) {
+	qdiscs, err := s.listQdiscs(containerID, device)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	classes, err := s.tcTablesClasses(containerID)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return matchNetemHandles(qdiscs, classes, tcs)
+}
+
+// matchNetemHandles finds the qdisc of every tc in the qdiscs, the classes are returned by tcTablesClasses.
+func matchNetemHandles(qdiscs []qdisc, classes map[string]uint32, tcs []*pb.Tc) ([]uint32, error) {
+	var global []int
+	groups := make(map[string][]int)
+	for i, tc := range tcs {
+		if filter := tcFilter(tc); len(filter) > 0 {
+			groups[filter] = append(groups[filter], i)
+			continue
+		}
+		global = append(global, i)
+	}
+
+	handles := make([]uint32, len(tcs))
+	if err := chainQdiscs(qdiscs, 0, true, tcs, global, handles); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	for _, group := range groups {
+		class, ok := classes[tcTablesMatch(tcs[group[0]])]
+		if !ok {
+			return nil, errors.Errorf("the TC-TABLES chain of tc %s not found", tcFilter(tcs[group[0]]))
+		}
+
+		if err := chainQdiscs(qdiscs, class, false, tcs, group, handles); err != nil {
+			return nil, errors.WithStack(err)
+		}
+	}
+
+	return handles, nil
+}
+
+// chainQdiscs finds the qdiscs chained from the parent for the tcs of indexes in order, and records
+// their handles. The parent of the first qdisc is the class, or the root if isRoot is true. The kind
+// of qdisc is checked, so the prio qdisc chained after the global tcs isn't taken as one of them.
+func chainQdiscs(qdiscs []qdisc, class uint32, isRoot bool, tcs []*pb.Tc, indexes []int, handles []uint32) error {
+	for n, index := range indexes {
+		kind := tcQdiscKind(tcs[index])
+		found := false
+		for _, q := range qdiscs {
+			if q.kind != kind {
+				continue
+			}
+
+			if (n == 0 && isRoot && q.parent == 0) ||
+				(n == 0 && !isRoot && q.parent == class) ||
+				(n > 0 && q.parent != 0 && q.parent>>16 == handles[indexes[n-1]]) {
+				handles[index] = q.handle >> 16
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return errors.Errorf("the qdisc of tc %d not found", index)
+		}
+	}
+
+	return nil
+}
+
+// tcQdiscKind returns the kind of qdisc the chaos daemon adds for the tc.
+func tcQdiscKind(tc *pb.Tc) string {
+	if tc.Type == pb.Tc_BANDWIDTH {
+		return "tbf"
+	}
+	return "netem"
+}
+
+// listQdiscs lists the qdiscs of the device.
+func (s *Server) listQdiscs(containerID string, device string) ([]qdisc, error) {
+	cmd, err := s.netNSCommand(containerID, "tc", "qdisc", "show", "dev", device)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return nil, errors.Errorf("list qdiscs failed: %s, output: %s", err, string(output))
+	}
+
+	return parseQdiscs(string(output))
+}
+
+// parseQdiscs parses the output of `tc qdisc show`, which looks like:
+// qdisc netem 1: root refcnt 2 limit 1000 delay 10.0ms
+// qdisc netem 5: parent 3:4 limit 1000 delay 10.0ms
+func parseQdiscs(output string) ([]qdisc, error) {
+	var qdiscs []qdisc
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 4 || fields[0] != "qdisc" {
+			continue
+		}
+
+		handle, err := parseTcHandle(fields[2])
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		q := qdisc{kind: fields[1], handle: handle}
+		if fields[3] == "parent" && len(fields) > 4 {
+			if q.parent, err = parseTcHandle(fields[4]); err != nil {
+				return nil, errors.WithStack(err)
+			}
+		} else if fields[3] != "root" {
+			continue
+		}
+
+		qdiscs = append(qdiscs, q)
+	}
+
+	return qdiscs, nil
+}
+
+// tcTablesClasses lists the classes set by TC-TABLES chains, indexed like parseTcTablesClasses.
+func (s *Server) tcTablesClasses(containerID string) (map[string]uint32, error) {
+	cmd, err := s.netNSCommand(containerID, "iptables", "-w", "-S")
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return nil, errors.Errorf("list iptables rules failed: %s, output: %s", err, string(output))
+	}
+
+	return parseTcTablesClasses(string(output))
+}
+
+// parseTcTablesClasses returns the classes set by TC-TABLES chains in the output of `iptables -S`,
+// indexed by the match of rules. The rules look like:
+// -A TC-TABLES-0 -p tcp -m set --match-set chaos-xxx dst -m tcp --dport 80 -j CLASSIFY --set-class 0003:0004
+func parseTcTablesClasses(output string) (map[string]uint32, error) {
+	classes := make(map[string]uint32)
+	for _, line := range strings.Split(output, "\n") {
+		args := strings.Fields(line)
+		if len(args) < 2 || args[0] != "-A" || !strings.HasPrefix(args[1], "TC-TABLES-") {
+			continue
+		}
+
+		var ipset, protocol, sourcePort, egressPort, class string
+		for i := 2; i+1 < len(args); i++ {
+			switch args[i] {
+			case "--match-set":
+				ipset = args[i+1]
+			case "-p":
+				protocol = args[i+1]
+			case "--sport", "--sports":
+				sourcePort = args[i+1]
+			case "--dport", "--dports":
+				egressPort = args[i+1]
+			case "--set-class":
+				class = args[i+1]
+			}
+		}
+
+		handle, err := parseTcHandle(class)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		classes[strings.Join([]string{ipset, protocol, sourcePort, egressPort}, " ")] = handle
+	}
+
+	return classes, nil
+}
+
+// tcTablesMatch returns the match of the TC-TABLES rule set for the tc, which is the same as
+// the index of tcTablesClasses. The ports are only matched with the protocol by the chaos daemon.
+func tcTablesMatch(tc *pb.Tc) string {
+	if len(tc.Protocol) == 0 {
+		return strings.Join([]string{tc.Ipset, "", "", ""}, " ")
+	}
+
+	return strings.Join([]string{tc.Ipset, tc.Protocol, tc.SourcePort, tc.EgressPort}, " ")
+}
+
+// tcFilter groups the tcs like the chaos daemon does, the tcs with the same filter are chained
+// under the same class. NOTE: the source port is grouped by the egress port as the chaos daemon.
+func tcFilter(tc *pb.Tc) string {
+	filter := tc.Ipset
+	if len(tc.Protocol) > 0 {
+		filter += "-" + tc.Protocol
+	}
+
+	if len(tc.EgressPort) > 0 {
+		filter += "-" + tc.EgressPort
+	}
+
+	if len(tc.SourcePort) > 0 {
+		filter += "-" + tc.EgressPort
+	}
+
+	return filter
+}
+
+// parseTcHandle parses the handle or class in hex, such as 1:, 3:4 or 0003:0004.
+func parseTcHandle(handle string) (uint32, error) {
+	parts := strings.SplitN(handle, ":", 2)
+	if len(parts) != 2 {
+		return 0, errors.Errorf("tc handle %s not valid", handle)
+	}
+
+	var numbers [2]uint64
+	for i, part := range parts {
+		if len(part) == 0 {
+			continue
+		}
+
+		n, err := strconv.ParseUint(part, 16, 16)
+		if err != nil {
+			return 0, errors.Errorf("tc handle %s not valid", handle)
+		}
+		numbers[i] = n
+	}
+
+	return uint32(numbers[0]<<16 | numbers[1]), nil
+}
@@ -0,0 +1,195 @@
+// Copyright 2021 Chaos Mesh Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package chaosd
+
+import (
+	"testing"
+
+	"github.com/chaos-mesh/chaos-mesh/pkg/chaosdaemon/pb"
+	. "github.com/onsi/gomega"
+)
+
+// The outputs are captured after the chaos daemon sets two global tcs and three groups of filtered
+// tcs. The handles are written in decimal by the chaos daemon but parsed in hex by tc and iptables,
+// so the handle after 9: is 10:, which is 0x10.
+const (
+	qdiscOutput = `qdisc netem 1: root refcnt 2 limit 1000 delay 50.0ms
+qdisc netem 2: parent 1: limit 1000 delay 100.0ms
+qdisc prio 3: parent 2: bands 6 priomap  1 2 2 2 1 2 0 0 1 1 1 1 1 1 1 1
+qdisc sfq 4: parent 3:1 limit 127p quantum 1514b depth 127 divisor 1024
+qdisc sfq 5: parent 3:2 limit 127p quantum 1514b depth 127 divisor 1024
+qdisc sfq 6: parent 3:3 limit 127p quantum 1514b depth 127 divisor 1024
+qdisc netem 7: parent 3:4 limit 1000 delay 50.0ms
+qdisc netem 8: parent 7: limit 1000 loss 10%
+qdisc netem 9: parent 3:5 limit 1000 delay 100.0ms
+qdisc netem 10: parent 3:6 limit 1000 corrupt 5%
+`
+	iptablesOutput = `-P INPUT ACCEPT
+-P FORWARD ACCEPT
+-P OUTPUT ACCEPT
+-N TC-TABLES-0
+-N TC-TABLES-1
+-N TC-TABLES-2
+-A OUTPUT -j TC-TABLES-0
+-A OUTPUT -j TC-TABLES-1
+-A OUTPUT -j TC-TABLES-2
+-A TC-TABLES-0 -m set --match-set chaos-a dst -j CLASSIFY --set-class 0003:0004
+-A TC-TABLES-1 -p tcp -m set --match-set chaos-b dst -m multiport --dports 80,443 -j CLASSIFY --set-class 0003:0005
+-A TC-TABLES-2 -p udp -m set --match-set chaos-c dst -m udp --sport 53 -j CLASSIFY --set-class 0003:0006
+`
+)
+
+func TestParseQdiscs(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	qdiscs, err := parseQdiscs(qdiscOutput)
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(qdiscs).Should(Equal([]qdisc{
+		{kind: "netem", handle: 0x10000},
+		{kind: "netem", handle: 0x20000, parent: 0x10000},
+		{kind: "prio", handle: 0x30000, parent: 0x20000},
+		{kind: "sfq", handle: 0x40000, parent: 0x30001},
+		{kind: "sfq", handle: 0x50000, parent: 0x30002},
+		{kind: "sfq", handle: 0x60000, parent: 0x30003},
+		{kind: "netem", handle: 0x70000, parent: 0x30004},
+		{kind: "netem", handle: 0x80000, parent: 0x70000},
+		{kind: "netem", handle: 0x90000, parent: 0x30005},
+		{kind: "netem", handle: 0x100000, parent: 0x30006},
+	}))
+
+	// the ingress qdisc isn't under the root
+	qdiscs, err = parseQdiscs("qdisc noqueue 0: root refcnt 2\nqdisc ingress ffff: parent ffff:fff1 ----------------\n")
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(qdiscs).Should(Equal([]qdisc{
+		{kind: "noqueue", handle: 0},
+		{kind: "ingress", handle: 0xffff0000, parent: 0xfffffff1},
+	}))
+
+	_, err = parseQdiscs("qdisc netem x: root refcnt 2 limit 1000\n")
+	g.Expect(err).Should(HaveOccurred())
+}
+
+func TestParseTcTablesClasses(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	classes, err := parseTcTablesClasses(iptablesOutput)
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(classes).Should(Equal(map[string]uint32{
+		"chaos-a   ":          0x30004,
+		"chaos-b tcp  80,443": 0x30005,
+		"chaos-c udp 53 ":     0x30006,
+	}))
+
+	classes, err = parseTcTablesClasses("-A TC-TABLES-0 -p tcp -m set --match-set chaos-a dst -m tcp --dport 8080 -j CLASSIFY --set-class 0003:000a\n")
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(classes).Should(Equal(map[string]uint32{"chaos-a tcp  8080": 0x3000a}))
+
+	_, err = parseTcTablesClasses("-A TC-TABLES-0 -m set --match-set chaos-a dst -j ACCEPT\n")
+	g.Expect(err).Should(HaveOccurred())
+}
+
+func TestMatchNetemHandles(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	qdiscs, err := parseQdiscs(qdiscOutput)
+	g.Expect(err).ShouldNot(HaveOccurred())
+
+	classes, err := parseTcTablesClasses(iptablesOutput)
+	g.Expect(err).ShouldNot(HaveOccurred())
+
+	groupA := &pb.Tc{Type: pb.Tc_NETEM, Ipset: "chaos-a"}
+	groupB := &pb.Tc{Type: pb.Tc_NETEM, Ipset: "chaos-b", Protocol: "tcp", EgressPort: "80,443"}
+	groupC := &pb.Tc{Type: pb.Tc_NETEM, Ipset: "chaos-c", Protocol: "udp", SourcePort: "53"}
+	global := &pb.Tc{Type: pb.Tc_NETEM}
+
+	handles, err := matchNetemHandles(qdiscs, classes, []*pb.Tc{groupA, global, groupB, groupA, groupC, global})
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(handles).Should(Equal([]uint32{0x7, 0x1, 0x9, 0x8, 0x10, 0x2}))
+
+	_, err = matchNetemHandles(qdiscs, classes, []*pb.Tc{{Type: pb.Tc_NETEM, Ipset: "chaos-d"}})
+	g.Expect(err).Should(HaveOccurred())
+	g.Expect(err.Error()).Should(ContainSubstring("the TC-TABLES chain of tc chaos-d not found"))
+
+	// the third global tc has no qdisc
+	_, err = matchNetemHandles(qdiscs, classes, []*pb.Tc{global, global, global})
+	g.Expect(err).Should(HaveOccurred())
+	g.Expect(err.Error()).Should(ContainSubstring("the qdisc of tc 2 not found"))
+
+	// the bandwidth tc is set by a tbf qdisc
+	qdiscs, err = parseQdiscs("qdisc tbf 1: root refcnt 2 rate 1Mbit burst 10000b lat 0us\nqdisc netem 2: parent 1: limit 1000 delay 50.0ms\n")
+	g.Expect(err).ShouldNot(HaveOccurred())
+
+	bandwidth := &pb.Tc{Type: pb.Tc_BANDWIDTH, Tbf: &pb.Tbf{Rate: 1000000, Buffer: 10000}}
+	handles, err = matchNetemHandles(qdiscs, nil, []*pb.Tc{bandwidth, global})
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(handles).Should(Equal([]uint32{0x1, 0x2}))
+
+	_, err = matchNetemHandles(qdiscs, nil, []*pb.Tc{global, bandwidth})
+	g.Expect(err).Should(HaveOccurred())
+}
+
+func TestTcFilter(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	testCases := []struct {
+		tc     *pb.Tc
+		filter string
+		match  string
+	}{
+		{&pb.Tc{}, "", "   "},
+		{&pb.Tc{Ipset: "chaos-a"}, "chaos-a", "chaos-a   "},
+		{&pb.Tc{Ipset: "chaos-a", Protocol: "tcp", EgressPort: "80,443"}, "chaos-a-tcp-80,443", "chaos-a tcp  80,443"},
+		// the source port is grouped by the egress port like the chaos daemon
+		{&pb.Tc{Ipset: "chaos-a", Protocol: "udp", SourcePort: "53"}, "chaos-a-udp-", "chaos-a udp 53 "},
+		// the ports are only matched with the protocol
+		{&pb.Tc{Ipset: "chaos-a", EgressPort: "80"}, "chaos-a-80", "chaos-a   "},
+	}
+
+	for _, testCase := range testCases {
+		g.Expect(tcFilter(testCase.tc)).Should(Equal(testCase.filter))
+		g.Expect(tcTablesMatch(testCase.tc)).Should(Equal(testCase.match))
+	}
+}
+
+func TestParseTcHandle(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	testCases := []struct {
+		handle string
+		value  uint32
+		errMsg string
+	}{
+		{"1:", 0x10000, ""},
+		{"3:4", 0x30004, ""},
+		{"0003:0004", 0x30004, ""},
+		{"a:", 0xa0000, ""},
+		{"10:", 0x100000, ""},
+		{"0003:000a", 0x3000a, ""},
+		{"ffff:fff1", 0xfffffff1, ""},
+		{"1", 0, "tc handle 1 not valid"},
+		{"x:", 0, "tc handle x: not valid"},
+		{"10000:", 0, "tc handle 10000: not valid"},
+	}
+
+	for _, testCase := range testCases {
+		value, err := parseTcHandle(testCase.handle)
+		if len(testCase.errMsg) == 0 {
+			g.Expect(err).ShouldNot(HaveOccurred())
+			g.Expect(value).Should(Equal(testCase.value), testCase.handle)
+		} else {
+			g.Expect(err).Should(HaveOccurred())
+			g.Expect(err.Error()).Should(ContainSubstring(testCase.errMsg))
+		}
+	}
+}
@@ -14,10 +14,9 @@
 package chaosd
 
 import (
-	"strconv"
 	"syscall"
+	"time"
 
-	"github.com/mitchellh/go-ps"
 	"github.com/pingcap/errors"
 
 	"github.com/chaos-mesh/chaosd/pkg/core"
@@ -27,39 +26,54 @@ type processAttack struct{}
 
 var ProcessAttack AttackType = processAttack{}
 
-func (processAttack) Attack(options core.AttackConfig, _ Environment) error {
+func (processAttack) Attack(options core.AttackConfig, env Environment) error {
 	attack := options.(*core.ProcessCommand)
 
-	processes, err := ps.Processes()
+	var before []*ProcessInfo
+	var err error
+	if attack.Action == core.ProcessRestartAction {
+		if before, err = matchProcesses(attack); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	processes, err := selectProcesses(attack, false)
 	if err != nil {
 		return errors.WithStack(err)
 	}
 
-	notFound := true
+	if attack.Action == core.ProcessFreezeAction {
+		return freezeProcesses(attack, processes)
+	}
+
+	selected := make(map[int]bool)
 	for _, p := range processes {
-		if attack.Process == strconv.Itoa(p.Pid()) || attack.Process == p.Executable() {
-			notFound = false
-			switch attack.Signal {
-			case int(syscall.SIGKILL):
-				err = syscall.Kill(p.Pid(), syscall.SIGKILL)
-			case int(syscall.SIGTERM):
-				err = syscall.Kill(p.Pid(), syscall.SIGTERM)
-			case int(syscall.SIGSTOP):
-				err = syscall.Kill(p.Pid(), syscall.SIGSTOP)
-			default:
-				return errors.Errorf("signal %d is not supported", attack.Signal)
-			}
-
-			if err != nil {
-				return errors.WithStack(err)
-			}
-			attack.PIDs = append(attack.PIDs, p.Pid())
+		selected[p.Pid] = true
+	}
+
+	if attack.KillChildren {
+		processes, err = expandProcessTrees(processes, attack.Signal.Recoverable())
+		if err != nil {
+			return errors.WithStack(err)
 		}
 	}
 
-	if notFound {
-		err = errors.Errorf("process %s not found", attack.Process)
-		return errors.WithStack(err)
+	killedAt := time.Now()
+	for _, p := range processes {
+		err = syscall.Kill(p.Pid, syscall.Signal(attack.Signal))
+
+		// the descendants may exit after their parent is killed
+		if err == syscall.ESRCH && !selected[p.Pid] {
+			continue
+		}
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		attack.PIDs = append(attack.PIDs, p.Pid)
+	}
+
+	if attack.Action == core.ProcessRestartAction {
+		return env.Chaos.startRestartObservation(attack, env.AttackUid, before, len(selected), killedAt)
 	}
 
 	return nil
@@ -71,12 +85,22 @@ func (processAttack) Recover(exp core.Experiment, _ Environment) error {
 		return err
 	}
 	pcmd := config.(*core.ProcessCommand)
-	if pcmd.Signal != int(syscall.SIGSTOP) {
-		return core.ErrNonRecoverableAttack.New("only SIGSTOP process attack is supported to recover")
+	if pcmd.Action == core.ProcessFreezeAction {
+		return thawCgroups(pcmd.FrozenCgroups)
 	}
 
-	for _, pid := range pcmd.PIDs {
-		if err := syscall.Kill(pid, syscall.SIGCONT); err != nil {
+	if !pcmd.Signal.Recoverable() {
+		return core.ErrNonRecoverableAttack.New("process attack with signal %s is not supported to recover", pcmd.Signal)
+	}
+
+	// the parents are resumed before their children, in the reverse order they are stopped
+	for i := len(pcmd.PIDs) - 1; i >= 0; i-- {
+		err := syscall.Kill(pcmd.PIDs[i], syscall.SIGCONT)
+		// a process in the stopped tree may be killed by others, the rest are still resumed
+		if err == syscall.ESRCH && pcmd.KillChildren {
+			continue
+		}
+		if err != nil {
 			return errors.WithStack(err)
 		}
 	}
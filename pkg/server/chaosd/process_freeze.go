@@ -0,0 +1,216 @@
+// Copyright 2021 Chaos Mesh Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package chaosd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"go.uber.org/zap"
+
+	"github.com/chaos-mesh/chaosd/pkg/core"
+	"github.com/chaos-mesh/chaosd/pkg/utils"
+)
+
+const (
+	cgroupRoot          = "/sys/fs/cgroup"
+	cgroupV2Freezer     = "cgroup.freeze"
+	cgroupV1Freezer     = "freezer.state"
+	freezeTimeout       = 10 * time.Second
+	freezePollInterval  = 10 * time.Millisecond
+	cgroupV1FrozenState = "FROZEN"
+)
+
+// freezeProcesses freezes the cgroups of the processes. The cgroups are checked before any of
+// them is frozen, and the frozen ones are thawed if a cgroup can't be frozen.
+func freezeProcesses(attack *core.ProcessCommand, processes []*ProcessInfo) error {
+	self := cgroupDirs(os.Getpid())
+
+	var freezers []string
+	found := make(map[string]bool)
+
+	for _, p := range processes {
+		freezer, err := cgroupFreezer(p.Pid)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		if inCgroup(self, filepath.Dir(freezer)) {
+			return errors.Errorf("the cgroup of process %d contains chaosd, which can't be frozen", p.Pid)
+		}
+
+		attack.PIDs = append(attack.PIDs, p.Pid)
+		if !found[freezer] {
+			found[freezer] = true
+			freezers = append(freezers, freezer)
+		}
+	}
+
+	for i, freezer := range freezers {
+		if err := freezeCgroup(freezer); err != nil {
+			if err := thawCgroups(freezers[:i]); err != nil {
+				log.Error("failed to thaw cgroups", zap.Error(err))
+			}
+			return errors.WithStack(err)
+		}
+	}
+
+	// every run of a scheduled experiment freezes a copy of the attack, and is thawed by its cgroups
+	attack.FrozenCgroups = freezers
+	return nil
+}
+
+// cgroupFreezer returns the file to freeze the cgroup of the process. The cgroup v2 is preferred,
+// and the freezer of cgroup v1 is used if the process is in the root cgroup v2 of a hybrid system.
+// The root cgroups can't be frozen.
+func cgroupFreezer(pid int) (string, error) {
+	if path, err := utils.GetCgroupV2Path(pid); err == nil && path != "/" {
+		for _, root := range []string{cgroupRoot, filepath.Join(cgroupRoot, "unified")} {
+			freezer := filepath.Join(root, path, cgroupV2Freezer)
+			if _, err := os.Stat(freezer); err == nil {
+				return freezer, nil
+			}
+		}
+	}
+
+	if path, err := utils.GetCgroupV1Path(pid, "freezer"); err == nil && path != "/" {
+		freezer := filepath.Join(cgroupRoot, "freezer", path, cgroupV1Freezer)
+		if _, err := os.Stat(freezer); err == nil {
+			return freezer, nil
+		}
+	}
+
+	return "", errors.Errorf("the cgroup of process %d can't be frozen, the process should be in a cgroup v2 "+
+		"or a cgroup v1 of the freezer controller, which is not the root", pid)
+}
+
+// cgroupDirs returns the directories of the cgroups of the process, which are its cgroup v2
+// in both the unified and hybrid mounts, and its cgroup v1 of the freezer controller.
+func cgroupDirs(pid int) []string {
+	var dirs []string
+	if path, err := utils.GetCgroupV2Path(pid); err == nil {
+		dirs = append(dirs, filepath.Join(cgroupRoot, path), filepath.Join(cgroupRoot, "unified", path))
+	}
+
+	if path, err := utils.GetCgroupV1Path(pid, "freezer"); err == nil {
+		dirs = append(dirs, filepath.Join(cgroupRoot, "freezer", path))
+	}
+
+	return dirs
+}
+
+// inCgroup returns true if any of the cgroup directories is the cgroup or its descendant,
+// freezing the cgroup freezes the descendants too.
+func inCgroup(dirs []string, cgroup string) bool {
+	for _, dir := range dirs {
+		if dir == cgroup || strings.HasPrefix(dir, cgroup+"/") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// freezeCgroup freezes the cgroup and waits for all the processes in it to be frozen.
+func freezeCgroup(freezer string) error {
+	state := "1"
+	if filepath.Base(freezer) == cgroupV1Freezer {
+		state = cgroupV1FrozenState
+	}
+
+	if err := ioutil.WriteFile(freezer, []byte(state), 0644); err != nil {
+		return errors.WithStack(err)
+	}
+
+	deadline := time.Now().Add(freezeTimeout)
+	for time.Now().Before(deadline) {
+		frozen, err := cgroupFrozen(freezer)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		if frozen {
+			return nil
+		}
+		time.Sleep(freezePollInterval)
+	}
+
+	if err := thawCgroup(freezer); err != nil {
+		log.Error("failed to thaw cgroup", zap.String("cgroup", filepath.Dir(freezer)), zap.Error(err))
+	}
+	return errors.Errorf("cgroup %s isn't frozen in %s", filepath.Dir(freezer), freezeTimeout)
+}
+
+// cgroupFrozen reads the "frozen" of cgroup.events for cgroup v2, and freezer.state for cgroup v1,
+// which is FREEZING until all the processes are frozen.
+func cgroupFrozen(freezer string) (bool, error) {
+	if filepath.Base(freezer) == cgroupV1Freezer {
+		state, err := ioutil.ReadFile(freezer) // #nosec
+		if err != nil {
+			return false, errors.WithStack(err)
+		}
+
+		return strings.TrimSpace(string(state)) == cgroupV1FrozenState, nil
+	}
+
+	events, err := ioutil.ReadFile(filepath.Join(filepath.Dir(freezer), "cgroup.events")) // #nosec
+	if err != nil {
+		return false, errors.WithStack(err)
+	}
+
+	for _, line := range strings.Split(string(events), "\n") {
+		if strings.TrimSpace(line) == "frozen 1" {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func thawCgroup(freezer string) error {
+	state := "0"
+	if filepath.Base(freezer) == cgroupV1Freezer {
+		state = "THAWED"
+	}
+
+	return errors.WithStack(ioutil.WriteFile(freezer, []byte(state), 0644))
+}
+
+// thawCgroups thaws all the cgroups even if some of them fail, the removed cgroups are ignored.
+func thawCgroups(freezers []string) error {
+	var firstErr error
+	for _, freezer := range freezers {
+		err := thawCgroup(freezer)
+		if err == nil {
+			continue
+		}
+
+		if os.IsNotExist(errors.Cause(err)) {
+			log.Warn("the frozen cgroup is removed", zap.String("cgroup", filepath.Dir(freezer)))
+			continue
+		}
+
+		log.Error("failed to thaw cgroup", zap.String("cgroup", filepath.Dir(freezer)), zap.Error(err))
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	return firstErr
+}
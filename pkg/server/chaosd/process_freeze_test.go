@@ -0,0 +1,34 @@
+// Copyright 2021 Chaos Mesh Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package chaosd
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestInCgroup(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	self := []string{"/sys/fs/cgroup/system.slice/chaosd.service", "/sys/fs/cgroup/freezer/chaosd"}
+
+	g.Expect(inCgroup(self, "/sys/fs/cgroup/system.slice/chaosd.service")).Should(BeTrue())
+	g.Expect(inCgroup(self, "/sys/fs/cgroup/system.slice")).Should(BeTrue())
+	g.Expect(inCgroup(self, "/sys/fs/cgroup/freezer/chaosd")).Should(BeTrue())
+	g.Expect(inCgroup(self, "/sys/fs/cgroup/system.slice/nginx.service")).Should(BeFalse())
+	// the prefix is compared by directories
+	g.Expect(inCgroup(self, "/sys/fs/cgroup/system")).Should(BeFalse())
+	g.Expect(inCgroup(self, "/sys/fs/cgroup/freezer/chaos")).Should(BeFalse())
+}
@@ -0,0 +1,238 @@
+// Copyright 2021 Chaos Mesh Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package chaosd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"go.uber.org/zap"
+
+	"github.com/chaos-mesh/chaosd/pkg/core"
+)
+
+const (
+	restartPollInterval = 100 * time.Millisecond
+	restartProbeTimeout = time.Second
+	// restartRecordTimeout is the timeout of waiting for the experiment to be updated after the attack.
+	restartRecordTimeout = 10 * time.Second
+)
+
+// startRestartObservation observes the killed processes in background, the attack returns right after
+// they are killed. The result of a run of scheduled experiment is recorded in the run, because the
+// attack of the experiment isn't updated by its runs, so the run is found before the next run starts.
+func (s *Server) startRestartObservation(attack *core.ProcessCommand, uid string, before []*ProcessInfo, killed int, killedAt time.Time) error {
+	var runUID string
+	if len(attack.Cron()) > 0 {
+		exp, err := s.exp.FindByUid(context.Background(), uid)
+		if err != nil || exp == nil {
+			return errors.Errorf("experiment %s not found: %v", uid, err)
+		}
+
+		run, err := s.ExpRun.LatestRun(context.Background(), exp.ID)
+		if err != nil || run == nil {
+			return errors.Errorf("run of experiment %s not found: %v", uid, err)
+		}
+		runUID = run.UID
+	}
+
+	done := make(chan struct{})
+	s.restartObservations.Store(uid, done)
+
+	// the attack is read by the experiment when the attack returns, so a copy is observed
+	observed := *attack
+	go func() {
+		defer func() {
+			s.restartObservations.Delete(uid)
+			close(done)
+		}()
+
+		s.observeRestart(&observed, uid, runUID, before, killed, killedAt)
+	}()
+
+	return nil
+}
+
+// observeRestart waits for the killed processes to come back, and records the result in the run,
+// or in the attack of the experiment if the run is empty.
+func (s *Server) observeRestart(attack *core.ProcessCommand, uid string, runUID string, before []*ProcessInfo, killed int, killedAt time.Time) {
+	result := waitForRestart(attack, before, killed, killedAt)
+	if result.Recovered {
+		log.Info("processes come back", zap.String("uid", uid),
+			zap.Float64("time to recovery", result.TimeToRecovery), zap.Ints("pids", result.NewPIDs))
+	} else {
+		log.Warn("processes don't come back before the timeout", zap.String("uid", uid), zap.String("message", result.Message))
+	}
+
+	var err error
+	if len(runUID) > 0 {
+		var data []byte
+		if data, err = json.Marshal(result); err == nil {
+			err = s.ExpRun.UpdateResult(context.Background(), runUID, string(data))
+		}
+	} else {
+		err = s.recordRestart(uid, result)
+	}
+
+	if err != nil {
+		log.Error("failed to record the result of restart", zap.String("uid", uid), zap.Error(err))
+	}
+}
+
+// recordRestart records the result in the attack of the experiment, after the experiment is updated
+// by ExecuteAttack with the status and attack.
+func (s *Server) recordRestart(uid string, result *core.ProcessRestartResult) error {
+	deadline := time.Now().Add(restartRecordTimeout)
+	for {
+		exp, err := s.exp.FindByUid(context.Background(), uid)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		if exp == nil {
+			return errors.Errorf("experiment %s not found", uid)
+		}
+
+		if exp.Status == core.Created && time.Now().Before(deadline) {
+			time.Sleep(restartPollInterval)
+			continue
+		}
+
+		attack := &core.ProcessCommand{}
+		if err := json.Unmarshal([]byte(exp.RecoverCommand), attack); err != nil {
+			return errors.WithStack(err)
+		}
+		attack.Restart = result
+
+		return errors.WithStack(s.exp.Update(context.Background(), uid, exp.Status, exp.Message, attack.RecoverData()))
+	}
+}
+
+// RestartResult waits for the observation of the restart attack, and returns the result recorded in
+// the experiment. It's nil if the experiment isn't a restart attack.
+func (s *Server) RestartResult(uid string) (*core.ProcessRestartResult, error) {
+	if done, ok := s.restartObservations.Load(uid); ok {
+		<-done.(chan struct{})
+	}
+
+	exp, err := s.exp.FindByUid(context.Background(), uid)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	if exp == nil {
+		return nil, errors.Errorf("experiment %s not found", uid)
+	}
+
+	attack := &core.ProcessCommand{}
+	if err := json.Unmarshal([]byte(exp.RecoverCommand), attack); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return attack.Restart, nil
+}
+
+// waitForRestart waits until as many new processes as the killed ones match the selectors and the
+// probes succeed. A process matched before the attack isn't a new process, even if it's not killed.
+func waitForRestart(attack *core.ProcessCommand, before []*ProcessInfo, killed int, killedAt time.Time) *core.ProcessRestartResult {
+	result := &core.ProcessRestartResult{KilledAt: killedAt}
+
+	// the timeout is checked by validation
+	timeout, _ := attack.RestartTimeoutDuration()
+	deadline := killedAt.Add(timeout)
+
+	old := make(map[int]bool)
+	for _, p := range before {
+		old[p.Pid] = true
+	}
+	for _, pid := range attack.PIDs {
+		old[pid] = true
+	}
+
+	ticker := time.NewTicker(restartPollInterval)
+	defer ticker.Stop()
+
+	var newPIDs []int
+	var probeErr error
+	for ; time.Now().Before(deadline); <-ticker.C {
+		if len(newPIDs) < killed {
+			processes, err := matchProcesses(attack)
+			if err != nil {
+				result.Message = err.Error()
+				return result
+			}
+
+			newPIDs = newPIDs[:0]
+			for _, p := range processes {
+				if !old[p.Pid] {
+					newPIDs = append(newPIDs, p.Pid)
+				}
+			}
+
+			if len(newPIDs) < killed {
+				continue
+			}
+		}
+
+		if probeErr = probeRestart(attack); probeErr != nil {
+			continue
+		}
+
+		result.Recovered = true
+		result.TimeToRecovery = time.Since(killedAt).Seconds()
+		result.NewPIDs = newPIDs
+		return result
+	}
+
+	result.NewPIDs = newPIDs
+	if len(newPIDs) < killed {
+		result.Message = fmt.Sprintf("%d of the %d killed processes come back before the timeout", len(newPIDs), killed)
+	} else {
+		result.Message = fmt.Sprintf("the processes come back but the probe fails before the timeout: %s", probeErr)
+	}
+
+	return result
+}
+
+// probeRestart checks whether the new processes are ready by the probes of the attack.
+func probeRestart(attack *core.ProcessCommand) error {
+	if len(attack.ProbeTCP) > 0 {
+		conn, err := net.DialTimeout("tcp", attack.ProbeTCP, restartProbeTimeout)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		conn.Close()
+	}
+
+	if len(attack.ProbeHTTP) > 0 {
+		client := &http.Client{Timeout: restartProbeTimeout}
+		resp, err := client.Get(attack.ProbeHTTP) // #nosec
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode >= http.StatusBadRequest {
+			return errors.Errorf("http probe answers %s", resp.Status)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,325 @@
+// Copyright 2021 Chaos Mesh Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package chaosd
+
+import (
+	"math/rand"
+	"os"
+	"os/user"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mitchellh/go-ps"
+	"github.com/pingcap/errors"
+	"github.com/shirou/gopsutil/process"
+
+	"github.com/chaos-mesh/chaosd/pkg/core"
+	"github.com/chaos-mesh/chaosd/pkg/utils"
+)
+
+// ProcessInfo is a process selected by a process attack.
+type ProcessInfo struct {
+	Pid        int    `json:"pid"`
+	PPid       int    `json:"ppid"`
+	Name       string `json:"name"`
+	Cmdline    string `json:"cmdline"`
+	CreateTime int64  `json:"create_time"`
+}
+
+// PreviewProcesses returns the processes which would be attacked by the attack, nothing is sent
+// to them. If Count processes are picked at random, all the processes they are picked from are
+// returned, because another pick may be made when attacking. The descendants are returned in
+// the order they would be signaled if KillChildren is true.
+func (s *Server) PreviewProcesses(attack *core.ProcessCommand) ([]*ProcessInfo, error) {
+	if err := attack.Validate(); err != nil {
+		return nil, core.ErrAttackConfigValidation.Wrap(err, "attack config validation failed")
+	}
+
+	processes, err := selectProcesses(attack, !attack.Newest && !attack.Oldest)
+	if err != nil || !attack.KillChildren {
+		return processes, err
+	}
+
+	return expandProcessTrees(processes, attack.Signal.Recoverable())
+}
+
+// selectProcesses returns the processes matching all the selectors of the attack, then picks
+// PickCount of them. The random pick is skipped if skipRandom is true.
+func selectProcesses(attack *core.ProcessCommand, skipRandom bool) ([]*ProcessInfo, error) {
+	selected, err := matchProcesses(attack)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	if len(selected) == 0 {
+		if len(attack.Process) > 0 {
+			return nil, errors.Errorf("process %s not found", attack.Process)
+		}
+		return nil, errors.New("no process matches the selectors")
+	}
+
+	count := attack.PickCount()
+	if count == 0 || count > len(selected) {
+		count = len(selected)
+	}
+
+	if count > core.MaxAttackedProcesses && !attack.AllowMany {
+		return nil, errors.Errorf("%d processes match the selectors, more than %d processes can only be attacked with allow-many",
+			len(selected), core.MaxAttackedProcesses)
+	}
+
+	if count == len(selected) {
+		return selected, nil
+	}
+
+	switch {
+	case attack.Newest, attack.Oldest:
+		// the create time is in clock ticks, so the pid is compared if they are created in the same tick
+		sort.Slice(selected, func(i, j int) bool {
+			older := selected[i].CreateTime < selected[j].CreateTime ||
+				(selected[i].CreateTime == selected[j].CreateTime && selected[i].Pid < selected[j].Pid)
+			return older != attack.Newest
+		})
+	case skipRandom:
+		return selected, nil
+	default:
+		r := rand.New(rand.NewSource(time.Now().UnixNano())) // #nosec
+		r.Shuffle(len(selected), func(i, j int) {
+			selected[i], selected[j] = selected[j], selected[i]
+		})
+	}
+
+	return selected[:count], nil
+}
+
+// matchProcesses returns the processes matching all the selectors of the attack. The processes
+// exiting while they are matched are ignored, and so are chaosd and its ancestors, such as the
+// shell running chaosd whose command line contains the selectors, the init process and the
+// kernel threads.
+func matchProcesses(attack *core.ProcessCommand) ([]*ProcessInfo, error) {
+	selector, err := newProcessSelector(attack)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	processes, err := ps.Processes()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	parents := make(map[int]int)
+	for _, p := range processes {
+		parents[p.Pid()] = p.PPid()
+	}
+
+	excluded := make(map[int]bool)
+	for pid := os.Getpid(); pid > 0 && !excluded[pid]; pid = parents[pid] {
+		excluded[pid] = true
+	}
+
+	var matched []*ProcessInfo
+	for _, p := range processes {
+		if excluded[p.Pid()] {
+			continue
+		}
+
+		if info, ok := selector.match(p); ok && !isSystemProcess(info) {
+			matched = append(matched, info)
+		}
+	}
+
+	return matched, nil
+}
+
+// isSystemProcess returns true if the process is the init process or a kernel thread, which are
+// never attacked. The kernel threads are kthreadd and its children, and have no command line.
+func isSystemProcess(info *ProcessInfo) bool {
+	return info.Pid == 1 || info.Pid == 2 || info.PPid == 2 || len(info.Cmdline) == 0
+}
+
+type processSelector struct {
+	attack  *core.ProcessCommand
+	cmdline *regexp.Regexp
+	uid     int32
+	cgroup  string
+}
+
+func newProcessSelector(attack *core.ProcessCommand) (*processSelector, error) {
+	selector := &processSelector{
+		attack: attack,
+		uid:    -1,
+		cgroup: strings.TrimSuffix(attack.Cgroup, "/"),
+	}
+
+	if len(attack.Cmdline) > 0 {
+		re, err := regexp.Compile(attack.Cmdline)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		selector.cmdline = re
+	}
+
+	if len(attack.User) > 0 {
+		uid, err := strconv.Atoi(attack.User)
+		if err != nil {
+			u, err := user.Lookup(attack.User)
+			if err != nil {
+				return nil, errors.WithStack(err)
+			}
+
+			if uid, err = strconv.Atoi(u.Uid); err != nil {
+				return nil, errors.WithStack(err)
+			}
+		}
+		selector.uid = int32(uid)
+	}
+
+	return selector, nil
+}
+
+// match checks the selectors from the cheap ones, it returns false if the process exits.
+func (s *processSelector) match(p ps.Process) (*ProcessInfo, bool) {
+	attack := s.attack
+	if len(attack.Process) > 0 && attack.Process != strconv.Itoa(p.Pid()) {
+		if attack.Substring && !strings.Contains(p.Executable(), attack.Process) {
+			return nil, false
+		}
+		if !attack.Substring && attack.Process != p.Executable() {
+			return nil, false
+		}
+	}
+
+	if attack.PPid > 0 && attack.PPid != p.PPid() {
+		return nil, false
+	}
+
+	if len(attack.Cgroup) > 0 {
+		path, err := utils.GetCgroupV2Path(p.Pid())
+		if err != nil {
+			return nil, false
+		}
+
+		if s.cgroup != path && !strings.HasPrefix(path, s.cgroup+"/") {
+			return nil, false
+		}
+	}
+
+	if s.uid >= 0 {
+		proc, err := process.NewProcess(int32(p.Pid()))
+		if err != nil {
+			return nil, false
+		}
+
+		// the uids are real, effective, saved set and filesystem uids
+		uids, err := proc.Uids()
+		if err != nil || len(uids) < 2 || uids[1] != s.uid {
+			return nil, false
+		}
+	}
+
+	info, ok := newProcessInfo(p)
+	if !ok {
+		return nil, false
+	}
+
+	if s.cmdline != nil && !s.cmdline.MatchString(info.Cmdline) {
+		return nil, false
+	}
+
+	return info, true
+}
+
+// newProcessInfo returns false if the process exits.
+func newProcessInfo(p ps.Process) (*ProcessInfo, bool) {
+	proc, err := process.NewProcess(int32(p.Pid()))
+	if err != nil {
+		return nil, false
+	}
+
+	cmdline, err := proc.Cmdline()
+	if err != nil {
+		return nil, false
+	}
+
+	createTime, err := proc.CreateTime()
+	if err != nil {
+		return nil, false
+	}
+
+	return &ProcessInfo{
+		Pid:        p.Pid(),
+		PPid:       p.PPid(),
+		Name:       p.Executable(),
+		Cmdline:    cmdline,
+		CreateTime: createTime,
+	}, true
+}
+
+// expandProcessTrees returns the selected processes with all their descendants, every process is
+// followed by its descendants, or preceded by them if childrenFirst is true. A selected process is
+// returned in the tree of its selected ancestor.
+func expandProcessTrees(selected []*ProcessInfo, childrenFirst bool) ([]*ProcessInfo, error) {
+	processes, err := ps.Processes()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	graph := utils.NewGraph()
+	pids := make(map[int]ps.Process)
+	for _, p := range processes {
+		graph.Insert(uint32(p.PPid()), uint32(p.Pid()))
+		pids[p.Pid()] = p
+	}
+
+	descendants := make(map[int][]uint32)
+	inTree := make(map[int]bool)
+	for _, info := range selected {
+		descendants[info.Pid] = graph.Flatten(uint32(info.Pid))
+		for _, pid := range descendants[info.Pid] {
+			inTree[int(pid)] = true
+		}
+	}
+
+	self := os.Getpid()
+	var trees []*ProcessInfo
+	for _, info := range selected {
+		if inTree[info.Pid] {
+			continue
+		}
+
+		tree := []*ProcessInfo{info}
+		for _, pid := range descendants[info.Pid] {
+			p, ok := pids[int(pid)]
+			if !ok || p.Pid() == self {
+				continue
+			}
+
+			if child, ok := newProcessInfo(p); ok {
+				tree = append(tree, child)
+			}
+		}
+
+		if childrenFirst {
+			for i, j := 0, len(tree)-1; i < j; i, j = i+1, j-1 {
+				tree[i], tree[j] = tree[j], tree[i]
+			}
+		}
+		trees = append(trees, tree...)
+	}
+
+	return trees, nil
+}
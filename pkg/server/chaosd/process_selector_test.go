@@ -0,0 +1,96 @@
+// Copyright 2021 Chaos Mesh Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package chaosd
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"testing"
+
+	. "github.com/onsi/gomega"
+
+	"github.com/chaos-mesh/chaosd/pkg/core"
+)
+
+func TestIsSystemProcess(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	testCases := []struct {
+		info   ProcessInfo
+		system bool
+	}{
+		{ProcessInfo{Pid: 1, PPid: 0, Cmdline: "/sbin/init"}, true},
+		{ProcessInfo{Pid: 2, PPid: 0, Cmdline: ""}, true},
+		{ProcessInfo{Pid: 12, PPid: 2, Cmdline: ""}, true},
+		// the kernel threads are children of kthreadd even if a command line is read
+		{ProcessInfo{Pid: 13, PPid: 2, Cmdline: "kworker/0:1"}, true},
+		{ProcessInfo{Pid: 14, PPid: 1, Cmdline: ""}, true},
+		{ProcessInfo{Pid: 1432, PPid: 1, Cmdline: "java -Xmx1G kafka.Kafka"}, false},
+	}
+
+	for _, testCase := range testCases {
+		g.Expect(isSystemProcess(&testCase.info)).Should(Equal(testCase.system), strconv.Itoa(testCase.info.Pid))
+	}
+}
+
+func TestMatchProcesses_System(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	// the init process is never matched, even by its pid
+	matched, err := matchProcesses(&core.ProcessCommand{Process: "1"})
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(matched).Should(BeEmpty())
+
+	// the kernel threads are the children of kthreadd
+	matched, err = matchProcesses(&core.ProcessCommand{PPid: 2})
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(matched).Should(BeEmpty())
+
+	// chaosd itself isn't matched either
+	matched, err = matchProcesses(&core.ProcessCommand{Process: strconv.Itoa(os.Getpid())})
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(matched).Should(BeEmpty())
+}
+
+func TestSelectProcesses_AllowMany(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	// the sleep processes are matched by their unique duration
+	duration := fmt.Sprintf("300.%d", os.Getpid())
+	for i := 0; i <= core.MaxAttackedProcesses; i++ {
+		cmd := exec.Command("sleep", duration)
+		g.Expect(cmd.Start()).Should(Succeed())
+		defer func() {
+			_ = cmd.Process.Kill()
+			_ = cmd.Wait()
+		}()
+	}
+
+	cmdline := "^sleep " + regexp.QuoteMeta(duration) + "$"
+	_, err := selectProcesses(&core.ProcessCommand{Cmdline: cmdline}, false)
+	g.Expect(err).Should(HaveOccurred())
+	g.Expect(err.Error()).Should(ContainSubstring("allow-many"))
+
+	selected, err := selectProcesses(&core.ProcessCommand{Cmdline: cmdline, AllowMany: true}, false)
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(selected).Should(HaveLen(core.MaxAttackedProcesses + 1))
+
+	// the processes picked from the matched ones are under the max
+	selected, err = selectProcesses(&core.ProcessCommand{Cmdline: cmdline, Count: 1}, false)
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(selected).Should(HaveLen(1))
+}
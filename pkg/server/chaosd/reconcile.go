@@ -0,0 +1,546 @@
+// Copyright 2021 Chaos Mesh Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package chaosd
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"go.uber.org/zap"
+
+	"github.com/chaos-mesh/chaos-mesh/pkg/chaosdaemon/pb"
+
+	"github.com/chaos-mesh/chaosd/pkg/core"
+)
+
+// The types of the network rules which may drift from the records.
+const (
+	DriftIPSet    = "ipset"
+	DriftIptables = "iptables"
+	DriftTC       = "tc"
+	DriftRedirect = "redirect"
+	DriftMark     = "mark"
+)
+
+// Drift is a network rule of an active experiment which is recorded but not found in the kernel,
+// such as a qdisc deleted by `tc qdisc del` or all the rules flushed by a reboot.
+type Drift struct {
+	Experiment string `json:"experiment"`
+	// ContainerID is the id of container in whose network namespace the rule is applied,
+	// it is empty if the rule is applied on the host.
+	ContainerID string `json:"container_id,omitempty"`
+	Type        string `json:"type"`
+	// Name is the name of ipset or iptables chain, the device of tc rules, or the ifb device
+	// whose traffic is redirected.
+	Name    string `json:"name"`
+	Message string `json:"message"`
+}
+
+// DriftReport is the result of comparing the recorded network rules with the kernel.
+type DriftReport struct {
+	CheckedAt time.Time `json:"checked_at"`
+	Drifts    []*Drift  `json:"drifts"`
+	// Reconciled are the experiments whose rules are applied again, and Failed are the
+	// experiments whose rules can't be applied again, which are recovered and marked error.
+	Reconciled []string `json:"reconciled,omitempty"`
+	Failed     []string `json:"failed,omitempty"`
+}
+
+// StartReconciler compares the recorded network rules with the kernel every interval,
+// the rules of the drifted experiments are applied again if reapply is true.
+func (s *Server) StartReconciler(interval time.Duration, reapply bool) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			report, err := s.Reconcile(reapply)
+			if err != nil {
+				log.Error("failed to reconcile network rules", zap.Error(err))
+				continue
+			}
+
+			if len(report.Drifts) > 0 {
+				log.Warn("network rules drifted", zap.Int("drifts", len(report.Drifts)),
+					zap.Strings("reconciled", report.Reconciled), zap.Strings("failed", report.Failed))
+			}
+		}
+	}()
+}
+
+// DriftReport returns the report of the last reconciliation, or reconciles without
+// applying the rules again if there is no report yet or refresh is true.
+func (s *Server) DriftReport(refresh bool) (*DriftReport, error) {
+	s.driftLock.Lock()
+	report := s.driftReport
+	s.driftLock.Unlock()
+
+	if report != nil && !refresh {
+		return report, nil
+	}
+
+	return s.Reconcile(false)
+}
+
+// Reconcile detects the drifted network rules of active experiments. If reapply is true,
+// all the network rules in the network namespaces with drifts are applied again, and the
+// experiments are recovered and marked error if their rules can't be applied again.
+func (s *Server) Reconcile(reapply bool) (*DriftReport, error) {
+	report, causes, err := s.reconcile(reapply)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	// the recovery of network attack takes the network lock
+	for _, uid := range report.Failed {
+		s.failDriftedExperiment(uid, causes[uid])
+	}
+
+	s.driftLock.Lock()
+	s.driftReport = report
+	s.driftLock.Unlock()
+
+	return report, nil
+}
+
+// reconcile detects and applies the drifted rules again with the network lock, so the rules
+// aren't changed by the attacks meanwhile. It returns the causes of the failed experiments.
+func (s *Server) reconcile(reapply bool) (*DriftReport, map[string]error, error) {
+	s.networkLock.Lock()
+	defer s.networkLock.Unlock()
+
+	drifts, err := s.DetectDrift()
+	if err != nil {
+		return nil, nil, errors.WithStack(err)
+	}
+
+	report := &DriftReport{
+		CheckedAt: time.Now(),
+		Drifts:    drifts,
+	}
+
+	causes := make(map[string]error)
+	if reapply {
+		causes = s.reapplyDrifts(report)
+	}
+
+	return report, causes, nil
+}
+
+// DetectDrift compares the recorded ipsets, iptables chains and tc rules of the active
+// experiments with the ones in the kernel, including the ifb devices, the clsact qdiscs
+// redirecting traffic to them and the mark chain of the redirected packets.
+func (s *Server) DetectDrift() ([]*Drift, error) {
+	active, err := s.activeExperiments()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	var drifts []*Drift
+	for _, detect := range []func(map[string]bool) ([]*Drift, error){
+		s.detectIPSetDrift,
+		s.detectIptablesDrift,
+		s.detectTCDrift,
+		s.detectRedirectDrift,
+	} {
+		ds, err := detect(active)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		drifts = append(drifts, ds...)
+	}
+
+	return drifts, nil
+}
+
+// activeExperiments returns the uids of experiments whose network rules should be applied,
+// the rules of scheduled experiments are applied during their runs.
+func (s *Server) activeExperiments() (map[string]bool, error) {
+	active := make(map[string]bool)
+	for _, status := range []string{core.Success, core.Scheduled} {
+		exps, err := s.exp.ListByStatus(context.Background(), status)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		for _, exp := range exps {
+			active[exp.Uid] = true
+		}
+	}
+
+	return active, nil
+}
+
+func (s *Server) detectIPSetDrift(active map[string]bool) ([]*Drift, error) {
+	rules, err := s.ipsetRule.List(context.Background())
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	var drifts []*Drift
+	for _, rule := range rules {
+		if !active[rule.Experiment] {
+			continue
+		}
+
+		if err := s.checkNetNSCommand(rule.ContainerID, "ipset", "-n", "list", rule.Name); err != nil {
+			drifts = append(drifts, &Drift{
+				Experiment:  rule.Experiment,
+				ContainerID: rule.ContainerID,
+				Type:        DriftIPSet,
+				Name:        rule.Name,
+				Message:     fmt.Sprintf("ipset not found: %s", err),
+			})
+		}
+	}
+
+	return drifts, nil
+}
+
+func (s *Server) detectIptablesDrift(active map[string]bool) ([]*Drift, error) {
+	rules, err := s.iptablesRule.List(context.Background())
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	var drifts []*Drift
+	for _, rule := range rules {
+		if !active[rule.Experiment] {
+			continue
+		}
+
+		iptables := "iptables"
+		if rule.Family == core.FamilyIPv6 {
+			iptables = "ip6tables"
+		}
+
+		err := s.checkNetNSCommand(rule.ContainerID, iptables, "-w", "-S", rule.Name)
+		if err == nil {
+			err = s.checkNetNSCommand(rule.ContainerID, iptables, "-w", "-C", "CHAOS-"+rule.Direction, "-j", rule.Name)
+		}
+
+		if err != nil {
+			drifts = append(drifts, &Drift{
+				Experiment:  rule.Experiment,
+				ContainerID: rule.ContainerID,
+				Type:        DriftIptables,
+				Name:        rule.Name,
+				Message:     fmt.Sprintf("%s chain not found or not jumped from CHAOS-%s: %s", iptables, rule.Direction, err),
+			})
+		}
+	}
+
+	return drifts, nil
+}
+
+// detectTCDrift compares the number of netem and tbf qdiscs of every device with the recorded
+// tc rules, every tc rule is set as a netem or tbf qdisc by the chaos daemon.
+func (s *Server) detectTCDrift(active map[string]bool) ([]*Drift, error) {
+	rules, err := s.tcRule.List(context.Background())
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	containers := make(map[string]bool)
+	for _, rule := range rules {
+		if active[rule.Experiment] {
+			containers[rule.ContainerID] = true
+		}
+	}
+
+	var drifts []*Drift
+	for containerID := range containers {
+		devices, err := s.tcRule.ListGroupDevice(context.Background(), containerID)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		for device, rs := range devices {
+			var message string
+			qdiscs, err := s.listQdiscs(containerID, device)
+			if err != nil {
+				message = err.Error()
+			} else {
+				count := 0
+				for _, q := range qdiscs {
+					if q.kind == "netem" || q.kind == "tbf" {
+						count++
+					}
+				}
+
+				if count != len(rs) {
+					message = fmt.Sprintf("%d tc rules are recorded but %d netem and tbf qdiscs are found", len(rs), count)
+				}
+			}
+
+			if len(message) == 0 {
+				continue
+			}
+
+			experiments := make(map[string]bool)
+			for _, rule := range rs {
+				if !active[rule.Experiment] || experiments[rule.Experiment] {
+					continue
+				}
+				experiments[rule.Experiment] = true
+
+				drifts = append(drifts, &Drift{
+					Experiment:  rule.Experiment,
+					ContainerID: containerID,
+					Type:        DriftTC,
+					Name:        device,
+					Message:     message,
+				})
+			}
+		}
+	}
+
+	return drifts, nil
+}
+
+// detectRedirectDrift checks the ifb devices of the redirected tc rules, the clsact qdiscs of
+// the devices whose traffic is redirected, and the mark chain of iptables if the packets are
+// selected by marks. The mark chain of ip6tables is only set for the rules targeting IPv6
+// addresses, so it isn't checked.
+func (s *Server) detectRedirectDrift(active map[string]bool) ([]*Drift, error) {
+	rules, err := s.tcRule.List(context.Background())
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	var drifts []*Drift
+	found := make(map[string]bool)
+	addDrift := func(rule *core.TCRule, driftType string, name string, message string) {
+		key := strings.Join([]string{rule.Experiment, rule.ContainerID, driftType, name}, "/")
+		if found[key] {
+			return
+		}
+		found[key] = true
+
+		drifts = append(drifts, &Drift{
+			Experiment:  rule.Experiment,
+			ContainerID: rule.ContainerID,
+			Type:        driftType,
+			Name:        name,
+			Message:     message,
+		})
+	}
+
+	for _, rule := range rules {
+		device := redirectedDevice(rule)
+		if !active[rule.Experiment] || len(device) == 0 {
+			continue
+		}
+
+		if err := s.checkNetNSCommand(rule.ContainerID, "ip", "link", "show", "dev", rule.Device); err != nil {
+			addDrift(rule, DriftRedirect, rule.Device, fmt.Sprintf("ifb device not found: %s", err))
+		} else if err := s.checkClsact(rule.ContainerID, device); err != nil {
+			addDrift(rule, DriftRedirect, rule.Device, fmt.Sprintf("traffic of %s isn't redirected: %s", device, err))
+		}
+
+		if rule.Mark == 0 {
+			continue
+		}
+
+		err := s.checkNetNSCommand(rule.ContainerID, "iptables", "-w", "-t", "mangle", "-S", markChain)
+		if err == nil {
+			err = s.checkNetNSCommand(rule.ContainerID, "iptables", "-w", "-t", "mangle", "-C", "OUTPUT", "-j", markChain)
+		}
+
+		if err != nil {
+			addDrift(rule, DriftMark, markChain, fmt.Sprintf("mark chain not found or not jumped from OUTPUT: %s", err))
+		}
+	}
+
+	return drifts, nil
+}
+
+// checkClsact returns an error if the clsact qdisc of the device isn't found.
+func (s *Server) checkClsact(containerID string, device string) error {
+	qdiscs, err := s.listQdiscs(containerID, device)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	for _, q := range qdiscs {
+		if q.kind == "clsact" {
+			return nil
+		}
+	}
+
+	return errors.Errorf("clsact qdisc of device %s not found", device)
+}
+
+// reapplyDrifts applies all the network rules in the network namespaces with drifts again.
+// It returns the causes of the experiments whose rules can't be applied again, which should
+// be failed by failDriftedExperiment.
+func (s *Server) reapplyDrifts(report *DriftReport) map[string]error {
+	causes := make(map[string]error)
+	experiments := make(map[string]map[string]bool)
+	for _, drift := range report.Drifts {
+		if experiments[drift.ContainerID] == nil {
+			experiments[drift.ContainerID] = make(map[string]bool)
+		}
+		experiments[drift.ContainerID][drift.Experiment] = true
+	}
+
+	for containerID, uids := range experiments {
+		names := make([]string, 0, len(uids))
+		for uid := range uids {
+			names = append(names, uid)
+		}
+		sort.Strings(names)
+
+		err := s.reapplyNetworkRules(containerID)
+		if err == nil {
+			report.Reconciled = append(report.Reconciled, names...)
+			continue
+		}
+
+		log.Error("failed to apply network rules again", zap.String("container", containerID), zap.Error(err))
+		for _, uid := range names {
+			causes[uid] = err
+		}
+		report.Failed = append(report.Failed, names...)
+	}
+
+	return causes
+}
+
+// reapplyNetworkRules sets the recorded ipsets, iptables chains and tc rules in the network
+// namespace of the container again. The missing ifb devices are created before their tc rules
+// are set, then the mark chains and the clsact qdiscs redirecting traffic to them are rebuilt.
+func (s *Server) reapplyNetworkRules(containerID string) error {
+	tcRules, err := s.tcRule.List(context.Background())
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	var redirected []string
+	found := make(map[string]bool)
+	for _, rule := range tcRules {
+		device := redirectedDevice(rule)
+		if rule.ContainerID != containerID || len(device) == 0 {
+			continue
+		}
+
+		if err := s.ensureIfbDevice(containerID, rule.Device); err != nil {
+			return errors.WithStack(err)
+		}
+
+		if !found[device] {
+			found[device] = true
+			redirected = append(redirected, device)
+		}
+	}
+
+	rules, err := s.ipsetRule.List(context.Background())
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	for _, rule := range rules {
+		if rule.ContainerID != containerID {
+			continue
+		}
+
+		set := &pb.IPSet{Name: rule.Name}
+		if len(rule.Cidrs) > 0 {
+			set.Cidrs = strings.Split(rule.Cidrs, ",")
+		}
+		if rule.Family == core.FamilyIPv6 {
+			if err := s.flushIPv6Set(containerID, set); err != nil {
+				return errors.WithStack(err)
+			}
+			continue
+		}
+
+		if _, err := s.svr.FlushIPSets(context.Background(), &pb.IPSetsRequest{
+			Ipsets:      []*pb.IPSet{set},
+			ContainerId: containerID,
+			EnterNS:     len(containerID) > 0,
+		}); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	if err := s.resetIptables(containerID); err != nil {
+		return errors.WithStack(err)
+	}
+
+	if err := s.resetCgroupMarks(containerID); err != nil {
+		return errors.WithStack(err)
+	}
+
+	for _, device := range redirected {
+		if err := s.resetRedirect(containerID, device, false); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	return nil
+}
+
+// ensureIfbDevice creates the ifb device if it's deleted, and sets it up.
+func (s *Server) ensureIfbDevice(containerID string, ifb string) error {
+	if err := s.checkNetNSCommand(containerID, "ip", "link", "show", "dev", ifb); err != nil {
+		log.Warn("the ifb device is deleted, create it again", zap.String("device", ifb))
+
+		if err := s.runNetNSCommand(containerID, "ip", "link", "add", "name", ifb, "type", "ifb"); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	return s.runNetNSCommand(containerID, "ip", "link", "set", "dev", ifb, "up")
+}
+
+// failDriftedExperiment recovers the experiment whose rules can't be applied again, so its
+// remaining rules don't impact the other experiments, then marks it error. It must be called
+// without the network lock, which is taken by the recovery.
+func (s *Server) failDriftedExperiment(uid string, cause error) {
+	exp, err := s.exp.FindByUid(context.Background(), uid)
+	if err != nil || exp == nil {
+		log.Error("failed to find the drifted experiment", zap.String("uid", uid), zap.Error(err))
+		return
+	}
+
+	if err := NetworkAttack.Recover(*exp, s.newEnvironment(uid)); err != nil {
+		log.Error("failed to recover the drifted experiment", zap.String("uid", uid), zap.Error(err))
+	}
+
+	message := fmt.Sprintf("the drifted network rules can't be applied again: %s", cause)
+	if err := s.exp.Update(context.Background(), uid, core.Error, message, exp.RecoverCommand); err != nil {
+		log.Error("failed to update experiment", zap.String("uid", uid), zap.Error(err))
+	}
+}
+
+// checkNetNSCommand runs the command in the network namespace of the container,
+// and returns an error with the output if it fails.
+func (s *Server) checkNetNSCommand(containerID string, name string, args ...string) error {
+	cmd, err := s.netNSCommand(containerID, name, args...)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return errors.Errorf("%s, output: %s", err, strings.TrimSpace(string(output)))
+	}
+
+	return nil
+}
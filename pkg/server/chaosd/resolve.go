@@ -0,0 +1,195 @@
+// Copyright 2021 Chaos Mesh Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package chaosd
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"go.uber.org/zap"
+
+	"github.com/chaos-mesh/chaos-mesh/pkg/chaosdaemon/pb"
+
+	"github.com/chaos-mesh/chaosd/pkg/core"
+)
+
+// StartResolver resolves the hostnames of the active network experiments every interval,
+// so the experiments keep impacting the endpoints whose addresses rotate.
+func (s *Server) StartResolver(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			updated, err := s.ResolveHostnames()
+			if err != nil {
+				log.Error("failed to resolve hostnames", zap.Error(err))
+				continue
+			}
+
+			if len(updated) > 0 {
+				log.Info("addresses of hostnames changed", zap.Strings("experiments", updated))
+			}
+		}
+	}()
+}
+
+// ResolveHostnames resolves the hostnames of the active network experiments again, and updates
+// their ipsets in place if the addresses change. It returns the uids of the updated experiments.
+func (s *Server) ResolveHostnames() ([]string, error) {
+	active, err := s.activeExperiments()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	uids := make([]string, 0, len(active))
+	for uid := range active {
+		uids = append(uids, uid)
+	}
+	sort.Strings(uids)
+
+	var updated []string
+	for _, uid := range uids {
+		exp, err := s.exp.FindByUid(context.Background(), uid)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		if exp == nil || exp.Kind != core.NetworkAttack {
+			continue
+		}
+
+		changed, err := s.resolveExperiment(exp)
+		if err != nil {
+			// the addresses resolved last time are kept
+			log.Error("failed to resolve hostnames of experiment", zap.String("uid", uid), zap.Error(err))
+			continue
+		}
+
+		if changed {
+			updated = append(updated, uid)
+		}
+	}
+
+	return updated, nil
+}
+
+// resolveExperiment resolves the addresses of the experiment and flushes its ipsets with them
+// if they change, it returns true if any ipset is updated. The addresses of a family whose ipset
+// isn't created by the experiment are ignored, because no rule uses the ipset.
+func (s *Server) resolveExperiment(exp *core.Experiment) (bool, error) {
+	config, err := exp.GetRequestCommand()
+	if err != nil {
+		return false, errors.WithStack(err)
+	}
+
+	attack, ok := config.(*core.NetworkCommand)
+	if !ok || len(attack.Hostname) == 0 {
+		return false, nil
+	}
+
+	rules, err := s.ipsetRule.FindByExperiment(context.Background(), exp.Uid)
+	if err != nil {
+		return false, errors.WithStack(err)
+	}
+
+	// the ipsets are only set while the scheduled experiment runs
+	if len(rules) == 0 {
+		return false, nil
+	}
+
+	ipv4Set, ipv6Set, err := attack.ToIPSets(fmt.Sprintf("chaos-%s", exp.Uid[:16]))
+	if err != nil {
+		return false, errors.WithStack(err)
+	}
+
+	// the hostnames are resolved without the lock, and the rules are read again with it,
+	// because they may be recovered or set again meanwhile
+	s.networkLock.Lock()
+	defer s.networkLock.Unlock()
+
+	rules, err = s.ipsetRule.FindByExperiment(context.Background(), exp.Uid)
+	if err != nil || len(rules) == 0 {
+		return false, errors.WithStack(err)
+	}
+
+	sets := map[string]*pb.IPSet{ipv4Set.Name: ipv4Set}
+	if ipv6Set != nil {
+		sets[ipv6Set.Name] = ipv6Set
+	}
+
+	changed := false
+	for _, rule := range rules {
+		set, ok := sets[rule.Name]
+		if !ok {
+			set = &pb.IPSet{Name: rule.Name}
+		}
+		delete(sets, rule.Name)
+
+		// the addresses may be answered in a different order every time
+		sort.Strings(set.Cidrs)
+		cidrs := strings.Join(set.Cidrs, ",")
+		if cidrs == sortedCidrs(rule.Cidrs) {
+			continue
+		}
+
+		if rule.Family == core.FamilyIPv6 {
+			err = s.flushIPv6Set(rule.ContainerID, set)
+		} else {
+			_, err = s.svr.FlushIPSets(context.Background(), &pb.IPSetsRequest{
+				Ipsets:      []*pb.IPSet{set},
+				ContainerId: rule.ContainerID,
+				EnterNS:     len(rule.ContainerID) > 0,
+			})
+		}
+		if err != nil {
+			return changed, errors.WithStack(err)
+		}
+
+		log.Info("ipset updated with the resolved addresses", zap.String("ipset", rule.Name),
+			zap.String("old", rule.Cidrs), zap.String("new", cidrs))
+
+		rule.Cidrs = cidrs
+		if err := s.ipsetRule.Set(context.Background(), rule); err != nil {
+			return changed, errors.WithStack(err)
+		}
+		changed = true
+	}
+
+	for name, set := range sets {
+		if len(set.Cidrs) > 0 {
+			log.Warn("the resolved addresses are ignored because the ipset of their family isn't created",
+				zap.String("ipset", name), zap.Strings("cidrs", set.Cidrs))
+		}
+	}
+
+	return changed, nil
+}
+
+// sortedCidrs sorts the cidrs separated by comma.
+func sortedCidrs(cidrs string) string {
+	if len(cidrs) == 0 {
+		return ""
+	}
+
+	list := strings.Split(cidrs, ",")
+	sort.Strings(list)
+
+	return strings.Join(list, ",")
+}
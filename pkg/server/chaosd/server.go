@@ -14,7 +14,10 @@
 package chaosd
 
 import (
+	"sync"
+
 	"github.com/chaos-mesh/chaos-mesh/pkg/chaosdaemon"
+	"github.com/chaos-mesh/chaos-mesh/pkg/chaosdaemon/crclients"
 
 	"github.com/chaos-mesh/chaosd/pkg/config"
 	"github.com/chaos-mesh/chaosd/pkg/core"
@@ -30,6 +33,20 @@ type Server struct {
 	tcRule       core.TCRuleStore
 	conf         *config.Config
 	svr          *chaosdaemon.DaemonServer
+	crClient     crclients.ContainerRuntimeInfoClient
+
+	// networkLock serializes the changes of network rules by the network attacks, their recovery,
+	// the reconciliation of drifted rules and the resolution of hostnames, which read the recorded
+	// rules and set all the rules of a network namespace again
+	networkLock sync.Mutex
+
+	// driftReport is the report of the last reconciliation of network rules
+	driftLock   sync.Mutex
+	driftReport *DriftReport
+
+	// restartObservations maps the uid of restart experiment to the channel closed when the
+	// observation of the restart is done
+	restartObservations sync.Map
 }
 
 func NewServer(
@@ -40,6 +57,7 @@ func NewServer(
 	iptables core.IptablesRuleStore,
 	tc core.TCRuleStore,
 	svr *chaosdaemon.DaemonServer,
+	crClient crclients.ContainerRuntimeInfoClient,
 	cron scheduler.Scheduler,
 ) *Server {
 	return &Server{
@@ -51,5 +69,6 @@ func NewServer(
 		iptablesRule: iptables,
 		tcRule:       tc,
 		svr:          svr,
+		crClient:     crClient,
 	}
 }
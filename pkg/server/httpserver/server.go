@@ -69,6 +69,14 @@ func Register(s *httpServer, scheduler scheduler.Scheduler) {
 	}()
 
 	scheduler.Start()
+
+	if s.conf.ReconcileInterval > 0 {
+		s.chaos.StartReconciler(s.conf.ReconcileInterval, s.conf.ReconcileReapply)
+	}
+
+	if s.conf.ResolveInterval > 0 {
+		s.chaos.StartResolver(s.conf.ResolveInterval)
+	}
 }
 
 func handler(s *httpServer) {
@@ -80,9 +88,11 @@ func handler(s *httpServer) {
 	attack := api.Group("/attack")
 	{
 		attack.POST("/process", s.createProcessAttack)
+		attack.POST("/process/preview", s.previewProcessAttack)
 		attack.POST("/stress", s.createStressAttack)
 		attack.POST("/network", s.createNetworkAttack)
 		attack.POST("/disk", s.createDiskAttack)
+		attack.POST("/http", s.createHTTPAttack)
 
 		attack.DELETE("/:uid", s.recoverAttack)
 	}
@@ -97,6 +107,7 @@ func handler(s *httpServer) {
 	{
 		system.GET("/health", s.healthcheck)
 		system.GET("/version", s.version)
+		system.GET("/drift", s.drift)
 	}
 }
 
@@ -125,6 +136,31 @@ func (s *httpServer) createProcessAttack(c *gin.Context) {
 	c.JSON(http.StatusOK, utils.AttackSuccessResponse(uid))
 }
 
+// @Summary Preview process attack.
+// @Description List the processes which would be attacked by the process attack without attacking them.
+// @Tags attack
+// @Produce json
+// @Param request body core.ProcessCommand true "Request body"
+// @Success 200 {array} chaosd.ProcessInfo
+// @Failure 400 {object} utils.APIError
+// @Failure 500 {object} utils.APIError
+// @Router /api/attack/process/preview [post]
+func (s *httpServer) previewProcessAttack(c *gin.Context) {
+	attack := core.NewProcessCommand()
+	if err := c.ShouldBindJSON(attack); err != nil {
+		c.AbortWithError(http.StatusBadRequest, utils.ErrInternalServer.WrapWithNoMessage(err))
+		return
+	}
+
+	processes, err := s.chaos.PreviewProcesses(attack)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, processes)
+}
+
 // @Summary Create network attack.
 // @Description Create network attack.
 // @Tags attack
@@ -140,6 +176,7 @@ func (s *httpServer) createNetworkAttack(c *gin.Context) {
 		c.AbortWithError(http.StatusBadRequest, utils.ErrInternalServer.WrapWithNoMessage(err))
 		return
 	}
+	attack.CompleteDefaults()
 
 	uid, err := s.chaos.ExecuteAttack(chaosd.NetworkAttack, attack, core.ServerMode)
 	if err != nil {
@@ -201,6 +238,31 @@ func (s *httpServer) createDiskAttack(c *gin.Context) {
 	c.JSON(http.StatusOK, utils.AttackSuccessResponse(uid))
 }
 
+// @Summary Create http attack.
+// @Description Create http attack.
+// @Tags attack
+// @Produce json
+// @Param request body core.HTTPCommand true "Request body"
+// @Success 200 {object} utils.Response
+// @Failure 400 {object} utils.APIError
+// @Failure 500 {object} utils.APIError
+// @Router /api/attack/http [post]
+func (s *httpServer) createHTTPAttack(c *gin.Context) {
+	attack := core.NewHTTPCommand()
+	if err := c.ShouldBindJSON(attack); err != nil {
+		c.AbortWithError(http.StatusBadRequest, utils.ErrInternalServer.WrapWithNoMessage(err))
+		return
+	}
+
+	uid, err := s.chaos.ExecuteAttack(chaosd.HTTPAttack, attack, core.ServerMode)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, utils.AttackSuccessResponse(uid))
+}
+
 // @Summary Create recover attack.
 // @Description Create recover attack.
 // @Tags attack
@@ -18,6 +18,7 @@ import (
 
 	"github.com/gin-gonic/gin"
 
+	"github.com/chaos-mesh/chaosd/pkg/server/utils"
 	"github.com/chaos-mesh/chaosd/pkg/version"
 )
 
@@ -33,3 +34,21 @@ func (s *httpServer) healthcheck(c *gin.Context) {
 func (s *httpServer) version(c *gin.Context) {
 	c.JSON(http.StatusOK, version.Get())
 }
+
+// @Summary Get the drifts of network rules.
+// @Description Get the network rules of active experiments which are recorded but not found in the kernel.
+// @Tags system
+// @Produce json
+// @Param refresh query bool false "compare the rules with the kernel now instead of returning the last report"
+// @Success 200 {object} chaosd.DriftReport
+// @Failure 500 {object} utils.APIError
+// @Router /api/system/drift [get]
+func (s *httpServer) drift(c *gin.Context) {
+	report, err := s.chaos.DriftReport(c.Query("refresh") == "true")
+	if err != nil {
+		_ = c.AbortWithError(http.StatusInternalServerError, utils.ErrInternalServer.WrapWithNoMessage(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
@@ -77,6 +77,21 @@ func (store *experimentRunStore) LatestRun(ctx context.Context, id uint) (*core.
 	return run, nil
 }
 
+func (store *experimentRunStore) FindByUID(_ context.Context, runUid string) (*core.ExperimentRun, error) {
+	run := &core.ExperimentRun{}
+	if err := store.db.
+		Preload("Experiment").
+		First(run, "uid = ?", runUid).
+		Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, perr.WithStack(err)
+	}
+
+	return run, nil
+}
+
 func (store *experimentRunStore) NewRun(_ context.Context, expRun *core.ExperimentRun) error {
 	return store.db.Model(core.ExperimentRun{}).Save(expRun).Error
 }
@@ -88,3 +103,19 @@ func (store *experimentRunStore) Update(_ context.Context, runUid string, status
 		Updates(core.Experiment{Status: status, Message: message}).
 		Error
 }
+
+func (store *experimentRunStore) UpdateResult(_ context.Context, runUid string, result string) error {
+	return store.db.
+		Model(core.ExperimentRun{}).
+		Where("uid = ?", runUid).
+		Update("result", result).
+		Error
+}
+
+func (store *experimentRunStore) UpdateRecoverCommand(_ context.Context, runUid string, recoverCommand string) error {
+	return store.db.
+		Model(core.ExperimentRun{}).
+		Where("uid = ?", runUid).
+		Update("recover_command", recoverCommand).
+		Error
+}
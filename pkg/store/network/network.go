@@ -112,6 +112,18 @@ func (i *iptablesRuleStore) FindByExperiment(_ context.Context, experiment strin
 	return rules, nil
 }
 
+func (i *iptablesRuleStore) FindByContainerID(_ context.Context, containerID string) ([]*core.IptablesRule, error) {
+	rules := make([]*core.IptablesRule, 0)
+	// the container_id of rules recorded by the former versions is NULL
+	if err := i.db.
+		Where("COALESCE(container_id, '') = ?", containerID).
+		Find(&rules).
+		Error; err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, perr.WithStack(err)
+	}
+	return rules, nil
+}
+
 func (i *iptablesRuleStore) DeleteByExperiment(_ context.Context, experiment string) error {
 	return i.db.
 		Where("experiment = ?", experiment).
@@ -147,10 +159,32 @@ func (t *tcRuleStore) List(_ context.Context) ([]*core.TCRule, error) {
 	return rules, nil
 }
 
-func (t *tcRuleStore) FindByDevice(_ context.Context, device string) ([]*core.TCRule, error) {
+func (t *tcRuleStore) FindByDevice(_ context.Context, containerID string, device string) ([]*core.TCRule, error) {
+	rules := make([]*core.TCRule, 0)
+	if err := t.db.
+		Where("COALESCE(container_id, '') = ? AND device = ?", containerID, device).
+		Find(&rules).
+		Error; err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, perr.WithStack(err)
+	}
+	return rules, nil
+}
+
+func (t *tcRuleStore) FindByIngressDevice(_ context.Context, containerID string, device string) ([]*core.TCRule, error) {
+	rules := make([]*core.TCRule, 0)
+	if err := t.db.
+		Where("COALESCE(container_id, '') = ? AND ingress_device = ?", containerID, device).
+		Find(&rules).
+		Error; err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, perr.WithStack(err)
+	}
+	return rules, nil
+}
+
+func (t *tcRuleStore) FindByEgressDevice(_ context.Context, containerID string, device string) ([]*core.TCRule, error) {
 	rules := make([]*core.TCRule, 0)
 	if err := t.db.
-		Where("device = ?", device).
+		Where("COALESCE(container_id, '') = ? AND egress_device = ?", containerID, device).
 		Find(&rules).
 		Error; err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
 		return nil, perr.WithStack(err)
@@ -177,11 +211,19 @@ func (t *tcRuleStore) DeleteByExperiment(_ context.Context, experiment string) e
 		Error
 }
 
-func (t *tcRuleStore) ListGroupDevice(ctx context.Context) (map[string][]*core.TCRule, error) {
+func (t *tcRuleStore) Delete(_ context.Context, rule *core.TCRule) error {
+	return t.db.
+		Unscoped().
+		Delete(rule).
+		Error
+}
+
+func (t *tcRuleStore) ListGroupDevice(ctx context.Context, containerID string) (map[string][]*core.TCRule, error) {
 	rules := make(map[string][]*core.TCRule)
 	devices := []string{}
 	if err := t.db.
 		Model(&core.TCRule{}).
+		Where("COALESCE(container_id, '') = ?", containerID).
 		Select("device").
 		Group("device").
 		Find(&devices).
@@ -190,7 +232,7 @@ func (t *tcRuleStore) ListGroupDevice(ctx context.Context) (map[string][]*core.T
 	}
 
 	for _, device := range devices {
-		rs, err := t.FindByDevice(ctx, device)
+		rs, err := t.FindByDevice(ctx, containerID, device)
 		if err != nil {
 			return nil, perr.WithStack(err)
 		}
@@ -0,0 +1,85 @@
+// Copyright 2021 Chaos Mesh Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/pingcap/errors"
+)
+
+// GetCgroupV2Path returns the path of the process in the cgroup v2 hierarchy,
+// such as /system.slice/nginx.service.
+func GetCgroupV2Path(pid int) (string, error) {
+	content, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/cgroup", pid)) // #nosec
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	path, ok := ParseCgroupV2Path(string(content))
+	if !ok {
+		return "", errors.Errorf("process %d doesn't belong to any cgroup v2", pid)
+	}
+
+	return path, nil
+}
+
+// ParseCgroupV2Path parses the content of /proc/<pid>/cgroup, the line of
+// cgroup v2 looks like "0::/system.slice/nginx.service".
+func ParseCgroupV2Path(content string) (string, bool) {
+	for _, line := range strings.Split(content, "\n") {
+		if strings.HasPrefix(line, "0::") {
+			return strings.TrimSpace(strings.TrimPrefix(line, "0::")), true
+		}
+	}
+
+	return "", false
+}
+
+// GetCgroupV1Path returns the path of the process in the cgroup v1 hierarchy of the controller,
+// such as /system.slice/nginx.service in the freezer hierarchy.
+func GetCgroupV1Path(pid int, controller string) (string, error) {
+	content, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/cgroup", pid)) // #nosec
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	path, ok := ParseCgroupV1Path(string(content), controller)
+	if !ok {
+		return "", errors.Errorf("process %d doesn't belong to any cgroup v1 of %s", pid, controller)
+	}
+
+	return path, nil
+}
+
+// ParseCgroupV1Path parses the content of /proc/<pid>/cgroup, the line of cgroup v1
+// looks like "6:freezer:/system.slice/nginx.service" or "12:net_cls,net_prio:/".
+func ParseCgroupV1Path(content string, controller string) (string, bool) {
+	for _, line := range strings.Split(content, "\n") {
+		fields := strings.SplitN(line, ":", 3)
+		if len(fields) != 3 {
+			continue
+		}
+
+		for _, c := range strings.Split(fields[1], ",") {
+			if c == controller {
+				return strings.TrimSpace(fields[2]), true
+			}
+		}
+	}
+
+	return "", false
+}
@@ -0,0 +1,92 @@
+// Copyright 2021 Chaos Mesh Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestParseCgroupV2Path(t *testing.T) {
+	g := NewGomegaWithT(t)
+	type TestCase struct {
+		name         string
+		content      string
+		expectedPath string
+		expectedOK   bool
+	}
+	tcs := []TestCase{
+		{
+			name:         "cgroup v2",
+			content:      "0::/system.slice/nginx.service\n",
+			expectedPath: "/system.slice/nginx.service",
+			expectedOK:   true,
+		},
+		{
+			name:         "hybrid",
+			content:      "12:net_cls,net_prio:/\n1:name=systemd:/user.slice\n0::/user.slice/user-1000.slice\n",
+			expectedPath: "/user.slice/user-1000.slice",
+			expectedOK:   true,
+		},
+		{
+			name:       "cgroup v1",
+			content:    "12:net_cls,net_prio:/\n1:name=systemd:/user.slice\n",
+			expectedOK: false,
+		},
+	}
+	for _, tc := range tcs {
+		path, ok := ParseCgroupV2Path(tc.content)
+		g.Expect(ok).To(Equal(tc.expectedOK), tc.name)
+		g.Expect(path).To(Equal(tc.expectedPath), tc.name)
+	}
+}
+
+func TestParseCgroupV1Path(t *testing.T) {
+	g := NewGomegaWithT(t)
+	type TestCase struct {
+		name         string
+		content      string
+		controller   string
+		expectedPath string
+		expectedOK   bool
+	}
+	tcs := []TestCase{
+		{
+			name:         "freezer",
+			content:      "12:net_cls,net_prio:/\n6:freezer:/system.slice/nginx.service\n0::/system.slice/nginx.service\n",
+			controller:   "freezer",
+			expectedPath: "/system.slice/nginx.service",
+			expectedOK:   true,
+		},
+		{
+			name:         "joined controllers",
+			content:      "12:net_cls,net_prio:/\n6:freezer:/system.slice/nginx.service\n",
+			controller:   "net_prio",
+			expectedPath: "/",
+			expectedOK:   true,
+		},
+		{
+			name:       "cgroup v2",
+			content:    "0::/system.slice/nginx.service\n",
+			controller: "freezer",
+			expectedOK: false,
+		},
+	}
+	for _, tc := range tcs {
+		path, ok := ParseCgroupV1Path(tc.content, tc.controller)
+		g.Expect(ok).To(Equal(tc.expectedOK), tc.name)
+		g.Expect(path).To(Equal(tc.expectedPath), tc.name)
+	}
+}
@@ -20,8 +20,6 @@ import (
 
 // IPToCidr converts from an ip to a full mask cidr
 func IPToCidr(ip string) string {
-	// TODO: support IPv6 correctly
-
 	// distinguish is IPv4 or IPv6 address
 	// no error checking here!
 	if net.ParseIP(ip).To4() != nil {
@@ -65,12 +63,20 @@ func ResolveCidr(name string) ([]string, error) {
 
 	cidrs := []string{}
 	for _, addr := range addrs {
-		addr := addr.String()
+		cidrs = append(cidrs, IPToCidr(addr.String()))
+	}
+	return cidrs, nil
+}
 
-		// TODO: support IPv6
-		if strings.Contains(addr, ".") {
-			cidrs = append(cidrs, IPToCidr(addr))
+// SplitCidrsByFamily splits the cidrs into IPv4 cidrs and IPv6 cidrs
+func SplitCidrsByFamily(cidrs []string) (ipv4 []string, ipv6 []string) {
+	for _, cidr := range cidrs {
+		if strings.Contains(cidr, ":") {
+			ipv6 = append(ipv6, cidr)
+		} else {
+			ipv4 = append(ipv4, cidr)
 		}
 	}
-	return cidrs, nil
+
+	return
 }
@@ -64,3 +64,11 @@ func TestResolveCidrs(t *testing.T) {
 		g.Expect(ResolveCidrs(tc.names)).To(Equal(tc.expectedValue))
 	}
 }
+
+func TestSplitCidrsByFamily(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	ipv4, ipv6 := SplitCidrsByFamily([]string{"192.0.2.0/24", "2001:db8::/32", "172.8.4.2/32", "::1/128"})
+	g.Expect(ipv4).To(Equal([]string{"192.0.2.0/24", "172.8.4.2/32"}))
+	g.Expect(ipv6).To(Equal([]string{"2001:db8::/32", "::1/128"}))
+}
@@ -0,0 +1,130 @@
+// Copyright 2021 Chaos Mesh Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"go.uber.org/zap"
+)
+
+// ReplaceFile replaces the file by a temporary file with the content, so the file is never
+// seen half written. Replacing a file bind-mounted into containers, such as /etc/hosts, fails
+// with `Device or resource busy`, then the file is rewritten in place by WriteFileInPlace.
+func ReplaceFile(name string, content []byte) error {
+	info, err := os.Stat(name)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	f, err := ioutil.TempFile(filepath.Dir(name), "."+filepath.Base(name)+".chaosd-")
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	tmp := f.Name()
+
+	err = writeAndSync(f, content, info)
+	if err == nil {
+		err = os.Rename(tmp, name)
+	}
+
+	if err == nil {
+		return nil
+	}
+
+	if removeErr := os.Remove(tmp); removeErr != nil && !os.IsNotExist(removeErr) {
+		log.Warn("failed to remove the temporary file", zap.String("file", tmp), zap.Error(removeErr))
+	}
+
+	if linkErr, ok := err.(*os.LinkError); ok && linkErr.Err == syscall.EBUSY {
+		return WriteFileInPlace(name, content)
+	}
+
+	return errors.WithStack(err)
+}
+
+// writeAndSync writes the content to the new file with the mode and owner of the original file.
+func writeAndSync(f *os.File, content []byte, info os.FileInfo) error {
+	_, err := f.Write(content)
+	if err == nil {
+		err = f.Chmod(info.Mode())
+	}
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok && err == nil {
+		err = f.Chown(int(stat.Uid), int(stat.Gid))
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+
+	return err
+}
+
+// WriteFileInPlace rewrites the content of the file without replacing the file, the content is
+// written by one write, then the file is truncated to its length. The file may be seen half written
+// by the readers, and it's left half written if the writer dies, so the original content is backed up
+// to `<name>.chaosd-backup` first, which is removed after the file is rewritten.
+func WriteFileInPlace(name string, content []byte) (err error) {
+	original, err := ioutil.ReadFile(name) // #nosec
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	backup := name + ".chaosd-backup"
+	if err = ioutil.WriteFile(backup, original, 0600); err != nil {
+		return errors.WithStack(err)
+	}
+
+	if err = writeFileInPlace(name, content); err != nil {
+		log.Error("failed to rewrite the file, the original content is kept in the backup",
+			zap.String("file", name), zap.String("backup", backup), zap.Error(err))
+		return errors.WithStack(err)
+	}
+
+	return errors.WithStack(os.Remove(backup))
+}
+
+func writeFileInPlace(name string, content []byte) (err error) {
+	f, err := os.OpenFile(name, os.O_WRONLY, 0)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer func() {
+		if closeErr := f.Close(); closeErr != nil && err == nil {
+			err = errors.WithStack(closeErr)
+		}
+	}()
+
+	if _, err = f.WriteAt(content, 0); err != nil {
+		return errors.WithStack(err)
+	}
+
+	if err = f.Truncate(int64(len(content))); err != nil {
+		return errors.WithStack(err)
+	}
+
+	if err = f.Sync(); err != nil {
+		return errors.WithStack(err)
+	}
+
+	return nil
+}
@@ -0,0 +1,79 @@
+// Copyright 2021 Chaos Mesh Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestReplaceFile(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	dir, err := ioutil.TempDir("", "chaosd-file")
+	g.Expect(err).ShouldNot(HaveOccurred())
+	defer os.RemoveAll(dir)
+
+	name := filepath.Join(dir, "hosts")
+	g.Expect(ioutil.WriteFile(name, []byte("127.0.0.1 localhost\n::1 localhost\n"), 0640)).ShouldNot(HaveOccurred())
+
+	g.Expect(ReplaceFile(name, []byte("127.0.0.1 localhost\n"))).ShouldNot(HaveOccurred())
+
+	content, err := ioutil.ReadFile(name)
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(string(content)).Should(Equal("127.0.0.1 localhost\n"))
+
+	info, err := os.Stat(name)
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(info.Mode().Perm()).Should(Equal(os.FileMode(0640)))
+
+	// the temporary file is renamed to the file
+	files, err := ioutil.ReadDir(dir)
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(files).Should(HaveLen(1))
+
+	g.Expect(ReplaceFile(filepath.Join(dir, "missing"), nil)).Should(HaveOccurred())
+}
+
+func TestWriteFileInPlace(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	dir, err := ioutil.TempDir("", "chaosd-file")
+	g.Expect(err).ShouldNot(HaveOccurred())
+	defer os.RemoveAll(dir)
+
+	name := filepath.Join(dir, "hosts")
+	g.Expect(ioutil.WriteFile(name, []byte("127.0.0.1 localhost\n::1 localhost\n"), 0644)).ShouldNot(HaveOccurred())
+
+	before, err := os.Stat(name)
+	g.Expect(err).ShouldNot(HaveOccurred())
+
+	g.Expect(WriteFileInPlace(name, []byte("127.0.0.1 localhost\n"))).ShouldNot(HaveOccurred())
+
+	content, err := ioutil.ReadFile(name)
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(string(content)).Should(Equal("127.0.0.1 localhost\n"))
+
+	// the file isn't replaced, and the backup is removed after the file is rewritten
+	after, err := os.Stat(name)
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(os.SameFile(before, after)).Should(BeTrue())
+
+	_, err = os.Stat(name + ".chaosd-backup")
+	g.Expect(os.IsNotExist(err)).Should(BeTrue())
+}
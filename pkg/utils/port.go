@@ -0,0 +1,50 @@
+// Copyright 2021 Chaos Mesh Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/pingcap/errors"
+)
+
+// ParsePorts parses the ports separated by comma, the port range looks like 8080:8090.
+func ParsePorts(p string) ([]uint16, error) {
+	ports := make([]uint16, 0)
+	for _, item := range strings.Split(p, ",") {
+		bounds := strings.Split(item, ":")
+		if len(bounds) > 2 {
+			return nil, errors.Errorf("port %s not valid", item)
+		}
+
+		start, err := strconv.ParseUint(bounds[0], 10, 16)
+		if err != nil {
+			return nil, errors.Errorf("port %s not valid", item)
+		}
+
+		end := start
+		if len(bounds) == 2 {
+			if end, err = strconv.ParseUint(bounds[1], 10, 16); err != nil || end < start {
+				return nil, errors.Errorf("port %s not valid", item)
+			}
+		}
+
+		for port := start; port <= end; port++ {
+			ports = append(ports, uint16(port))
+		}
+	}
+
+	return ports, nil
+}
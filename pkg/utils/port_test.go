@@ -0,0 +1,61 @@
+// Copyright 2021 Chaos Mesh Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestParsePorts(t *testing.T) {
+	g := NewGomegaWithT(t)
+	type TestCase struct {
+		name          string
+		ports         string
+		expectedValue []uint16
+		expectedErr   bool
+	}
+	tcs := []TestCase{
+		{
+			name:          "list and range",
+			ports:         "80,8080:8082",
+			expectedValue: []uint16{80, 8080, 8081, 8082},
+		},
+		{
+			name:        "reversed range",
+			ports:       "8082:8080",
+			expectedErr: true,
+		},
+		{
+			name:        "out of range",
+			ports:       "65536",
+			expectedErr: true,
+		},
+		{
+			name:        "empty",
+			ports:       "80,",
+			expectedErr: true,
+		},
+	}
+	for _, tc := range tcs {
+		ports, err := ParsePorts(tc.ports)
+		if tc.expectedErr {
+			g.Expect(err).Should(HaveOccurred(), tc.name)
+			continue
+		}
+		g.Expect(err).ShouldNot(HaveOccurred(), tc.name)
+		g.Expect(ports).Should(Equal(tc.expectedValue), tc.name)
+	}
+}